@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/internal/admin"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+)
+
+// runCommand executes a maintenance command given on the command line instead of
+// starting the server, and returns the process exit code.
+//
+//	banking-app ledger verify
+//	banking-app user role <username> <customer|teller|admin>
+//	banking-app ratelimit prune
+//	banking-app holds expire
+//	banking-app audit verify
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "ledger" && args[1] == "verify":
+		return ledgerVerify()
+	case len(args) == 4 && args[0] == "user" && args[1] == "role":
+		return userRole(args[2], args[3])
+	case len(args) == 2 && args[0] == "ratelimit" && args[1] == "prune":
+		return rateLimitPrune()
+	case len(args) == 2 && args[0] == "holds" && args[1] == "expire":
+		return holdsExpire()
+	case len(args) == 2 && args[0] == "audit" && args[1] == "verify":
+		return auditVerify()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %v\nusage: banking-app ledger verify | user role <username> <role> | ratelimit prune | holds expire | audit verify\n", args)
+		return 2
+	}
+}
+
+// ledgerVerify recomputes every balance from the journal and reports any drift
+func ledgerVerify() int {
+	report, err := ledger.Verify(context.Background(), db.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error verifying ledger:", err)
+		return 1
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// auditVerify walks the hash chain of the audit log and reports any tampering
+func auditVerify() int {
+	report, err := audit.Verify(context.Background(), db.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error verifying audit log:", err)
+		return 1
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// userRole sets the role of a user; it is how the first admin is created
+func userRole(username, role string) int {
+	_, err := admin.InitService().SetUserRoleByUsername(context.Background(), username, role)
+	switch {
+	case errors.Is(err, admin.ErrInvalidRole):
+		fmt.Fprintln(os.Stderr, "Invalid role:", role)
+		return 2
+	case errors.Is(err, admin.ErrUserNotFound):
+		fmt.Fprintln(os.Stderr, "User not found:", username)
+		return 1
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Error updating role:", err)
+		return 1
+	}
+	fmt.Printf("%s is now %s\n", username, role)
+	return 0
+}
+
+// rateLimitPrune deletes rate limit counters from Postgres that no longer block anything
+func rateLimitPrune() int {
+	if err := ratelimit.InitPostgresStore().DeleteExpired(context.Background(), time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error pruning rate limit counters:", err)
+		return 1
+	}
+	return 0
+}
+
+// holdsExpire releases the holds that expired without being captured or voided
+func holdsExpire() int {
+	released, err := transfer.InitRepository().ExpireHolds(context.Background(), time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error expiring holds:", err)
+		return 1
+	}
+	fmt.Printf("released %d expired holds\n", released)
+	return 0
+}
@@ -1,5 +1,30 @@
 package common
 
 const (
-	JwtSecretKey = "JWT_SECRET_KEY"
+	JwtSecretKey               = "JWT_SECRET_KEY"
+	JwtSigningAlg              = "JWT_SIGNING_ALG"
+	JwtSigningKeyFile          = "JWT_SIGNING_KEY_FILE"
+	JwtVerificationKeyFiles    = "JWT_VERIFICATION_KEY_FILES"
+	TokenFormat                = "TOKEN_FORMAT"
+	PasetoLocalKey             = "PASETO_LOCAL_KEY"
+	PasetoSigningKeyFile       = "PASETO_SIGNING_KEY_FILE"
+	SmtpAddr                   = "SMTP_ADDR"
+	SmtpUsername               = "SMTP_USERNAME"
+	SmtpPassword               = "SMTP_PASSWORD"
+	MailFrom                   = "MAIL_FROM"
+	MailDir                    = "MAIL_DIR"
+	RequireEmailVerification   = "REQUIRE_EMAIL_VERIFICATION"
+	FxRatesFile                = "FX_RATES_FILE"
+	StepUpThresholds           = "STEP_UP_THRESHOLDS"
+	RateLimitStore             = "RATE_LIMIT_STORE"
+	RateLimits                 = "RATE_LIMITS"
+	TrustedProxies             = "TRUSTED_PROXIES"
+	ScheduledTransfersInterval = "SCHEDULED_TRANSFERS_INTERVAL"
+	HoldExpiryInterval         = "HOLD_EXPIRY_INTERVAL"
+	SimulatedFunding           = "SIMULATED_FUNDING"
+	EventsPublisher            = "EVENTS_PUBLISHER"
+	NatsURL                    = "NATS_URL"
+	OutboxRelayInterval        = "OUTBOX_RELAY_INTERVAL"
+	WebhookAllowHTTP           = "WEBHOOK_ALLOW_HTTP"
+	WebhookDeliveryInterval    = "WEBHOOK_DELIVERY_INTERVAL"
 )
@@ -1,20 +1,46 @@
 package db
 
-import "github.com/ahmedkhaeld/banking-app/db/models"
+import (
+	"fmt"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+)
 
 func RunMigrations() error {
 	if err := AddUUIDExtension(); err != nil {
 		return err
 	}
+	if err := dropCascadingAccountKeys(); err != nil {
+		return err
+	}
 
 	if err := DB.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
 		&models.Account{},
+		&models.Hold{},
+		&models.Journal{},
 		&models.Entry{},
 		&models.Transfer{},
+		&models.ScheduledTransfer{},
+		&models.ScheduledTransferRun{},
+		&models.IdempotencyKey{},
+		&models.FxQuote{},
+		&models.AuditLog{},
+		&models.OutboxEvent{},
+		&models.OutboxDelivery{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.RateLimitCounter{},
+		&models.RateLimitBucket{},
 	); err != nil {
 		return err
 	}
+	if err := protectAuditLog(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -25,3 +51,37 @@ func AddUUIDExtension() error {
 	}
 	return nil
 }
+
+// dropCascadingAccountKeys drops foreign keys that delete history together with its account.
+// AutoMigrate only creates missing constraints, so it recreates them as ON DELETE RESTRICT.
+func dropCascadingAccountKeys() error {
+	var keys []struct {
+		Table string
+		Name  string
+	}
+	err := DB.Raw(`SELECT conrelid::regclass::text AS "table", conname AS name FROM pg_constraint
+		WHERE contype = 'f' AND confdeltype = 'c' AND confrelid = to_regclass('accounts')`).Scan(&keys).Error
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := DB.Exec(fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %q`, key.Table, key.Name)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectAuditLog makes the audit log append-only: Postgres refuses to update or delete its rows
+func protectAuditLog() error {
+	err := DB.Exec(`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+	return DB.Exec(`CREATE OR REPLACE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs
+		FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`).Error
+}
@@ -4,22 +4,42 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Account statuses. Frozen accounts can neither send nor receive money until they are
+// unfrozen; closed accounts never again. A closed account keeps its history.
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
 )
 
 type Account struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
-	Balance   int64     `json:"balance" gorm:"type:bigint;default:0"`
-	Owner     string    `json:"owner" gorm:"index;not null"`
-	Currency  string    `json:"currency" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID      uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	Balance     int64          `json:"balance" gorm:"type:bigint;default:0;comment:minor units of currency"`
+	HeldBalance int64          `json:"held_balance" gorm:"type:bigint;not null;default:0;comment:minor units of currency reserved by active holds"`
+	Owner       string         `json:"owner" gorm:"index;not null"`
+	Currency    string         `json:"currency" gorm:"not null"`
+	IsSystem    bool           `json:"is_system" gorm:"not null;default:false;comment:ledger clearing account, may go negative"`
+	Status      string         `json:"status" gorm:"not null;default:active;index"`
+	ClosedAt    *time.Time     `json:"closed_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index;comment:deletes are soft, history refuses a hard delete"`
 	// Relationships
-	Entries       []Entry    `json:"entries,omitempty" gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	TransfersFrom []Transfer `json:"transfers_from,omitempty" gorm:"foreignKey:FromAccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	TransfersTo   []Transfer `json:"transfers_to,omitempty" gorm:"foreignKey:ToAccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Entries       []Entry    `json:"entries,omitempty" gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	TransfersFrom []Transfer `json:"transfers_from,omitempty" gorm:"foreignKey:FromAccountID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	TransfersTo   []Transfer `json:"transfers_to,omitempty" gorm:"foreignKey:ToAccountID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Holds         []Hold     `json:"holds,omitempty" gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
 }
 
 func (Account) TableName() string {
 	return "accounts"
 }
+
+// AvailableBalance is the part of the balance that is not held and can be spent
+func (a *Account) AvailableBalance() int64 {
+	return a.Balance - a.HeldBalance
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditLog records an action taken by an authenticated actor, or a security event such as a
+// login lockout. Rows are append-only and hash-chained in seq order: each hash covers the
+// row and the hash of the row before it, so an edited or deleted row breaks the chain.
+type AuditLog struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Seq          int64      `json:"seq" gorm:"autoIncrement;uniqueIndex;comment:position in the hash chain"`
+	ActorID      *uuid.UUID `json:"actor_id,omitempty" gorm:"type:uuid;index"`
+	ActorRole    string     `json:"actor_role"`
+	Action       string     `json:"action" gorm:"not null;index;comment:e.g. admin.account.freeze"`
+	ResourceType string     `json:"resource_type"`
+	ResourceID   string     `json:"resource_id,omitempty" gorm:"index"`
+	Details      string     `json:"details,omitempty" gorm:"type:text;comment:JSON details supplied by the handler"`
+	Before       string     `json:"before,omitempty" gorm:"type:text;comment:JSON snapshot of the resource before the action"`
+	After        string     `json:"after,omitempty" gorm:"type:text;comment:JSON snapshot of the resource after the action"`
+	StatusCode   int        `json:"status_code"`
+	ClientIP     string     `json:"client_ip"`
+	RequestID    string     `json:"request_id,omitempty" gorm:"type:varchar(64);index"`
+	PrevHash     string     `json:"prev_hash" gorm:"type:varchar(64);not null;default:''"`
+	Hash         string     `json:"hash" gorm:"type:varchar(64);not null;default:'';comment:hex SHA-256 of the row and prev_hash"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"not null;autoCreateTime;index"`
+}
+
+func (AuditLog) TableName() string { return "audit_logs" }
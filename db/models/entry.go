@@ -6,12 +6,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// Entry is a single posting of a Journal against one account.
 type Entry struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	AccountID uuid.UUID `gorm:"type:uuid;index;not null"`
-	Amount    int64     `gorm:"not null;comment:can be negative or positive"`
-	CreatedAt time.Time `gorm:"not null;autoCreateTime"`
-	Account   *Account  `gorm:"foreignKey:AccountID"`
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	AccountID  uuid.UUID  `gorm:"type:uuid;index;not null"`
+	JournalID  *uuid.UUID `gorm:"type:uuid;index"`
+	TransferID *uuid.UUID `gorm:"type:uuid;index"`
+	Amount     int64      `gorm:"not null;comment:minor units, can be negative or positive"`
+	Currency   string     `gorm:"type:varchar(3)"`
+	CreatedAt  time.Time  `gorm:"not null;autoCreateTime"`
+	Account    *Account   `gorm:"foreignKey:AccountID"`
 }
 
 func (Entry) TableName() string { return "entries" }
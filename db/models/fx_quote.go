@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FxQuote is a time-limited exchange rate offered to a user for a cross-currency transfer.
+type FxQuote struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	FromCurrency      string     `json:"from_currency" gorm:"type:varchar(3);not null"`
+	ToCurrency        string     `json:"to_currency" gorm:"type:varchar(3);not null"`
+	Rate              string     `json:"rate" gorm:"type:numeric(24,10);not null"`
+	SourceAmount      int64      `json:"source_amount" gorm:"not null;comment:minor units of from_currency"`
+	DestinationAmount int64      `json:"destination_amount" gorm:"not null;comment:minor units of to_currency"`
+	ExpiresAt         time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt            *time.Time `json:"used_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+}
+
+func (FxQuote) TableName() string { return "fx_quotes" }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Hold statuses. Only active holds reserve money; a captured hold became a transfer, and
+// voided and expired ones released their amount.
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves an amount of an account for a transfer that is authorized now and captured later
+type Hold struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	AccountID      uuid.UUID  `json:"account_id" gorm:"type:uuid;not null;index"`
+	ToAccountID    uuid.UUID  `json:"to_account_id" gorm:"type:uuid;not null"`
+	Amount         int64      `json:"amount" gorm:"not null;comment:must be positive, minor units of currency"`
+	Currency       string     `json:"currency" gorm:"type:varchar(3);not null"`
+	CapturedAmount int64      `json:"captured_amount" gorm:"not null;default:0;comment:minor units of currency"`
+	Status         string     `json:"status" gorm:"type:varchar(16);not null;default:active;index"`
+	TransferID     *uuid.UUID `json:"transfer_id,omitempty" gorm:"type:uuid;comment:the transfer made by the capture"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"not null;autoUpdateTime"`
+}
+
+func (Hold) TableName() string { return "holds" }
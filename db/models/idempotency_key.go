@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey stores the outcome of a request made with an Idempotency-Key header
+// so that retries of the same request replay the original response.
+type IdempotencyKey struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key"`
+	Key            string    `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	RequestHash    string    `gorm:"not null;comment:sha256 of method, path and body"`
+	ResponseStatus int       `gorm:"not null;default:0;comment:0 while the request is in flight"`
+	// LockedUntil ends the lease of an in-flight request; a retry after it takes the key over,
+	// so a request whose process died does not hold the key until it expires
+	LockedUntil *time.Time
+	ResponseBody   []byte    `gorm:"type:bytea"`
+	CreatedAt      time.Time `gorm:"not null;autoCreateTime"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+}
+
+func (IdempotencyKey) TableName() string { return "idempotency_keys" }
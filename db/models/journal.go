@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Journal is a double-entry ledger transaction. Its entries sum to zero per currency.
+type Journal struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Kind        string     `json:"kind" gorm:"type:varchar(32);not null;index"`
+	TransferID  *uuid.UUID `json:"transfer_id,omitempty" gorm:"type:uuid;index"`
+	Reference   string     `json:"reference,omitempty" gorm:"type:varchar(64);index;comment:caller's reference of a deposit or withdrawal"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	Entries     []Entry    `json:"entries,omitempty" gorm:"foreignKey:JournalID"`
+}
+
+func (Journal) TableName() string { return "journals" }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change it describes.
+// The relay queues an OutboxDelivery of each unpublished row for every subscriber and then
+// sets PublishedAt; consumers drop duplicates by ID.
+type OutboxEvent struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4();comment:dedup ID seen by consumers"`
+	Seq           int64      `json:"seq" gorm:"autoIncrement;uniqueIndex;comment:publish order"`
+	Type          string     `json:"type" gorm:"type:varchar(64);not null;index;comment:e.g. transfer.completed"`
+	AggregateType string     `json:"aggregate_type" gorm:"type:varchar(32);not null"`
+	AggregateID   uuid.UUID  `json:"aggregate_id" gorm:"type:uuid;not null;index"`
+	Payload       string     `json:"payload" gorm:"type:jsonb;not null"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	PublishedAt   *time.Time `json:"published_at,omitempty" gorm:"index;comment:set once the event is queued for every subscriber"`
+}
+
+func (OutboxEvent) TableName() string { return "outbox" }
+
+// OutboxDelivery is an outbox event still to be handed to one subscriber of the relay, e.g.
+// the events publisher or the webhook dispatcher. Every subscriber retries its own
+// deliveries, so one that is down holds back no other. The row is deleted once delivered.
+type OutboxDelivery struct {
+	ID         uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	EventID    uuid.UUID   `json:"event_id" gorm:"type:uuid;not null;uniqueIndex:idx_outbox_delivery_event_subscriber"`
+	Event      OutboxEvent `json:"-" gorm:"foreignKey:EventID"`
+	Subscriber string      `json:"subscriber" gorm:"type:varchar(32);not null;uniqueIndex:idx_outbox_delivery_event_subscriber;index:idx_outbox_delivery_due,priority:1"`
+	Seq        int64       `json:"seq" gorm:"not null;comment:seq of the event, to deliver in about the order they were recorded"`
+	Attempts   int         `json:"attempts" gorm:"not null;default:0;comment:failed attempts"`
+	// NextAttemptAt backs off after every failed attempt
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_delivery_due,priority:2"`
+	LastError     string     `json:"last_error,omitempty"`
+	ParkedAt      *time.Time `json:"parked_at,omitempty" gorm:"comment:set when the subscriber can never take the event; clear it to retry"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+}
+
+func (OutboxDelivery) TableName() string { return "outbox_deliveries" }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of one rate limit key, e.g. a user on a route group
+type RateLimitBucket struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Tokens    float64   `json:"tokens" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;autoUpdateTime:false;comment:when tokens was last refilled"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index;comment:when the bucket is full again and the row can be deleted"`
+}
+
+func (RateLimitBucket) TableName() string { return "rate_limit_buckets" }
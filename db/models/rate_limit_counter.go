@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RateLimitCounter is the failure counter of one rate limit key, e.g. a username at login
+type RateLimitCounter struct {
+	Key           string     `json:"key" gorm:"primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	BlockedUntil  *time.Time `json:"blocked_until,omitempty"`
+	Locked        bool       `json:"locked" gorm:"not null;default:false;comment:blocked by a lockout rather than a backoff"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null;index;comment:when the row can be deleted"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (RateLimitCounter) TableName() string { return "rate_limit_counters" }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scheduled transfer statuses. Only active ones are run. Completed ones have passed their
+// end date, and failed ones hit an error that retrying cannot fix, such as a missing account.
+const (
+	ScheduledTransferStatusActive    = "active"
+	ScheduledTransferStatusPaused    = "paused"
+	ScheduledTransferStatusCompleted = "completed"
+	ScheduledTransferStatusFailed    = "failed"
+	ScheduledTransferStatusCancelled = "cancelled"
+)
+
+// ScheduledTransfer is a standing order, paid once or on a cron schedule
+type ScheduledTransfer struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID        uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	FromAccountID uuid.UUID `json:"from_account_id" gorm:"type:uuid;not null;index"`
+	ToAccountID   uuid.UUID `json:"to_account_id" gorm:"type:uuid;not null"`
+	Amount        int64     `json:"amount" gorm:"not null;comment:must be positive, minor units of currency"`
+	Currency      string    `json:"currency" gorm:"type:varchar(3);not null"`
+	Schedule      string    `json:"schedule" gorm:"not null;default:'';comment:five-field cron expression, empty for a one-off transfer"`
+	Timezone      string    `json:"timezone" gorm:"not null;default:UTC;comment:IANA zone the schedule is evaluated in"`
+	Status        string    `json:"status" gorm:"not null;default:active;index"`
+	// NextOccurrenceAt is the scheduled time of the next payment, and NextRunAt when the worker
+	// picks it up; they differ while a failed payment is being retried
+	NextOccurrenceAt *time.Time `json:"next_occurrence_at"`
+	NextRunAt        *time.Time `json:"next_run_at" gorm:"index"`
+	EndAt            *time.Time `json:"end_at" gorm:"comment:no payment is scheduled after this"`
+	Attempts         int        `json:"attempts" gorm:"not null;default:0;comment:failed attempts at the next occurrence"`
+	LastRunAt        *time.Time `json:"last_run_at"`
+	LastError        string     `json:"last_error" gorm:"not null;default:''"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt        time.Time  `json:"updated_at" gorm:"not null;autoUpdateTime"`
+}
+
+func (ScheduledTransfer) TableName() string { return "scheduled_transfers" }
+
+// Scheduled transfer run outcomes. A skipped run gave up on its occurrence after the last retry.
+const (
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+	ScheduledRunSkipped   = "skipped"
+)
+
+// ScheduledTransferRun records one attempt at paying an occurrence of a scheduled transfer
+type ScheduledTransferRun struct {
+	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ScheduledTransferID uuid.UUID  `json:"scheduled_transfer_id" gorm:"type:uuid;not null;index"`
+	OccurrenceAt        time.Time  `json:"occurrence_at" gorm:"not null;comment:the scheduled time this run pays for"`
+	Attempt             int        `json:"attempt" gorm:"not null"`
+	Status              string     `json:"status" gorm:"not null"`
+	TransferID          *uuid.UUID `json:"transfer_id,omitempty" gorm:"type:uuid"`
+	Error               string     `json:"error,omitempty" gorm:"not null;default:''"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+}
+
+func (ScheduledTransferRun) TableName() string { return "scheduled_transfer_runs" }
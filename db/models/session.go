@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one refresh token of a login. Rotating a refresh token creates a new Session
+// in the same family; replaying a rotated token revokes the whole family.
+type Session struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	FamilyID      uuid.UUID  `json:"family_id" gorm:"type:uuid;not null;index"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash     string     `json:"-" gorm:"not null;uniqueIndex;comment:sha256 of the refresh token"`
+	AccessTokenID string     `json:"-" gorm:"not null;index;comment:jti of the access token issued with this refresh token"`
+	UserAgent     string     `json:"user_agent"`
+	ClientIP      string     `json:"client_ip"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID  *uuid.UUID `json:"replaced_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+}
+
+func (Session) TableName() string { return "sessions" }
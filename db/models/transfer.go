@@ -6,14 +6,29 @@ import (
 	"github.com/google/uuid"
 )
 
+// Transfer statuses. A transfer is reversed once reversals have returned all of it.
+const (
+	TransferStatusCompleted         = "completed"
+	TransferStatusPartiallyReversed = "partially_reversed"
+	TransferStatusReversed          = "reversed"
+)
+
 type Transfer struct {
-	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
-	FromAccountID uuid.UUID `gorm:"type:uuid;index;not null" json:"from_account_id"`
-	ToAccountID   uuid.UUID `gorm:"type:uuid;index;not null" json:"to_account_id"`
-	Amount        int64     `gorm:"not null;comment:must be positive" json:"amount"`
-	CreatedAt     time.Time `gorm:"not null;autoCreateTime" json:"created_at"`
-	FromAccount   *Account  `gorm:"foreignKey:FromAccountID" json:"from_account,omitempty"`
-	ToAccount     *Account  `gorm:"foreignKey:ToAccountID" json:"to_account,omitempty"`
+	ID                 uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	FromAccountID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"from_account_id"`
+	ToAccountID        uuid.UUID  `gorm:"type:uuid;index;not null" json:"to_account_id"`
+	Amount             int64      `gorm:"not null;comment:must be positive, minor units of from_currency" json:"amount"`
+	FromCurrency       string     `gorm:"type:varchar(3)" json:"from_currency"`
+	ToAmount           int64      `gorm:"not null;default:0;comment:minor units of to_currency" json:"to_amount"`
+	ToCurrency         string     `gorm:"type:varchar(3)" json:"to_currency"`
+	ExchangeRate       string     `gorm:"type:numeric(24,10);not null;default:1" json:"exchange_rate"`
+	QuoteID            *uuid.UUID `gorm:"type:uuid" json:"quote_id,omitempty"`
+	Status             string     `gorm:"type:varchar(32);not null;default:completed;index" json:"status"`
+	OriginalTransferID *uuid.UUID `gorm:"type:uuid;index;comment:set on a reversal, the transfer it returns money from" json:"original_transfer_id,omitempty"`
+	RefundedAmount     int64      `gorm:"not null;default:0;comment:minor units of to_currency returned by reversals" json:"refunded_amount"`
+	CreatedAt          time.Time  `gorm:"not null;autoCreateTime" json:"created_at"`
+	FromAccount        *Account   `gorm:"foreignKey:FromAccountID" json:"from_account,omitempty"`
+	ToAccount          *Account   `gorm:"foreignKey:ToAccountID" json:"to_account,omitempty"`
 }
 
 func (Transfer) TableName() string { return "transfers" }
@@ -6,12 +6,24 @@ import (
 	"github.com/google/uuid"
 )
 
+// User roles, carried in the access token
+const (
+	RoleCustomer = "customer"
+	RoleTeller   = "teller"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
-	ID        uuid.UUID `json:"id,omitempty" gorm:"type:uuid; default:uuid_generate_v4()"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	FullName  string    `json:"full_name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID              uuid.UUID  `json:"id,omitempty" gorm:"type:uuid; default:uuid_generate_v4()"`
+	Username        string     `json:"username" gorm:"unique;not null"`
+	Password        string     `json:"-" gorm:"not null"`
+	FullName        string     `json:"full_name" gorm:"not null"`
+	Email           string     `json:"email" gorm:"unique;not null"`
+	Role            string     `json:"role" gorm:"not null;default:customer"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" gorm:"comment:cleared whenever the email changes"`
+	TOTPSecret      string     `json:"-" gorm:"column:totp_secret;comment:base32 secret, pending until totp_enabled_at is set"`
+	TOTPEnabledAt   *time.Time `json:"totp_enabled_at,omitempty" gorm:"column:totp_enabled_at"`
+	TOTPLastStep    int64      `json:"-" gorm:"column:totp_last_step;not null;default:0;comment:last accepted time step, codes are single-use"`
+	UpdatedAt       time.Time  `json:"updated_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at,omitempty"`
 }
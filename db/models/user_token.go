@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserToken purposes
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+)
+
+// UserToken is a single-use token mailed to a user, or handed out at login while the second
+// factor is pending. Only its hash is stored.
+type UserToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex;comment:sha256 of the token"`
+	Email     string     `json:"email" gorm:"not null;comment:address the token was sent to"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	Attempts  int        `json:"attempts" gorm:"not null;default:0;comment:failed redemptions"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null;autoCreateTime"`
+}
+
+func (UserToken) TableName() string { return "user_tokens" }
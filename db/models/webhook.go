@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookEndpoint is a URL of a user that is notified of events on their accounts
+type WebhookEndpoint struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	URL         string    `json:"url" gorm:"type:varchar(2048);not null"`
+	Secret      string    `json:"-" gorm:"not null;comment:HMAC-SHA256 key of the X-Signature header"`
+	EventTypes  string    `json:"event_types" gorm:"not null;comment:comma-separated, e.g. transfer.received,transfer.sent"`
+	Description string    `json:"description" gorm:"not null;default:''"`
+	CreatedAt   time.Time `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"not null;autoUpdateTime"`
+}
+
+func (WebhookEndpoint) TableName() string { return "webhook_endpoints" }
+
+// Webhook delivery statuses. A pending delivery is retried with exponential backoff until it
+// succeeds or runs out of attempts and becomes dead, where it stays until it is retried by hand.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event to send to one endpoint, and the log of the attempts to send it
+type WebhookDelivery struct {
+	ID             uuid.UUID        `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	EndpointID     uuid.UUID        `json:"endpoint_id" gorm:"type:uuid;not null;uniqueIndex:idx_webhook_deliveries_event,priority:1"`
+	EventID        uuid.UUID        `json:"event_id" gorm:"type:uuid;not null;uniqueIndex:idx_webhook_deliveries_event,priority:2;comment:outbox event the delivery was made for"`
+	EventType      string           `json:"event_type" gorm:"type:varchar(64);not null;uniqueIndex:idx_webhook_deliveries_event,priority:3"`
+	Payload        string           `json:"payload" gorm:"type:text;not null;comment:request body, signed as sent"`
+	Status         string           `json:"status" gorm:"type:varchar(16);not null;default:pending;index"`
+	Attempts       int              `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty" gorm:"index"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty" gorm:"not null;default:''"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time        `json:"created_at" gorm:"not null;autoCreateTime"`
+	UpdatedAt      time.Time        `json:"updated_at" gorm:"not null;autoUpdateTime"`
+	Endpoint       *WebhookEndpoint `json:"-" gorm:"foreignKey:EndpointID;constraint:OnDelete:CASCADE"`
+}
+
+func (WebhookDelivery) TableName() string { return "webhook_deliveries" }
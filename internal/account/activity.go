@@ -0,0 +1,122 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/gin-contrib/sse"
+	"github.com/google/uuid"
+)
+
+// Activity event types of the account stream. Transfers are named from the account's side.
+const (
+	ActivityBalanceChanged   = events.BalanceChanged
+	ActivityTransferSent     = "transfer.sent"
+	ActivityTransferReceived = "transfer.received"
+)
+
+const (
+	// activityBatch caps the events read from the outbox at once
+	activityBatch = 100
+	// activityKeepAlive is how often an idle stream sends a comment, so proxies keep it open.
+	// The stream also reads the outbox then, which catches changes made by other instances.
+	activityKeepAlive = 15 * time.Second
+)
+
+// ErrInvalidEventID is returned for a Last-Event-ID that this stream did not send
+var ErrInvalidEventID = errors.New("invalid Last-Event-ID")
+
+// ActivityEvent is one event of the account stream. Its ID is the outbox sequence number,
+// which orders the events of every account.
+type ActivityEvent struct {
+	ID   int64
+	Type string
+	// BalanceChangedData for balance.changed, the transfer otherwise
+	Data json.RawMessage
+}
+
+// activity returns up to activityBatch balance changes and transfers of accountID recorded
+// after seq, in order
+func (r *Repository) activity(ctx context.Context, accountID uuid.UUID, seq int64) ([]models.OutboxEvent, error) {
+	var rows []models.OutboxEvent
+	err := r.Repository.DB.WithContext(ctx).
+		Where("seq > ?", seq).
+		Where("(type = ? AND aggregate_id = ?) OR (type = ? AND (payload->>'from_account_id' = ? OR payload->>'to_account_id' = ?))",
+			events.BalanceChanged, accountID, events.TransferCompleted, accountID.String(), accountID.String()).
+		Order("seq").
+		Limit(activityBatch).
+		Find(&rows).Error
+	return rows, err
+}
+
+// latestSeq returns the sequence number of the newest outbox event, or 0 when there is none
+func (r *Repository) latestSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.Repository.DB.WithContext(ctx).Model(&models.OutboxEvent{}).Select("COALESCE(MAX(seq), 0)").Scan(&seq).Error
+	return seq, err
+}
+
+// openActivity checks that subject may follow an account and returns it with the position
+// to stream from: after lastEventID when resuming, otherwise after the newest event
+func (s *Service) openActivity(ctx context.Context, accountID string, subject authz.Subject, lastEventID string) (*models.Account, int64, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
+	if err != nil {
+		return nil, 0, err
+	}
+	if lastEventID = strings.TrimSpace(lastEventID); lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			return nil, 0, ErrInvalidEventID
+		}
+		return account, seq, nil
+	}
+	seq, err := s.repo.latestSeq(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return account, seq, nil
+}
+
+// activitySince returns the next events of accountID after seq, in order
+func (s *Service) activitySince(ctx context.Context, accountID uuid.UUID, seq int64) ([]ActivityEvent, error) {
+	rows, err := s.repo.activity(ctx, accountID, seq)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ActivityEvent, 0, len(rows))
+	for _, row := range rows {
+		event := ActivityEvent{ID: row.Seq, Type: row.Type, Data: json.RawMessage(row.Payload)}
+		if row.Type == events.TransferCompleted {
+			var transfer models.Transfer
+			if err := json.Unmarshal(event.Data, &transfer); err != nil {
+				return nil, err
+			}
+			event.Type = ActivityTransferReceived
+			if transfer.FromAccountID == accountID {
+				event.Type = ActivityTransferSent
+			}
+		}
+		list = append(list, event)
+	}
+	return list, nil
+}
+
+// writeActivity encodes events as server-sent events, each with its ID so that a client that
+// reconnects resumes after the last one it received
+func writeActivity(w io.Writer, list []ActivityEvent) error {
+	for _, event := range list {
+		err := sse.Encode(w, sse.Event{Id: strconv.FormatInt(event.ID, 10), Event: event.Type, Data: event.Data})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
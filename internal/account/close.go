@@ -0,0 +1,125 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// close closes an account of userID for good. A remaining balance is first moved to
+// sweepTo with an ordinary transfer; without one the balance must be zero. The sweep and
+// the status change commit together. The account is soft deleted as it closes, so reads
+// that must still find closed accounts use Unscoped.
+func (r *Repository) close(ctx context.Context, accountID, userID uuid.UUID, sweepTo *uuid.UUID, transfers *transfer.Repository) (*model, *models.Transfer, error) {
+	var account model
+	var sweep *models.Transfer
+	ctx, committed := events.Live.AfterCommit(ctx)
+	err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockForClose(tx, accountID, sweepTo, &account); err != nil {
+			return err
+		}
+		if account.IsSystem {
+			return ErrAccountNotFound
+		}
+		if account.UserID != userID {
+			return ErrNotAccountOwner
+		}
+		switch account.Status {
+		case models.AccountStatusClosed:
+			return ErrAccountClosed
+		case models.AccountStatusFrozen:
+			return ErrAccountFrozen
+		}
+		if account.HeldBalance != 0 {
+			return ErrActiveHolds
+		}
+		if account.Balance != 0 {
+			if sweepTo == nil {
+				return ErrBalanceNotZero
+			}
+			result, err := transfers.WithTx(tx).TransferTx(ctx, transfer.TransferTxParams{
+				UserID:        userID.String(),
+				FromAccountID: accountID.String(),
+				ToAccountID:   sweepTo.String(),
+				Amount:        money.Money{Amount: account.Balance, Currency: account.Currency},
+			})
+			if err != nil {
+				return err
+			}
+			sweep = &result.Transfer
+			account.Balance = result.FromAccount.Balance
+		}
+		now := time.Now()
+		account.Status = models.AccountStatusClosed
+		account.ClosedAt = &now
+		account.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+		return tx.Model(&model{}).Where("id = ?", account.ID).Updates(map[string]interface{}{
+			"status":     account.Status,
+			"closed_at":  account.ClosedAt,
+			"deleted_at": account.DeletedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	committed()
+	return &account, sweep, nil
+}
+
+// lockForClose locks the account being closed. With a sweep target it locks both accounts
+// in the order the sweep transfer does, so that closing cannot deadlock against a transfer
+// between the same two accounts.
+func lockForClose(tx *gorm.DB, accountID uuid.UUID, sweepTo *uuid.UUID, account *model) error {
+	var err error
+	if sweepTo != nil && *sweepTo != accountID {
+		var target model
+		err = transfer.LockAccounts(tx, accountID, *sweepTo, account, &target)
+	} else {
+		err = tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(account).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccountNotFound
+	}
+	return err
+}
+
+// closeAccount closes an account owned by subject, sweeping what is left of its balance
+// to req.SweepToAccountID when given
+func (s *Service) closeAccount(ctx context.Context, accountID string, req CloseAccountRequest, subject authz.Subject) (*CloseAccountResponse, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
+	if err != nil {
+		return nil, err
+	}
+	var sweepTo *uuid.UUID
+	if req.SweepToAccountID != "" {
+		id, err := uuid.Parse(req.SweepToAccountID)
+		if err != nil {
+			return nil, errors.New("invalid sweep_to_account_id format")
+		}
+		sweepTo = &id
+	}
+	closed, sweep, err := s.repo.close(ctx, account.ID, subject.UserID, sweepTo, s.transfers)
+	if err != nil {
+		return nil, err
+	}
+	resp := &CloseAccountResponse{
+		ID:          closed.ID.String(),
+		Status:      closed.Status,
+		SweptAmount: money.Money{Currency: closed.Currency},
+		ClosedAt:    closed.ClosedAt.Format(time.RFC3339),
+	}
+	if sweep != nil {
+		resp.SweptAmount.Amount = sweep.Amount
+		resp.SweepTransferID = sweep.ID.String()
+	}
+	return resp, nil
+}
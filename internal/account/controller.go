@@ -1,11 +1,21 @@
 package account
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,24 +29,20 @@ type Controller struct {
 // @param    id    path  string  true  "uuid of item"
 // @Router   /api/v1/account/{id} [get]
 func (c *Controller) findOne(ctx *gin.Context) {
-	var api crud.GetAllRequest
 	var item common.ById
-	if err := ctx.ShouldBindQuery(&api); err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
-		return
-	}
 	if err := ctx.ShouldBindUri(&item); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
 
-	api.Filter = append(api.Filter, fmt.Sprintf("id||eq||%s", item.ID))
-
-	var result model
-
-	err := c.service.FindOne(api, &result)
+	result, err := c.service.findVisible(ctx, item.ID, subject)
 	if err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
 	ctx.JSON(200, result)
@@ -70,6 +76,8 @@ func (c *Controller) create(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	audit.SetResourceID(ctx, resp.ID)
+	audit.SetChanges(ctx, nil, resp)
 	ctx.JSON(http.StatusCreated, gin.H{"data": resp})
 }
 
@@ -84,73 +92,313 @@ func (c *Controller) create(ctx *gin.Context) {
 // @Router   /api/v1/account/{id}/balance [get]
 func (c *Controller) getAccountBalance(ctx *gin.Context) {
 	accountID := ctx.Param("id")
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id not found in context"})
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
-	userIDStr, ok := userID.(string)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id in context is not a string"})
+	resp, err := c.service.getAccountBalance(ctx, accountID, subject)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
-	resp, err := c.service.getAccountBalance(accountID, userIDStr)
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary  Stream account activity
+// @Description  Streams balance changes and incoming and outgoing transfers of an account as server-sent events:
+// @Description  balance.changed, transfer.sent and transfer.received. Each event has an id; a client that
+// @Description  reconnects with it in the Last-Event-ID header receives the events it missed. Without one the
+// @Description  stream starts with the next event.
+// @Tags     account
+// @Security JWT
+// @Produce  text/event-stream
+// @Param    id             path    string  true   "Account ID"
+// @Param    Last-Event-ID  header  string  false  "id of the last event received"
+// @Success  200
+// @Failure  400  {object}  map[string]string
+// @Failure  404  {object}  map[string]string
+// @Router   /api/v1/account/{id}/events [get]
+func (c *Controller) streamEvents(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "account not found or not owned by user"})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, resp)
+	account, seq, err := c.service.openActivity(ctx, ctx.Param("id"), subject, ctx.GetHeader("Last-Event-ID"))
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Subscribe before the first read, so no change is missed in between
+	changed, stop := events.Live.Subscribe(account.ID)
+	defer stop()
+	keepAlive := time.NewTicker(activityKeepAlive)
+	defer keepAlive.Stop()
+
+	ctx.Header("Content-Type", sse.ContentType)
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Keep nginx from buffering the stream
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	for {
+		// Send everything after seq; a full batch means there may be more
+		for {
+			list, err := c.service.activitySince(ctx, account.ID, seq)
+			if err != nil {
+				return
+			}
+			if err := writeActivity(ctx.Writer, list); err != nil {
+				return
+			}
+			if len(list) > 0 {
+				seq = list[len(list)-1].ID
+			}
+			if len(list) < activityBatch {
+				break
+			}
+		}
+		ctx.Writer.Flush()
+
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-changed:
+		case <-keepAlive.C:
+			if _, err := ctx.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
 }
 
-// UpdateBalance godoc
-// @Summary Update account balance
-// @Description Updates the balance of a specific account by a given amount
+// Deposit godoc
+// @Summary Deposit money into an account
+// @Description Pays money from outside the bank into an account, posted against the system cash account with
+// @Description the caller's reference. Only tellers and admins can deposit, unless SIMULATED_FUNDING lets
+// @Description customers fund their own accounts.
 // @Tags account
 // @Security JWT
 // @Param id path string true "Account ID"
-// @Param request body UpdateAccountBalanceRequest true "Balance update payload"
-// @Success 200 {object} model
+// @Param request body CashOperationRequest true "Deposit payload"
+// @Success 201 {object} CashOperationResponse
 // @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /api/v1/account/{id}/balance [patch]
-func (c *Controller) updateBalance(ctx *gin.Context) {
-	accountID := ctx.Param("id")
-	var req UpdateAccountBalanceRequest
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/account/{id}/deposits [post]
+func (c *Controller) deposit(ctx *gin.Context) {
+	c.cashOperation(ctx, c.service.deposit)
+}
+
+// Withdraw godoc
+// @Summary Withdraw money from an account
+// @Description Pays money out of an account of the caller, posted against the system cash account with the
+// @Description caller's reference. Tellers and admins can withdraw from any account. The available balance,
+// @Description which excludes held amounts, must cover the withdrawal.
+// @Tags account
+// @Security JWT
+// @Param id path string true "Account ID"
+// @Param request body CashOperationRequest true "Withdrawal payload"
+// @Success 201 {object} CashOperationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /api/v1/account/{id}/withdrawals [post]
+func (c *Controller) withdraw(ctx *gin.Context) {
+	c.cashOperation(ctx, c.service.withdraw)
+}
+
+func (c *Controller) cashOperation(ctx *gin.Context, operate func(context.Context, string, CashOperationRequest, authz.Subject) (*CashOperationResponse, error)) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var req CashOperationRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id not found in context"})
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
-	userIDStr, ok := userID.(string)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id in context is not a string"})
+	audit.SetResourceID(ctx, item.ID)
+	audit.SetDetails(ctx, gin.H{"amount": req.Amount, "reference": req.Reference})
+
+	resp, err := operate(ctx, item.ID, req, subject)
+	if err != nil {
+		ctx.JSON(cashErrorStatus(err), gin.H{"message": err.Error()})
 		return
 	}
-	// Optionally, check ownership here if needed
-	if !c.service.isAccountOwnedByUser(accountID, userIDStr) {
-		ctx.JSON(http.StatusForbidden, gin.H{"message": "account does not belong to user"})
+	// The account was locked for the operation, so the balance before it is exact
+	before := resp.Balance.Amount - req.Amount.Amount
+	if resp.Kind == ledger.KindWithdrawal {
+		before = resp.Balance.Amount + req.Amount.Amount
+	}
+	audit.SetChanges(ctx,
+		gin.H{"balance": money.Money{Amount: before, Currency: resp.Balance.Currency}},
+		gin.H{"balance": resp.Balance, "journal_id": resp.JournalID})
+	ctx.JSON(http.StatusCreated, gin.H{"data": resp})
+}
+
+// cashErrorStatus maps the errors of deposits and withdrawals to HTTP status codes
+func cashErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrDepositForbidden), errors.Is(err, ErrNotAccountOwner):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAccountClosed), errors.Is(err, ErrAccountFrozen):
+		return http.StatusConflict
+	case errors.Is(err, ErrInsufficientFunds):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrInvalidAmount), errors.Is(err, ErrCurrencyMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CloseAccount godoc
+// @Summary Close an account
+// @Description Closes an account of the caller for good; it can no longer send or receive money, but its
+// @Description statement and transfers stay available. A remaining balance is moved to sweep_to_account_id
+// @Description with an ordinary transfer, converted if the currencies differ; without one the balance must be zero.
+// @Description Accounts with active holds or a freeze cannot be closed.
+// @Tags account
+// @Security JWT
+// @Param id path string true "Account ID"
+// @Param request body CloseAccountRequest false "Account that receives the remaining balance"
+// @Success 200 {object} CloseAccountResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/account/{id}/close [post]
+func (c *Controller) closeAccount(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	// Update the account balance
-	if req.Amount == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "amount must be non-zero"})
+	var req CloseAccountRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
-	if req.Amount < 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "amount must be positive"})
+	audit.SetDetails(ctx, gin.H{"sweep_to_account_id": req.SweepToAccountID})
+
+	resp, err := c.service.closeAccount(ctx, item.ID, req, subject)
+	if err != nil {
+		ctx.JSON(closeErrorStatus(err), gin.H{"message": err.Error()})
 		return
 	}
-	account, err := c.service.updateBalance(ctx, accountID, req.Amount)
+	audit.SetChanges(ctx, nil, resp)
+	ctx.JSON(http.StatusOK, gin.H{"data": resp})
+}
+
+// closeErrorStatus maps the errors of closing an account, and of its sweep, to HTTP status codes
+func closeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotAccountOwner):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, transfer.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAccountClosed), errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrActiveHolds),
+		errors.Is(err, ErrBalanceNotZero), errors.Is(err, transfer.ErrAccountClosed), errors.Is(err, transfer.ErrAccountFrozen):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// GetStatement godoc
+// @Summary  Get account statement
+// @Description  Returns the opening balance, every entry in the window with a running balance, and the closing balance.
+// @Description  Use format=csv for a CSV download or format=ofx / format=qfx for personal finance tools.
+// @Tags     account
+// @Security JWT
+// @Produce  json
+// @Produce  text/csv
+// @Produce  application/x-ofx
+// @Param    id      path   string  true   "Account ID"
+// @Param    from    query  string  false  "Start date (2006-01-02) or RFC 3339 time; defaults to 30 days before to"
+// @Param    to      query  string  false  "End date (inclusive) or RFC 3339 time (exclusive); defaults to now"
+// @Param    format  query  string  false  "json (default), csv, ofx or qfx"
+// @Success  200  {object}  StatementResponse
+// @Failure  400  {object}  map[string]string
+// @Failure  404  {object}  map[string]string
+// @Router   /api/v1/account/{id}/statement [get]
+func (c *Controller) getStatement(ctx *gin.Context) {
+	accountID := ctx.Param("id")
+	var req StatementRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	now := time.Now()
+	from, to, err := parseStatementWindow(req.From, req.To, now)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{"data": account})
+	statement, err := c.service.getStatement(ctx, accountID, subject, from, to)
+	if errors.Is(err, ErrAccountNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	filename := fmt.Sprintf("statement-%s-%s", accountID, from.Format(statementDateLayout))
+	switch req.Format {
+	case "csv":
+		err = writeStatementCSV(&buf, statement)
+		filename += ".csv"
+	case "ofx", "qfx":
+		err = writeStatementOFX(&buf, statement, now)
+		filename += "." + req.Format
+	default:
+		ctx.JSON(http.StatusOK, statement)
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	if req.Format != "csv" {
+		contentType = "application/x-ofx; charset=utf-8"
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
 }
 
 func NewController(service *Service) *Controller {
@@ -1,16 +1,15 @@
 package account
 
-// CreateAccountRequest represents the payload for creating a new account.
+import "github.com/ahmedkhaeld/banking-app/internal/money"
+
+// CreateAccountRequest represents the payload for creating a new account. Accounts open at
+// zero and are funded with a deposit.
 // swagger:model CreateAccountRequest
 type CreateAccountRequest struct {
 	// Currency of the account. Allowed values: USD, EUR, GBP, JPY, EGP, CAD, AUD.
 	// Required: true
 	// Example: USD
 	Currency string `json:"currency" binding:"required,oneof=USD EUR GBP JPY EGP CAD AUD"`
-
-	// Initial balance of the account.
-	// Example: 1000
-	Balance *int64 `json:"balance,omitempty"`
 }
 
 type CreateAccountResponse struct {
@@ -27,8 +26,11 @@ type CreateAccountResponse struct {
 	// Example: USD
 	Currency string `json:"currency"`
 	// Balance of the account.
-	// Example: 1000
-	Balance int64 `json:"balance"`
+	// Example: {"amount": "10.00", "currency": "USD"}
+	Balance money.Money `json:"balance"`
+	// AvailableBalance is the balance less the amounts held for authorized transfers.
+	// Example: {"amount": "10.00", "currency": "USD"}
+	AvailableBalance money.Money `json:"available_balance"`
 	// CreatedAt is the timestamp when the account was created.
 	// Example: "2023-10-01T12:00:00Z"
 	CreatedAt string `json:"created_at"`
@@ -38,13 +40,118 @@ type AccountBalanceResponse struct {
 	// ID of the account.
 	ID string `json:"id"`
 	// Balance of the account.
-	Balance int64 `json:"balance"`
+	Balance money.Money `json:"balance"`
+	// AvailableBalance is the balance less the amounts held for authorized transfers; it is what can be spent.
+	AvailableBalance money.Money `json:"available_balance"`
 	// Currency of the account.
 	Currency string `json:"currency"`
 }
 
-// UpdateAccountBalanceRequest represents the payload for updating balance
-// swagger:model UpdateAccountBalanceRequest
-type UpdateAccountBalanceRequest struct {
-	Amount int64 `json:"amount" binding:"required"`
+// CashOperationRequest represents the payload of a deposit or withdrawal.
+// swagger:model CashOperationRequest
+type CashOperationRequest struct {
+	// Amount to deposit or withdraw, in the account's currency.
+	// Required: true
+	// Example: {"amount": "5.25", "currency": "USD"}
+	Amount money.Money `json:"amount" binding:"required"`
+	// Reference of the operation at the funding source, e.g. a cash receipt or wire number.
+	// Required: true
+	// Example: "RCPT-2024-0042"
+	Reference string `json:"reference" binding:"required,max=64"`
+	// Description shown on the statement.
+	// Example: "Cash deposit at branch"
+	Description string `json:"description" binding:"max=255"`
+}
+
+type CashOperationResponse struct {
+	// JournalID of the journal that posted the operation.
+	JournalID string `json:"journal_id"`
+	// AccountID of the account.
+	AccountID string `json:"account_id"`
+	// Kind of operation, deposit or withdrawal.
+	Kind string `json:"kind"`
+	// Amount deposited or withdrawn.
+	// Example: {"amount": "5.25", "currency": "USD"}
+	Amount money.Money `json:"amount"`
+	// Reference of the operation.
+	Reference string `json:"reference"`
+	// Description of the operation.
+	Description string `json:"description,omitempty"`
+	// Balance of the account after the operation.
+	Balance money.Money `json:"balance"`
+	// AvailableBalance of the account after the operation.
+	AvailableBalance money.Money `json:"available_balance"`
+	// CreatedAt is the timestamp when the operation was posted.
+	// Example: "2023-10-01T12:00:00Z"
+	CreatedAt string `json:"created_at"`
+}
+
+// StatementRequest represents the query parameters of an account statement.
+// swagger:model StatementRequest
+type StatementRequest struct {
+	// Start of the window, as a date (2006-01-02) or RFC 3339 timestamp. Defaults to 30 days before `to`.
+	From string `form:"from"`
+	// End of the window; a date includes the whole day. Defaults to now.
+	To string `form:"to"`
+	// Output format. Allowed values: json, csv, ofx, qfx.
+	Format string `form:"format" binding:"omitempty,oneof=json csv ofx qfx"`
+}
+
+type StatementLine struct {
+	// ID of the entry.
+	EntryID string `json:"entry_id"`
+	// Date the entry was posted.
+	Date string `json:"date"`
+	// Kind of journal that posted the entry, e.g. transfer or deposit.
+	Kind string `json:"kind"`
+	// Reference of a deposit or withdrawal.
+	Reference string `json:"reference,omitempty"`
+	// Description of the journal.
+	Description string `json:"description,omitempty"`
+	// TransferID is set for entries posted by a transfer.
+	TransferID string `json:"transfer_id,omitempty"`
+	// Amount of the entry; negative for debits.
+	Amount money.Money `json:"amount"`
+	// Balance after the entry.
+	Balance money.Money `json:"balance"`
+}
+
+type StatementResponse struct {
+	// ID of the account.
+	AccountID string `json:"account_id"`
+	// Currency of the account.
+	Currency string `json:"currency"`
+	// Start of the window (inclusive).
+	From string `json:"from"`
+	// End of the window (exclusive).
+	To string `json:"to"`
+	// Balance at the start of the window.
+	OpeningBalance money.Money `json:"opening_balance"`
+	// Balance at the end of the window.
+	ClosingBalance money.Money `json:"closing_balance"`
+	// Entries in the window with their running balance.
+	Lines []StatementLine `json:"lines"`
+}
+
+// CloseAccountRequest represents the payload for closing an account.
+// swagger:model CloseAccountRequest
+type CloseAccountRequest struct {
+	// Account that receives the remaining balance; required unless the balance is zero.
+	// Example: "123e4567-e89b-12d3-a456-426614174002"
+	SweepToAccountID string `json:"sweep_to_account_id,omitempty"`
+}
+
+type CloseAccountResponse struct {
+	// ID of the closed account.
+	ID string `json:"id"`
+	// Status of the account, always closed.
+	Status string `json:"status"`
+	// SweptAmount moved to the sweep account; zero when the balance was already zero.
+	// Example: {"amount": "10.00", "currency": "USD"}
+	SweptAmount money.Money `json:"swept_amount"`
+	// SweepTransferID of the transfer that moved the remaining balance.
+	SweepTransferID string `json:"sweep_transfer_id,omitempty"`
+	// ClosedAt is the timestamp when the account was closed.
+	// Example: "2023-10-01T12:00:00Z"
+	ClosedAt string `json:"closed_at"`
 }
@@ -0,0 +1,123 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// simulatedFunding reports whether customers may deposit into their own accounts, standing
+// in for an external funding source such as a card or bank wire
+func simulatedFunding() bool {
+	return os.Getenv(common.SimulatedFunding) == "true"
+}
+
+// cashOperation posts a deposit or withdrawal of req.Amount against the system cash account.
+// The account is locked first, so the balance it returns is the one the journal produced.
+func (r *Repository) cashOperation(ctx context.Context, accountID uuid.UUID, kind string, req CashOperationRequest) (*model, *models.Journal, error) {
+	if !req.Amount.IsPositive() {
+		return nil, nil, ErrInvalidAmount
+	}
+	var account model
+	var journal *models.Journal
+	err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_system = ?", accountID, false).
+			First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		switch account.Status {
+		case models.AccountStatusClosed:
+			return ErrAccountClosed
+		case models.AccountStatusFrozen:
+			return ErrAccountFrozen
+		}
+		if req.Amount.Currency != account.Currency {
+			return fmt.Errorf("%w: %s", ErrCurrencyMismatch, req.Amount.Currency)
+		}
+		amount := req.Amount
+		if kind == ledger.KindWithdrawal {
+			// Held money is still in the balance, so it is the available balance that must cover it
+			if account.AvailableBalance() < amount.Amount {
+				return ErrInsufficientFunds
+			}
+			if amount, err = amount.Neg(); err != nil {
+				return err
+			}
+		}
+		journal, err = postCash(tx, account.ID, amount, ledger.JournalParams{
+			Kind:        kind,
+			Reference:   req.Reference,
+			Description: req.Description,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", account.ID).First(&account).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	events.Live.Notify(account.ID)
+	return &account, journal, nil
+}
+
+// deposit pays money from outside the bank into an account. Only staff may deposit, unless
+// SIMULATED_FUNDING lets customers fund their own accounts.
+func (s *Service) deposit(ctx context.Context, accountID string, req CashOperationRequest, subject authz.Subject) (*CashOperationResponse, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
+	if err != nil {
+		return nil, err
+	}
+	if !subject.IsStaff() && !(simulatedFunding() && account.UserID == subject.UserID) {
+		return nil, ErrDepositForbidden
+	}
+	return s.cashOperation(ctx, account.ID, ledger.KindDeposit, req)
+}
+
+// withdraw pays money out of an account of subject, or of any account when subject is staff.
+// The available balance must cover the amount.
+func (s *Service) withdraw(ctx context.Context, accountID string, req CashOperationRequest, subject authz.Subject) (*CashOperationResponse, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
+	if err != nil {
+		return nil, err
+	}
+	if !subject.IsStaff() && account.UserID != subject.UserID {
+		return nil, ErrNotAccountOwner
+	}
+	return s.cashOperation(ctx, account.ID, ledger.KindWithdrawal, req)
+}
+
+func (s *Service) cashOperation(ctx context.Context, accountID uuid.UUID, kind string, req CashOperationRequest) (*CashOperationResponse, error) {
+	account, journal, err := s.repo.cashOperation(ctx, accountID, kind, req)
+	if err != nil {
+		return nil, err
+	}
+	return &CashOperationResponse{
+		JournalID:        journal.ID.String(),
+		AccountID:        account.ID.String(),
+		Kind:             journal.Kind,
+		Amount:           req.Amount,
+		Reference:        journal.Reference,
+		Description:      journal.Description,
+		Balance:          money.Money{Amount: account.Balance, Currency: account.Currency},
+		AvailableBalance: money.Money{Amount: account.AvailableBalance(), Currency: account.Currency},
+		CreatedAt:        journal.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
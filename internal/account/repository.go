@@ -2,10 +2,14 @@ package account
 
 import (
 	"context"
+	"time"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -25,19 +29,65 @@ func InitRepository() *Repository {
 	}
 }
 
-// UpdateBalance updates the balance of an account by a given amount and returns the updated account
-func (r *Repository) updateBalance(ctx context.Context, accountID string, amount int64) (*model, error) {
-	id, err := uuid.Parse(accountID)
+// create inserts a new account with a zero balance. Its AccountCreated event commits with it.
+func (r *Repository) create(account *model) error {
+	return r.Repository.DB.Transaction(func(tx *gorm.DB) error {
+		account.Balance = 0
+		if err := tx.Create(account).Error; err != nil {
+			return err
+		}
+		return events.Record(tx, events.AccountCreated, events.AggregateAccount, account.ID, account)
+	})
+}
+
+// postCash posts a journal moving amount from the system cash account into the account, or
+// out of it to the cash account when amount is negative. Kind, Reference and Description are
+// taken from params.
+func postCash(tx *gorm.DB, accountID uuid.UUID, amount money.Money, params ledger.JournalParams) (*models.Journal, error) {
+	cashID, err := ledger.SystemAccount(tx, ledger.SystemCash, amount.Currency)
 	if err != nil {
 		return nil, err
 	}
-	db := r.Repository.DB.WithContext(ctx)
-	if err := db.Model(&model{}).Where("id = ?", id).UpdateColumn("balance", gorm.Expr("balance + ?", amount)).Error; err != nil {
+	counter, err := amount.Neg()
+	if err != nil {
 		return nil, err
 	}
-	var account model
-	if err := db.Where("id = ?", id).First(&account).Error; err != nil {
-		return nil, err
+	params.Postings = []ledger.Posting{
+		{AccountID: cashID, Amount: counter},
+		{AccountID: accountID, Amount: amount},
 	}
-	return &account, nil
+	return ledger.Post(tx, params)
+}
+
+// statementRow is an entry of an account joined with the journal that posted it
+type statementRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Amount      int64
+	TransferID  *uuid.UUID
+	Kind        string
+	Reference   string
+	Description string
+}
+
+// sumEntriesBefore returns the balance of an account as recorded by its entries before t
+func (r *Repository) sumEntriesBefore(ctx context.Context, accountID uuid.UUID, t time.Time) (int64, error) {
+	var total int64
+	err := r.Repository.DB.WithContext(ctx).Model(&models.Entry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND created_at < ?", accountID, t).
+		Scan(&total).Error
+	return total, err
+}
+
+// statementEntries returns the entries of an account in [from, to) in posting order
+func (r *Repository) statementEntries(ctx context.Context, accountID uuid.UUID, from, to time.Time) ([]statementRow, error) {
+	var rows []statementRow
+	err := r.Repository.DB.WithContext(ctx).Model(&models.Entry{}).
+		Select("entries.id, entries.created_at, entries.amount, entries.transfer_id, COALESCE(journals.kind, '') AS kind, COALESCE(journals.reference, '') AS reference, COALESCE(journals.description, '') AS description").
+		Joins("LEFT JOIN journals ON journals.id = entries.journal_id").
+		Where("entries.account_id = ? AND entries.created_at >= ? AND entries.created_at < ?", accountID, from, to).
+		Order("entries.created_at, entries.id").
+		Scan(&rows).Error
+	return rows, err
 }
@@ -1,7 +1,9 @@
 package account
 
 import (
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/idempotency"
 	"github.com/gin-gonic/gin"
 )
 
@@ -9,12 +11,15 @@ func RegisterRoutes(routerGroup *gin.RouterGroup) {
 	service := InitService()
 	controller := NewController(service)
 
-	//Admin route
-	// routerGroup.GET("", controller.findAll)
+	// Listing all accounts is part of the admin API, see internal/admin
 
 	routerGroup.GET(":id", auth.UserMiddleware(), controller.findOne)
-	routerGroup.POST("", auth.UserMiddleware(), controller.create)
+	routerGroup.POST("", auth.UserMiddleware(), audit.Action("account.create", "account"), controller.create)
 	routerGroup.GET(":id/balance", auth.UserMiddleware(), controller.getAccountBalance)
+	routerGroup.GET(":id/statement", auth.UserMiddleware(), controller.getStatement)
+	routerGroup.GET(":id/events", auth.UserMiddleware(), controller.streamEvents)
 	// routerGroup.DELETE(":id", auth.BearerMiddleware(), controller.delete)
-	routerGroup.PATCH(":id/balance", auth.UserMiddleware(), controller.updateBalance)
+	routerGroup.POST(":id/deposits", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("account.deposit", "account"), controller.deposit)
+	routerGroup.POST(":id/withdrawals", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("account.withdrawal", "account"), controller.withdraw)
+	routerGroup.POST(":id/close", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("account.close", "account"), controller.closeAccount)
 }
@@ -3,23 +3,43 @@ package account
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
 	"github.com/ahmedkhaeld/banking-app/internal/user"
 	"github.com/google/uuid"
 )
 
+// Errors
+var (
+	ErrAccountNotFound   = errors.New("account not found")
+	ErrCurrencyMismatch  = errors.New("currency does not match the account")
+	ErrAccountFrozen     = errors.New("account is frozen")
+	ErrAccountClosed     = errors.New("account is closed")
+	ErrNotAccountOwner   = errors.New("account does not belong to user")
+	ErrActiveHolds       = errors.New("account has active holds; capture or void them first")
+	ErrBalanceNotZero    = errors.New("account balance must be zero, or swept to another account")
+	ErrDepositForbidden  = errors.New("deposits can only be made by staff")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrInsufficientFunds = errors.New("insufficient available balance")
+)
+
 type Service struct {
 	crud.Service[model]
 	repo        *Repository
 	userService *user.Service
+	transfers   *transfer.Repository
 }
 
-func NewService(repository *Repository) *Service {
+func NewService(repository *Repository, transfers *transfer.Repository) *Service {
 	return &Service{
-		Service: *crud.NewService(repository),
-		repo:    repository,
+		Service:   *crud.NewService(repository),
+		repo:      repository,
+		transfers: transfers,
 	}
 }
 
@@ -28,6 +48,7 @@ func InitService() *Service {
 		repo:        InitRepository(),
 		Service:     *crud.NewService(InitRepository()),
 		userService: user.InitService(),
+		transfers:   transfer.InitRepository(),
 	}
 }
 
@@ -45,50 +66,97 @@ func (s *Service) createAccount(req CreateAccountRequest, userId string) (*Creat
 		Currency: req.Currency,
 		Owner:    user.Username,
 	}
-	if req.Balance != nil {
-		account.Balance = *req.Balance
-	}
-	err = s.repo.Repository.DB.Create(account).Error
+	err = s.repo.create(account)
 	if err != nil {
 		return nil, err
 	}
 	resp := &CreateAccountResponse{
-		ID:        account.ID.String(),
-		UserID:    account.UserID.String(),
-		Owner:     account.Owner,
-		Currency:  account.Currency,
-		Balance:   account.Balance,
-		CreatedAt: account.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:               account.ID.String(),
+		UserID:           account.UserID.String(),
+		Owner:            account.Owner,
+		Currency:         account.Currency,
+		Balance:          money.Money{Amount: account.Balance, Currency: account.Currency},
+		AvailableBalance: money.Money{Amount: account.AvailableBalance(), Currency: account.Currency},
+		CreatedAt:        account.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 	return resp, nil
 }
 
-func (s *Service) getAccountBalance(accountID, userID string) (*AccountBalanceResponse, error) {
+// findVisible loads an account that subject may view. Accounts hidden from the subject
+// are reported as not found.
+func (s *Service) findVisible(ctx context.Context, accountID string, subject authz.Subject) (*models.Account, error) {
+	id, err := uuid.Parse(accountID)
+	if err != nil {
+		return nil, ErrAccountNotFound
+	}
 	var account models.Account
-	if err := s.repo.Repository.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+	// Closed accounts are soft deleted but their owners can still look back at them
+	if err := s.repo.Repository.DB.WithContext(ctx).Unscoped().Where("id = ?", id).First(&account).Error; err != nil {
+		return nil, ErrAccountNotFound
+	}
+	if !authz.CanView(subject, &account) {
+		return nil, ErrAccountNotFound
+	}
+	return &account, nil
+}
+
+func (s *Service) getAccountBalance(ctx context.Context, accountID string, subject authz.Subject) (*AccountBalanceResponse, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
+	if err != nil {
 		return nil, err
 	}
 	return &AccountBalanceResponse{
-		ID:       account.ID.String(),
-		Balance:  account.Balance,
-		Currency: account.Currency,
+		ID:               account.ID.String(),
+		Balance:          money.Money{Amount: account.Balance, Currency: account.Currency},
+		AvailableBalance: money.Money{Amount: account.AvailableBalance(), Currency: account.Currency},
+		Currency:         account.Currency,
 	}, nil
 }
 
-func (s *Service) updateBalance(ctx context.Context, accountID string, amount int64) (*models.Account, error) {
-	id, err := uuid.Parse(accountID)
+// getStatement returns the entries of an account in [from, to) with a running balance
+func (s *Service) getStatement(ctx context.Context, accountID string, subject authz.Subject, from, to time.Time) (*StatementResponse, error) {
+	account, err := s.findVisible(ctx, accountID, subject)
 	if err != nil {
-		return nil, errors.New("invalid account_id format")
+		return nil, err
 	}
-	account, err := s.repo.updateBalance(ctx, id.String(), amount)
+	opening, err := s.repo.sumEntriesBefore(ctx, account.ID, from)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.repo.statementEntries(ctx, account.ID, from, to)
 	if err != nil {
 		return nil, err
 	}
-	return account, nil
-}
 
-func (s *Service) isAccountOwnedByUser(accountID, userID string) bool {
-	var account models.Account
-	err := s.repo.Repository.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error
-	return err == nil
+	balance := money.Money{Amount: opening, Currency: account.Currency}
+	resp := &StatementResponse{
+		AccountID:      account.ID.String(),
+		Currency:       account.Currency,
+		From:           from.Format(time.RFC3339),
+		To:             to.Format(time.RFC3339),
+		OpeningBalance: balance,
+		Lines:          make([]StatementLine, 0, len(rows)),
+	}
+	for _, row := range rows {
+		amount := money.Money{Amount: row.Amount, Currency: account.Currency}
+		balance, err = balance.Add(amount)
+		if err != nil {
+			return nil, err
+		}
+		line := StatementLine{
+			EntryID:     row.ID.String(),
+			Date:        row.CreatedAt.Format(time.RFC3339),
+			Kind:        row.Kind,
+			Reference:   row.Reference,
+			Description: row.Description,
+			Amount:      amount,
+			Balance:     balance,
+		}
+		if row.TransferID != nil {
+			line.TransferID = row.TransferID.String()
+		}
+		resp.Lines = append(resp.Lines, line)
+	}
+	resp.ClosingBalance = balance
+	return resp, nil
 }
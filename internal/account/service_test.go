@@ -3,22 +3,37 @@ package account
 import (
 	"context"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ahmedkhaeld/banking-app/common"
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
 	"github.com/ahmedkhaeld/banking-app/internal/user"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 // Use the real DB from  db package
 func setupTestRepository(t *testing.T) *Repository {
 	repo := InitRepository()
 	t.Cleanup(func() {
+		repo.Repository.DB.Exec("DELETE FROM transfers")
+		repo.Repository.DB.Exec("DELETE FROM entries")
+		repo.Repository.DB.Exec("DELETE FROM journals")
 		repo.Repository.DB.Exec("DELETE FROM accounts")
 	})
 	return repo
@@ -26,7 +41,7 @@ func setupTestRepository(t *testing.T) *Repository {
 
 func setupTestService(t *testing.T) *Service {
 	repo := setupTestRepository(t)
-	return NewService(repo)
+	return NewService(repo, transfer.InitRepository())
 }
 
 func TestMain(m *testing.M) {
@@ -46,7 +61,7 @@ func TestMain(m *testing.M) {
 	}
 
 	// Run migrations
-	if err := db.DB.AutoMigrate(&models.Account{}); err != nil {
+	if err := db.DB.AutoMigrate(&models.Account{}, &models.Hold{}, &models.Transfer{}, &models.Journal{}, &models.Entry{}, &models.OutboxEvent{}); err != nil {
 		panic("failed to run migrations: " + err.Error())
 	}
 
@@ -71,28 +86,34 @@ func createTestUser(t *testing.T) *models.User {
 	return userModel
 }
 
+// openFundedAccount opens a currency account of usr and has a teller deposit amount into it
+func openFundedAccount(t *testing.T, service *Service, usr *models.User, amount int64, currency string) *CreateAccountResponse {
+	resp, err := service.createAccount(CreateAccountRequest{Currency: currency}, usr.ID.String())
+	assert.NoError(t, err)
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.deposit(context.Background(), resp.ID, cash(amount, currency), teller)
+	assert.NoError(t, err)
+	return resp
+}
+
 func TestCreateAccount_Success(t *testing.T) {
 	service := InitService()
 	usr := createTestUser(t)
-	balance := int64(1000)
 	req := CreateAccountRequest{
 		Currency: "USD",
-		Balance:  &balance,
 	}
 	resp, err := service.createAccount(req, usr.ID.String())
 	assert.NoError(t, err)
 	assert.Equal(t, usr.ID.String(), resp.UserID)
 	assert.Equal(t, usr.Username, resp.Owner)
 	assert.Equal(t, req.Currency, resp.Currency)
-	assert.Equal(t, balance, resp.Balance)
+	assert.Equal(t, money.Money{Amount: 0, Currency: "USD"}, resp.Balance)
 }
 
 func TestCreateAccount_UserDoesNotExist(t *testing.T) {
 	service := InitService()
-	balance := int64(1000)
 	req := CreateAccountRequest{
 		Currency: "USD",
-		Balance:  &balance,
 	}
 	fakeUserID := uuid.New().String()
 	resp, err := service.createAccount(req, fakeUserID)
@@ -103,56 +124,395 @@ func TestCreateAccount_UserDoesNotExist(t *testing.T) {
 func TestGetAccountBalance_Success(t *testing.T) {
 	service := InitService()
 	usr := createTestUser(t)
-	balance := int64(500)
-	accReq := CreateAccountRequest{
-		Currency: "EUR",
-		Balance:  &balance,
-	}
-	accResp, err := service.createAccount(accReq, usr.ID.String())
-	assert.NoError(t, err)
-	balResp, err := service.getAccountBalance(accResp.ID, usr.ID.String())
+	balance := money.Money{Amount: 500, Currency: "EUR"}
+	accResp := openFundedAccount(t, service, usr, balance.Amount, balance.Currency)
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	balResp, err := service.getAccountBalance(context.Background(), accResp.ID, owner)
 	assert.NoError(t, err)
 	assert.Equal(t, accResp.ID, balResp.ID)
 	assert.Equal(t, balance, balResp.Balance)
-	assert.Equal(t, accReq.Currency, balResp.Currency)
+	assert.Equal(t, balance.Currency, balResp.Currency)
 }
 
-func TestUpdateBalance_Success(t *testing.T) {
+func TestGetAccountBalance_HiddenFromOtherUsers(t *testing.T) {
 	service := InitService()
 	usr := createTestUser(t)
-	initBalance := int64(200)
-	accReq := CreateAccountRequest{
-		Currency: "EGP",
-		Balance:  &initBalance,
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+
+	stranger := authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	_, err = service.getAccountBalance(context.Background(), accResp.ID, stranger)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.getAccountBalance(context.Background(), accResp.ID, teller)
+	assert.NoError(t, err)
+
+	_, err = service.findVisible(context.Background(), "not-a-uuid", teller)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+// cash returns a deposit or withdrawal request of amount minor units of currency
+func cash(amount int64, currency string) CashOperationRequest {
+	return CashOperationRequest{
+		Amount:    money.Money{Amount: amount, Currency: currency},
+		Reference: "REF-" + uuid.New().String()[:8],
 	}
-	accResp, err := service.createAccount(accReq, usr.ID.String())
+}
+
+func TestDeposit_Success(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp := openFundedAccount(t, service, usr, 200, "EGP")
+
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	req := cash(300, "EGP")
+	req.Description = "Cash at branch"
+	resp, err := service.deposit(context.Background(), accResp.ID, req, teller)
+	assert.NoError(t, err)
+	assert.Equal(t, ledger.KindDeposit, resp.Kind)
+	assert.Equal(t, int64(500), resp.Balance.Amount)
+	assert.Equal(t, req.Reference, resp.Reference)
+
+	var entries []models.Entry
+	err = service.repo.Repository.DB.Where("journal_id = ?", resp.JournalID).Order("amount").Find(&entries).Error
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, ledger.SystemAccountID(ledger.SystemCash, "EGP"), entries[0].AccountID)
+	assert.Equal(t, int64(-300), entries[0].Amount)
+}
+
+func TestDeposit_LimitedToStaff(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	t.Setenv(common.SimulatedFunding, "")
+	_, err = service.deposit(context.Background(), accResp.ID, cash(100, "USD"), owner)
+	assert.ErrorIs(t, err, ErrDepositForbidden)
+
+	t.Setenv(common.SimulatedFunding, "true")
+	resp, err := service.deposit(context.Background(), accResp.ID, cash(100, "USD"), owner)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), resp.Balance.Amount)
+
+	// Simulated funding only covers the caller's own accounts
+	stranger := authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	_, err = service.deposit(context.Background(), accResp.ID, cash(100, "USD"), stranger)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestDeposit_InvalidAccountID(t *testing.T) {
+	service := InitService()
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err := service.deposit(context.Background(), "not-a-uuid", cash(100, "USD"), teller)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestDeposit_Overflow(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+	err = service.repo.Repository.DB.Model(&models.Account{}).Where("id = ?", accResp.ID).
+		UpdateColumn("balance", int64(math.MaxInt64-10)).Error
+	assert.NoError(t, err)
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.deposit(context.Background(), accResp.ID, cash(11, "USD"), teller)
+	assert.ErrorIs(t, err, money.ErrOverflow)
+}
+
+func TestDeposit_CurrencyMismatch(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.deposit(context.Background(), accResp.ID, cash(100, "EUR"), teller)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	_, err = service.deposit(context.Background(), accResp.ID, cash(0, "USD"), teller)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestWithdraw_SufficientFunds(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp := openFundedAccount(t, service, usr, 1000, "USD")
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	resp, err := service.withdraw(context.Background(), accResp.ID, cash(400, "USD"), owner)
+	assert.NoError(t, err)
+	assert.Equal(t, ledger.KindWithdrawal, resp.Kind)
+	assert.Equal(t, int64(400), resp.Amount.Amount)
+	assert.Equal(t, int64(600), resp.Balance.Amount)
+
+	_, err = service.withdraw(context.Background(), accResp.ID, cash(601, "USD"), owner)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	// Held money cannot be withdrawn
+	err = service.repo.Repository.DB.Model(&models.Account{}).Where("id = ?", accResp.ID).
+		UpdateColumn("held_balance", int64(500)).Error
+	assert.NoError(t, err)
+	_, err = service.withdraw(context.Background(), accResp.ID, cash(200, "USD"), owner)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	err = service.repo.Repository.DB.Model(&models.Account{}).Where("id = ?", accResp.ID).
+		UpdateColumn("held_balance", int64(0)).Error
+	assert.NoError(t, err)
+
+	stranger := authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	_, err = service.withdraw(context.Background(), accResp.ID, cash(100, "USD"), stranger)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestCreateAccount_OpensAtZero(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	resp, err := service.createAccount(CreateAccountRequest{Currency: "GBP"}, usr.ID.String())
+	assert.NoError(t, err)
+	assert.True(t, resp.Balance.IsZero())
+
+	// Opening an account moves no money; funding it is a deposit
+	var entries []models.Entry
+	err = service.repo.Repository.DB.Where("account_id = ?", resp.ID).Find(&entries).Error
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestGetStatement_RunningBalance(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp := openFundedAccount(t, service, usr, 1000, "USD")
+	from := time.Now()
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err := service.deposit(context.Background(), accResp.ID, cash(250, "USD"), teller)
 	assert.NoError(t, err)
-	addAmount := int64(300)
-	updated, err := service.updateBalance(context.Background(), accResp.ID, addAmount)
+	_, err = service.deposit(context.Background(), accResp.ID, cash(50, "USD"), teller)
 	assert.NoError(t, err)
-	assert.Equal(t, initBalance+addAmount, updated.Balance)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	statement, err := service.getStatement(context.Background(), accResp.ID, owner, from, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), statement.OpeningBalance.Amount)
+	assert.Len(t, statement.Lines, 2)
+	assert.Equal(t, int64(1250), statement.Lines[0].Balance.Amount)
+	assert.Equal(t, int64(1300), statement.Lines[1].Balance.Amount)
+	assert.Equal(t, int64(1300), statement.ClosingBalance.Amount)
+	assert.Equal(t, ledger.KindDeposit, statement.Lines[0].Kind)
+	assert.NotEmpty(t, statement.Lines[0].Reference)
+
+	var csv strings.Builder
+	assert.NoError(t, writeStatementCSV(&csv, statement))
+	assert.Equal(t, 3, strings.Count(csv.String(), "\n"))
+	assert.Contains(t, csv.String(), "2.50,USD,12.50")
+
+	var ofx strings.Builder
+	assert.NoError(t, writeStatementOFX(&ofx, statement, time.Now()))
+	assert.Equal(t, 2, strings.Count(ofx.String(), "<STMTTRN>"))
+	assert.Contains(t, ofx.String(), "<BALAMT>13.00")
 }
 
-func TestUpdateBalance_InvalidAccountID(t *testing.T) {
+func TestCloseAccount_ZeroBalance(t *testing.T) {
 	service := InitService()
-	_, err := service.updateBalance(context.Background(), "not-a-uuid", 100)
+	usr := createTestUser(t)
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	resp, err := service.closeAccount(context.Background(), accResp.ID, CloseAccountRequest{}, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AccountStatusClosed, resp.Status)
+	assert.Empty(t, resp.SweepTransferID)
+
+	_, err = service.closeAccount(context.Background(), accResp.ID, CloseAccountRequest{}, owner)
+	assert.ErrorIs(t, err, ErrAccountClosed)
+	_, err = service.withdraw(context.Background(), accResp.ID, cash(100, "USD"), owner)
+	assert.ErrorIs(t, err, ErrAccountClosed)
+	// The closed account and its history remain readable
+	_, err = service.getAccountBalance(context.Background(), accResp.ID, owner)
+	assert.NoError(t, err)
+
+	// It is soft deleted with the same update
+	var closed models.Account
+	err = service.repo.Repository.DB.Where("id = ?", accResp.ID).First(&closed).Error
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, service.repo.Repository.DB.Unscoped().Where("id = ?", accResp.ID).First(&closed).Error)
+	assert.True(t, closed.DeletedAt.Valid)
+	assert.Equal(t, closed.ClosedAt.Unix(), closed.DeletedAt.Time.Unix())
+}
+
+func TestCloseAccount_SweepsBalance(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	balance := money.Money{Amount: 1200, Currency: "USD"}
+	closing := openFundedAccount(t, service, usr, balance.Amount, balance.Currency)
+	target, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	_, err = service.closeAccount(context.Background(), closing.ID, CloseAccountRequest{}, owner)
+	assert.ErrorIs(t, err, ErrBalanceNotZero)
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.closeAccount(context.Background(), closing.ID, CloseAccountRequest{SweepToAccountID: target.ID}, teller)
+	assert.ErrorIs(t, err, ErrNotAccountOwner)
+
+	resp, err := service.closeAccount(context.Background(), closing.ID, CloseAccountRequest{SweepToAccountID: target.ID}, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, balance, resp.SweptAmount)
+	assert.NotEmpty(t, resp.SweepTransferID)
+
+	closedBal, err := service.getAccountBalance(context.Background(), closing.ID, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), closedBal.Balance.Amount)
+	targetBal, err := service.getAccountBalance(context.Background(), target.ID, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, balance, targetBal.Balance)
+
+	// Money can no longer be sent to the closed account
+	_, err = service.transfers.TransferTx(context.Background(), transfer.TransferTxParams{
+		UserID:        usr.ID.String(),
+		FromAccountID: target.ID,
+		ToAccountID:   closing.ID,
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	})
+	assert.ErrorIs(t, err, transfer.ErrAccountClosed)
+}
+
+func TestCloseAccount_ActiveHolds(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	closing := openFundedAccount(t, service, usr, 500, "USD")
+	target, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+	_, err = service.transfers.AuthorizeTx(context.Background(), transfer.TransferTxParams{
+		UserID:        usr.ID.String(),
+		FromAccountID: closing.ID,
+		ToAccountID:   target.ID,
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	})
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	_, err = service.closeAccount(context.Background(), closing.ID, CloseAccountRequest{SweepToAccountID: target.ID}, owner)
+	assert.ErrorIs(t, err, ErrActiveHolds)
+}
+
+func TestParseStatementWindow(t *testing.T) {
+	now := time.Date(2024, 5, 20, 10, 0, 0, 0, time.UTC)
+	from, to, err := parseStatementWindow("2024-05-01", "2024-05-10", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = parseStatementWindow("", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, to)
+	assert.Equal(t, now.Add(-statementDefaultWindow), from)
+
+	_, _, err = parseStatementWindow("2024-05-10", "2024-05-01", now)
 	assert.Error(t, err)
 }
 
-func TestIsAccountOwnedByUser(t *testing.T) {
+func TestStatementExports_EscapeText(t *testing.T) {
+	statement := &StatementResponse{
+		AccountID: uuid.NewString(),
+		Currency:  "EUR",
+		From:      "2024-05-01T00:00:00Z",
+		To:        "2024-05-02T00:00:00Z",
+		Lines: []StatementLine{{
+			EntryID:     uuid.NewString(),
+			Date:        "2024-05-01T10:00:00Z",
+			Kind:        ledger.KindDeposit,
+			Reference:   `=HYPERLINK("http://evil.example","x")`,
+			Description: strings.Repeat("é", 300),
+			Amount:      money.Money{Amount: -250, Currency: "EUR"},
+			Balance:     money.Money{Amount: 750, Currency: "EUR"},
+		}},
+	}
+
+	var csv strings.Builder
+	assert.NoError(t, writeStatementCSV(&csv, statement))
+	assert.Contains(t, csv.String(), `"'=HYPERLINK(""http://evil.example"",""x"")"`)
+	assert.Contains(t, csv.String(), ",-2.50,EUR,7.50")
+
+	var ofx strings.Builder
+	assert.NoError(t, writeStatementOFX(&ofx, statement, time.Now()))
+	assert.Contains(t, ofx.String(), "ENCODING:UTF-8\r\nCHARSET:NONE\r\n")
+	memo := ofx.String()[strings.Index(ofx.String(), "<MEMO>")+len("<MEMO>"):]
+	memo = memo[:strings.Index(memo, "\r\n")]
+	assert.True(t, utf8.ValidString(memo))
+	assert.Equal(t, 255, utf8.RuneCountInString(memo))
+}
+
+func TestActivity_StreamsTransfersAndBalanceChanges(t *testing.T) {
 	service := InitService()
 	usr := createTestUser(t)
-	balance := int64(100)
-	accReq := CreateAccountRequest{
-		Currency: "CAD",
-		Balance:  &balance,
+	other := createTestUser(t)
+	from := openFundedAccount(t, service, usr, 1000, "USD")
+	to, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, other.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	account, seq, err := service.openActivity(context.Background(), from.ID, owner, "")
+	assert.NoError(t, err)
+	changed, stop := events.Live.Subscribe(account.ID)
+	defer stop()
+
+	_, err = service.transfers.TransferTx(context.Background(), transfer.TransferTxParams{
+		UserID:        usr.ID.String(),
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        money.Money{Amount: 300, Currency: "USD"},
+	})
+	assert.NoError(t, err)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("transfer did not notify the account stream")
 	}
-	accResp, err := service.createAccount(accReq, usr.ID.String())
-	assert.NoError(t, err)
-	// Should be true for owner
-	ok := service.isAccountOwnedByUser(accResp.ID, usr.ID.String())
-	assert.True(t, ok)
-	// Should be false for random user
-	ok = service.isAccountOwnedByUser(accResp.ID, uuid.New().String())
-	assert.False(t, ok)
+	teller := authz.Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	_, err = service.deposit(context.Background(), from.ID, cash(50, "USD"), teller)
+	assert.NoError(t, err)
+
+	// The stream starts after the events that existed when it was opened
+	list, err := service.activitySince(context.Background(), account.ID, seq)
+	assert.NoError(t, err)
+	var types []string
+	for _, event := range list {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{ActivityBalanceChanged, ActivityTransferSent, ActivityBalanceChanged}, types)
+
+	incoming, err := service.activitySince(context.Background(), uuid.MustParse(to.ID), seq)
+	assert.NoError(t, err)
+	assert.Len(t, incoming, 2)
+	assert.Equal(t, ActivityTransferReceived, incoming[1].Type)
+
+	// Resuming from Last-Event-ID skips what the client already received
+	_, resumed, err := service.openActivity(context.Background(), from.ID, owner, strconv.FormatInt(list[0].ID, 10))
+	assert.NoError(t, err)
+	rest, err := service.activitySince(context.Background(), account.ID, resumed)
+	assert.NoError(t, err)
+	assert.Equal(t, list[1:], rest)
+
+	var stream strings.Builder
+	assert.NoError(t, writeActivity(&stream, rest))
+	assert.Contains(t, stream.String(), "id:"+strconv.FormatInt(rest[0].ID, 10)+"\nevent:transfer.sent\ndata:{")
+	assert.Equal(t, 2, strings.Count(stream.String(), "\n\n"))
+}
+
+func TestActivity_Rejected(t *testing.T) {
+	service := InitService()
+	usr := createTestUser(t)
+	accResp, err := service.createAccount(CreateAccountRequest{Currency: "USD"}, usr.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: usr.ID, Role: models.RoleCustomer}
+	_, _, err = service.openActivity(context.Background(), accResp.ID, owner, "not-an-id")
+	assert.ErrorIs(t, err, ErrInvalidEventID)
+
+	stranger := authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	_, _, err = service.openActivity(context.Background(), accResp.ID, stranger, "")
+	assert.ErrorIs(t, err, ErrAccountNotFound)
 }
@@ -0,0 +1,151 @@
+package account
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	statementDateLayout    = "2006-01-02"
+	statementDefaultWindow = 30 * 24 * time.Hour
+	ofxDateLayout          = "20060102150405"
+)
+
+// parseStatementWindow resolves the from/to query parameters into a [from, to) window.
+// A date-only `to` covers the whole day.
+func parseStatementWindow(fromStr, toStr string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toStr != "" {
+		t, dateOnly, err := parseStatementTime(toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	from := to.Add(-statementDefaultWindow)
+	if fromStr != "" {
+		t, _, err := parseStatementTime(fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseStatementTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(statementDateLayout, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// writeStatementCSV writes one row per statement line, preceded by a header
+func writeStatementCSV(w io.Writer, s *StatementResponse) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{{"date", "entry_id", "kind", "reference", "description", "transfer_id", "amount", "currency", "balance"}}
+	for _, line := range s.Lines {
+		rows = append(rows, []string{
+			line.Date,
+			line.EntryID,
+			line.Kind,
+			csvText(line.Reference),
+			csvText(line.Description),
+			line.TransferID,
+			line.Amount.Decimal(),
+			line.Amount.Currency,
+			line.Balance.Decimal(),
+		})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText keeps spreadsheets from running free text that a customer or teller wrote as a
+// formula, by prefixing a quote to values that start like one
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeStatementOFX writes the statement as an OFX 1.0.2 (SGML) bank statement, which
+// personal finance tools also accept as QFX.
+func writeStatementOFX(w io.Writer, s *StatementResponse, now time.Time) error {
+	from, err := time.Parse(time.RFC3339, s.From)
+	if err != nil {
+		return err
+	}
+	to, err := time.Parse(time.RFC3339, s.To)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:UTF-8\r\n")
+	b.WriteString("CHARSET:NONE\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	b.WriteString("<OFX>\r\n<SIGNONMSGSRSV1>\r\n<SONRS>\r\n")
+	b.WriteString("<STATUS>\r\n<CODE>0\r\n<SEVERITY>INFO\r\n</STATUS>\r\n")
+	fmt.Fprintf(&b, "<DTSERVER>%s\r\n<LANGUAGE>ENG\r\n", ofxDate(now))
+	b.WriteString("</SONRS>\r\n</SIGNONMSGSRSV1>\r\n")
+	b.WriteString("<BANKMSGSRSV1>\r\n<STMTTRNRS>\r\n<TRNUID>0\r\n")
+	b.WriteString("<STATUS>\r\n<CODE>0\r\n<SEVERITY>INFO\r\n</STATUS>\r\n")
+	fmt.Fprintf(&b, "<STMTRS>\r\n<CURDEF>%s\r\n", s.Currency)
+	fmt.Fprintf(&b, "<BANKACCTFROM>\r\n<BANKID>BANKINGAPP\r\n<ACCTID>%s\r\n<ACCTTYPE>CHECKING\r\n</BANKACCTFROM>\r\n", s.AccountID)
+	fmt.Fprintf(&b, "<BANKTRANLIST>\r\n<DTSTART>%s\r\n<DTEND>%s\r\n", ofxDate(from), ofxDate(to))
+	for _, line := range s.Lines {
+		posted, err := time.Parse(time.RFC3339, line.Date)
+		if err != nil {
+			return err
+		}
+		trnType := "CREDIT"
+		if line.Amount.IsNegative() {
+			trnType = "DEBIT"
+		}
+		name := line.Kind
+		if name == "" {
+			name = "entry"
+		}
+		b.WriteString("<STMTTRN>\r\n")
+		fmt.Fprintf(&b, "<TRNTYPE>%s\r\n<DTPOSTED>%s\r\n<TRNAMT>%s\r\n<FITID>%s\r\n", trnType, ofxDate(posted), line.Amount.Decimal(), line.EntryID)
+		fmt.Fprintf(&b, "<NAME>%s\r\n", ofxText(name))
+		if memo := strings.TrimSpace(strings.Join([]string{line.Reference, line.Description, line.TransferID}, " ")); memo != "" {
+			fmt.Fprintf(&b, "<MEMO>%s\r\n", ofxText(memo))
+		}
+		b.WriteString("</STMTTRN>\r\n")
+	}
+	b.WriteString("</BANKTRANLIST>\r\n")
+	fmt.Fprintf(&b, "<LEDGERBAL>\r\n<BALAMT>%s\r\n<DTASOF>%s\r\n</LEDGERBAL>\r\n", s.ClosingBalance.Decimal(), ofxDate(to))
+	b.WriteString("</STMTRS>\r\n</STMTTRNRS>\r\n</BANKMSGSRSV1>\r\n</OFX>\r\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func ofxDate(t time.Time) string {
+	return t.UTC().Format(ofxDateLayout)
+}
+
+// ofxText escapes the characters SGML reserves and keeps values on one line. Values are cut
+// to 255 characters before escaping, so that neither a character nor an entity is split.
+func ofxText(s string) string {
+	if runes := []rune(s); len(runes) > 255 {
+		s = string(runes[:255])
+	}
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ").Replace(s)
+}
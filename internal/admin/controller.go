@@ -0,0 +1,337 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ElegantSoft/go-restful-generator/crud"
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Controller struct {
+	service *Service
+}
+
+// findAll answers a list or search request through the generic crud service
+func findAll[T any](ctx *gin.Context, service *crud.Service[T]) {
+	var api crud.GetAllRequest
+	if err := ctx.ShouldBindQuery(&api); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if api.Limit == 0 {
+		api.Limit = 20
+	}
+
+	var result []T
+	var totalRows int64
+	if err := service.Find(api, &result, &totalRows); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var data interface{}
+	if api.Page > 0 {
+		data = map[string]interface{}{
+			"data":       result,
+			"total":      totalRows,
+			"totalPages": int((totalRows + int64(api.Limit) - 1) / int64(api.Limit)),
+		}
+	} else {
+		data = result
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// bindID reads the :id path parameter as a UUID
+func bindID(ctx *gin.Context) (uuid.UUID, bool) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(item.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// @Success  200  {array}  models.Account
+// @Tags     admin
+// @Security JWT
+// @Summary  List and search all accounts
+// @param    s       query  string    false  "{'and': [ {'owner': { 'cont':'ahmed' } } ]}"
+// @param    page    query  int       false  "page of pagination"
+// @param    limit   query  int       false  "limit of pagination"
+// @param    filter  query  []string  false  "filters eg: currency||eq||USD status||eq||frozen"
+// @param    sort    query  []string  false  "filters eg: created_at,desc"
+// @Router   /api/v1/admin/accounts [get]
+func (c *Controller) listAccounts(ctx *gin.Context) {
+	findAll(ctx, c.service.accounts)
+}
+
+// @Success  200  {object}  models.Account
+// @Tags     admin
+// @Security JWT
+// @Summary  Get any account
+// @param    id  path  string  true  "uuid of item"
+// @Router   /api/v1/admin/accounts/{id} [get]
+func (c *Controller) findAccount(ctx *gin.Context) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	account, err := findOne(c.service.accounts, id.String(), ErrAccountNotFound)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, account)
+}
+
+// @Success  200  {object}  models.Account
+// @Tags     admin
+// @Security JWT
+// @Summary  Freeze an account
+// @Description A frozen account can neither send nor receive money until it is unfrozen.
+// @param    id       path  string                true  "uuid of item"
+// @param    request  body  FreezeAccountRequest  true  "reason for the freeze"
+// @Router   /api/v1/admin/accounts/{id}/freeze [post]
+func (c *Controller) freezeAccount(ctx *gin.Context) {
+	c.setAccountStatus(ctx, models.AccountStatusFrozen)
+}
+
+// @Success  200  {object}  models.Account
+// @Tags     admin
+// @Security JWT
+// @Summary  Unfreeze an account
+// @param    id       path  string                true  "uuid of item"
+// @param    request  body  FreezeAccountRequest  true  "reason for lifting the freeze"
+// @Router   /api/v1/admin/accounts/{id}/unfreeze [post]
+func (c *Controller) unfreezeAccount(ctx *gin.Context) {
+	c.setAccountStatus(ctx, models.AccountStatusActive)
+}
+
+func (c *Controller) setAccountStatus(ctx *gin.Context, status string) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	var req FreezeAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetDetails(ctx, gin.H{"status": status, "reason": req.Reason})
+
+	var account *models.Account
+	var err error
+	if status == models.AccountStatusFrozen {
+		account, err = c.service.freezeAccount(ctx, id)
+	} else {
+		account, err = c.service.unfreezeAccount(ctx, id)
+	}
+	if errors.Is(err, ErrAccountNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrAccountClosed) {
+		ctx.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": account})
+}
+
+// @Success  200  {array}  models.User
+// @Tags     admin
+// @Security JWT
+// @Summary  List and search all users
+// @param    s       query  string    false  "{'or': [ {'username': { 'cont':'ahm' } }, {'email': { 'cont':'ahm' } } ]}"
+// @param    page    query  int       false  "page of pagination"
+// @param    limit   query  int       false  "limit of pagination"
+// @param    filter  query  []string  false  "filters eg: role||eq||teller"
+// @param    sort    query  []string  false  "filters eg: created_at,desc"
+// @Router   /api/v1/admin/users [get]
+func (c *Controller) listUsers(ctx *gin.Context) {
+	findAll(ctx, c.service.users)
+}
+
+// @Success  200  {object}  models.User
+// @Tags     admin
+// @Security JWT
+// @Summary  Get any user
+// @param    id  path  string  true  "uuid of item"
+// @Router   /api/v1/admin/users/{id} [get]
+func (c *Controller) findUser(ctx *gin.Context) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	user, err := findOne(c.service.users, id.String(), ErrUserNotFound)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+// @Success  200  {object}  models.User
+// @Tags     admin
+// @Security JWT
+// @Summary  Change a user's role
+// @Description The user's sessions are revoked so the new role applies from their next login.
+// @param    id       path  string                 true  "uuid of item"
+// @param    request  body  UpdateUserRoleRequest  true  "new role"
+// @Router   /api/v1/admin/users/{id}/role [patch]
+func (c *Controller) updateUserRole(ctx *gin.Context) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	var req UpdateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetDetails(ctx, gin.H{"role": req.Role})
+
+	user, err := c.service.setUserRole(ctx, id, req.Role)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrInvalidRole):
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// @Success  200  {object}  models.User
+// @Tags     admin
+// @Security JWT
+// @Summary  Unlock a user's login
+// @Description Lifts the backoff or lockout that failed logins put on the user's username.
+// @param    id  path  string  true  "uuid of item"
+// @Router   /api/v1/admin/users/{id}/unlock [post]
+func (c *Controller) unlockUser(ctx *gin.Context) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	user, err := c.service.unlockUser(ctx, id)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// @Success  204
+// @Tags     admin
+// @Security JWT
+// @Summary  Unlock logins from a client IP
+// @Description Lifts the backoff or lockout that failed logins put on an address.
+// @param    ip  path  string  true  "client IP address"
+// @Router   /api/v1/admin/ips/{ip}/unlock [post]
+func (c *Controller) unlockIP(ctx *gin.Context) {
+	ip := ctx.Param("ip")
+	audit.SetDetails(ctx, gin.H{"ip": ip})
+
+	err := c.service.unlockIP(ctx, ip)
+	switch {
+	case errors.Is(err, ErrInvalidIP):
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Success  200  {array}  models.Transfer
+// @Tags     admin
+// @Security JWT
+// @Summary  List and search all transfers
+// @param    page    query  int       false  "page of pagination"
+// @param    limit   query  int       false  "limit of pagination"
+// @param    filter  query  []string  false  "filters eg: from_account_id||eq||<uuid>"
+// @param    sort    query  []string  false  "filters eg: created_at,desc"
+// @Router   /api/v1/admin/transfers [get]
+func (c *Controller) listTransfers(ctx *gin.Context) {
+	findAll(ctx, c.service.transfers)
+}
+
+// @Success  200  {object}  models.Transfer
+// @Tags     admin
+// @Security JWT
+// @Summary  Get any transfer
+// @param    id  path  string  true  "uuid of item"
+// @Router   /api/v1/admin/transfers/{id} [get]
+func (c *Controller) findTransfer(ctx *gin.Context) {
+	id, ok := bindID(ctx)
+	if !ok {
+		return
+	}
+	transfer, err := findOne(c.service.transfers, id.String(), ErrTransferNotFound)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+// @Success  200  {array}  models.AuditLog
+// @Tags     admin
+// @Security JWT
+// @Summary  Search the audit log
+// @Description Lists audit entries, e.g. filter=actor_id||eq||<uuid>, filter=action||eq||transfer.create,
+// @Description filter=resource_id||eq||<id>, filter=request_id||eq||<id> or filter=created_at||gte||2024-01-01. Admins only.
+// @param    page    query  int       false  "page of pagination"
+// @param    limit   query  int       false  "limit of pagination"
+// @param    filter  query  []string  false  "filters eg: action||eq||auth.login"
+// @param    sort    query  []string  false  "filters eg: seq,desc"
+// @Router   /api/v1/admin/audit-logs [get]
+func (c *Controller) listAuditLogs(ctx *gin.Context) {
+	findAll(ctx, c.service.auditLogs)
+}
+
+// @Success  200  {object}  audit.Report
+// @Tags     admin
+// @Security JWT
+// @Summary  Verify the audit log
+// @Description Walks the hash chain of the audit log and reports every entry that was edited, or whose predecessor
+// @Description was deleted. Admins only.
+// @Router   /api/v1/admin/audit-logs/verify [get]
+func (c *Controller) verifyAuditLog(ctx *gin.Context) {
+	report, err := c.service.verifyAuditLog(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
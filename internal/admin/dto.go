@@ -0,0 +1,15 @@
+package admin
+
+// FreezeAccountRequest represents the request body for freezing or unfreezing an account.
+type FreezeAccountRequest struct {
+	// Reason for the change, kept in the audit log
+	// required: true
+	Reason string `json:"reason" binding:"required"`
+}
+
+// UpdateUserRoleRequest represents the request body for changing a user's role.
+type UpdateUserRoleRequest struct {
+	// New role of the user
+	// required: true
+	Role string `json:"role" binding:"required,oneof=customer teller admin"`
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ElegantSoft/go-restful-generator/crud"
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	DB        *gorm.DB
+	Accounts  crud.Repository[models.Account]
+	Users     crud.Repository[models.User]
+	Transfers crud.Repository[models.Transfer]
+	AuditLogs crud.Repository[models.AuditLog]
+}
+
+func InitRepository() *Repository {
+	return &Repository{
+		DB:        db.DB,
+		Accounts:  crud.Repository[models.Account]{DB: db.DB, Model: models.Account{}},
+		Users:     crud.Repository[models.User]{DB: db.DB, Model: models.User{}},
+		Transfers: crud.Repository[models.Transfer]{DB: db.DB, Model: models.Transfer{}},
+		AuditLogs: crud.Repository[models.AuditLog]{DB: db.DB, Model: models.AuditLog{}},
+	}
+}
+
+// setAccountStatus locks a customer account and moves it to status. Closed accounts stay closed.
+func (r *Repository) setAccountStatus(ctx context.Context, accountID uuid.UUID, status string) (*models.Account, error) {
+	var account models.Account
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_system = ?", accountID, false).
+			First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if account.Status == models.AccountStatusClosed {
+			return ErrAccountClosed
+		}
+		if account.Status == status {
+			return nil
+		}
+		account.Status = status
+		if err := tx.Model(&account).Update("status", status).Error; err != nil {
+			return err
+		}
+		if status != models.AccountStatusFrozen {
+			return nil
+		}
+		return events.Record(tx, events.AccountFrozen, events.AggregateAccount, account.ID, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// findUserByUsername returns the user with username
+func (r *Repository) findUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	err := r.DB.WithContext(ctx).Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setUserRole changes the role of a user
+func (r *Repository) setUserRole(ctx context.Context, userID uuid.UUID, role string) (*models.User, error) {
+	var user models.User
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		user.Role = role
+		return tx.Model(&user).Update("role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
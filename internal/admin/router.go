@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the staff API. Every route is audited.
+func RegisterRoutes(routerGroup *gin.RouterGroup) {
+	service := InitService()
+	controller := NewController(service)
+
+	routerGroup.Use(auth.UserMiddleware(), auth.RequireRole(models.RoleTeller, models.RoleAdmin))
+
+	routerGroup.GET("accounts", audit.Action("admin.account.list", "account"), controller.listAccounts)
+	routerGroup.GET("accounts/:id", audit.Action("admin.account.view", "account"), controller.findAccount)
+	routerGroup.POST("accounts/:id/freeze", audit.Action("admin.account.freeze", "account"), controller.freezeAccount)
+	routerGroup.POST("accounts/:id/unfreeze", audit.Action("admin.account.unfreeze", "account"), controller.unfreezeAccount)
+
+	routerGroup.GET("users", audit.Action("admin.user.list", "user"), controller.listUsers)
+	routerGroup.GET("users/:id", audit.Action("admin.user.view", "user"), controller.findUser)
+	// Audited before the role check so that refused attempts by tellers are recorded too
+	routerGroup.PATCH("users/:id/role", audit.Action("admin.user.role", "user"), auth.RequireRole(models.RoleAdmin), controller.updateUserRole)
+	routerGroup.POST("users/:id/unlock", audit.Action("admin.user.unlock", "user"), controller.unlockUser)
+	routerGroup.POST("ips/:ip/unlock", audit.Action("admin.ip.unlock", "ip"), controller.unlockIP)
+
+	routerGroup.GET("transfers", audit.Action("admin.transfer.list", "transfer"), controller.listTransfers)
+	routerGroup.GET("transfers/:id", audit.Action("admin.transfer.view", "transfer"), controller.findTransfer)
+
+	routerGroup.GET("audit-logs", audit.Action("admin.audit.list", "audit_log"), auth.RequireRole(models.RoleAdmin), controller.listAuditLogs)
+	routerGroup.GET("audit-logs/verify", audit.Action("admin.audit.verify", "audit_log"), auth.RequireRole(models.RoleAdmin), controller.verifyAuditLog)
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/ElegantSoft/go-restful-generator/crud"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+// Errors
+var (
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrAccountClosed    = errors.New("account is closed")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInvalidIP        = errors.New("invalid ip address")
+)
+
+type Service struct {
+	repo      *Repository
+	sessions  *auth.SessionRepository
+	audit     *audit.Repository
+	accounts  *crud.Service[models.Account]
+	users     *crud.Service[models.User]
+	transfers *crud.Service[models.Transfer]
+	auditLogs *crud.Service[models.AuditLog]
+	// attempts holds the failed login counters shared with the user package
+	attempts ratelimit.Store
+}
+
+func NewService(repository *Repository) *Service {
+	return &Service{
+		repo:      repository,
+		sessions:  auth.InitSessionRepository(),
+		audit:     audit.InitRepository(),
+		accounts:  crud.NewService[models.Account](&repository.Accounts),
+		users:     crud.NewService[models.User](&repository.Users),
+		transfers: crud.NewService[models.Transfer](&repository.Transfers),
+		auditLogs: crud.NewService[models.AuditLog](&repository.AuditLogs),
+		attempts:  defaultAttemptStore(),
+	}
+}
+
+func defaultAttemptStore() ratelimit.Store {
+	store, err := ratelimit.DefaultStore()
+	if err != nil {
+		log.Fatalf("Error creating rate limit store: %v", err)
+	}
+	return store
+}
+
+func InitService() *Service {
+	return NewService(InitRepository())
+}
+
+// findOne looks up a single row by id through the generic crud service
+func findOne[T any](service *crud.Service[T], id string, notFound error) (*T, error) {
+	var result T
+	api := crud.GetAllRequest{
+		Filter: []string{fmt.Sprintf("id||eq||%s", id)},
+	}
+	if err := service.FindOne(api, &result); err != nil {
+		return nil, notFound
+	}
+	return &result, nil
+}
+
+func (s *Service) freezeAccount(ctx context.Context, accountID uuid.UUID) (*models.Account, error) {
+	return s.repo.setAccountStatus(ctx, accountID, models.AccountStatusFrozen)
+}
+
+func (s *Service) unfreezeAccount(ctx context.Context, accountID uuid.UUID) (*models.Account, error) {
+	return s.repo.setAccountStatus(ctx, accountID, models.AccountStatusActive)
+}
+
+// setUserRole changes the role of a user and revokes their sessions, so the new role
+// applies from their next login rather than when their access token expires.
+func (s *Service) setUserRole(ctx context.Context, userID uuid.UUID, role string) (*models.User, error) {
+	switch role {
+	case models.RoleCustomer, models.RoleTeller, models.RoleAdmin:
+	default:
+		return nil, ErrInvalidRole
+	}
+	user, err := s.repo.setUserRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.RevokeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetUserRoleByUsername changes the role of a user from the command line, which is how the
+// first admin is created. Like the admin API it revokes the user's sessions; with no request
+// to audit, it records the change in the audit log itself, without an actor.
+func (s *Service) SetUserRoleByUsername(ctx context.Context, username, role string) (*models.User, error) {
+	user, err := s.repo.findUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	before := user.Role
+	user, err = s.setUserRole(ctx, user.ID, role)
+	if err != nil {
+		return nil, err
+	}
+	details, _ := json.Marshal(map[string]string{"role": role, "source": "cli"})
+	previous, _ := json.Marshal(map[string]string{"role": before})
+	err = s.audit.Record(ctx, &models.AuditLog{
+		ActorRole:    "system",
+		Action:       "admin.user.role",
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+		Details:      string(details),
+		Before:       string(previous),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("role changed but not audited: %w", err)
+	}
+	return user, nil
+}
+
+// unlockUser lifts the login backoff or lockout of a user before it ends on its own
+func (s *Service) unlockUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, err := findOne(s.users, userID.String(), ErrUserNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attempts.Reset(ctx, ratelimit.LoginUsernameKey(user.Username)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// unlockIP lifts the login backoff or lockout of a client IP
+func (s *Service) unlockIP(ctx context.Context, ip string) error {
+	if net.ParseIP(ip) == nil {
+		return ErrInvalidIP
+	}
+	return s.attempts.Reset(ctx, ratelimit.LoginIPKey(ip))
+}
+
+// verifyAuditLog walks the hash chain of the audit log
+func (s *Service) verifyAuditLog(ctx context.Context) (*audit.Report, error) {
+	return audit.Verify(ctx, s.repo.DB)
+}
@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestService(t *testing.T) *Service {
+	repo := InitRepository()
+	t.Cleanup(func() {
+		repo.DB.Exec("DELETE FROM sessions")
+		repo.DB.Exec("DELETE FROM accounts")
+		repo.DB.Exec("DELETE FROM users")
+	})
+	return NewService(repo)
+}
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	dsn := os.Getenv("DB_SOURCE_TEST")
+	if err := db.Open(dsn); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+
+	if err := db.AddUUIDExtension(); err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+
+	// Run migrations
+	if err := db.DB.AutoMigrate(&models.User{}, &models.Session{}, &models.Account{}, &models.OutboxEvent{}, &models.AuditLog{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+
+	// Run tests
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createTestUser(t *testing.T, service *Service) *models.User {
+	user := &models.User{
+		ID:       uuid.New(),
+		Username: "testuser_" + uuid.New().String()[:8],
+		Password: "hashed",
+		FullName: "Test User",
+		Email:    "test_" + uuid.New().String()[:8] + "@example.com",
+	}
+	assert.NoError(t, service.repo.DB.Create(user).Error)
+	return user
+}
+
+func TestFreezeAccount(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	account := &models.Account{ID: uuid.New(), UserID: user.ID, Owner: user.Username, Currency: "USD"}
+	assert.NoError(t, service.repo.DB.Create(account).Error)
+
+	frozen, err := service.freezeAccount(context.Background(), account.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AccountStatusFrozen, frozen.Status)
+
+	active, err := service.unfreezeAccount(context.Background(), account.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AccountStatusActive, active.Status)
+
+	_, err = service.freezeAccount(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestSetUserRole_RevokesSessions(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	assert.Equal(t, models.RoleCustomer, user.Role)
+
+	session := &models.Session{
+		ID:            uuid.New(),
+		FamilyID:      uuid.New(),
+		UserID:        user.ID,
+		TokenHash:     auth.HashRefreshToken(uuid.NewString()),
+		AccessTokenID: uuid.NewString(),
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, service.sessions.Create(context.Background(), session))
+
+	updated, err := service.setUserRole(context.Background(), user.ID, models.RoleTeller)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleTeller, updated.Role)
+
+	active, err := service.sessions.IsAccessTokenActive(context.Background(), session.AccessTokenID)
+	assert.NoError(t, err)
+	assert.False(t, active)
+
+	_, err = service.setUserRole(context.Background(), user.ID, "superuser")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = service.setUserRole(context.Background(), uuid.New(), models.RoleAdmin)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestSetUserRoleByUsername_Audits(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	session := &models.Session{
+		ID:            uuid.New(),
+		FamilyID:      uuid.New(),
+		UserID:        user.ID,
+		TokenHash:     auth.HashRefreshToken(uuid.NewString()),
+		AccessTokenID: uuid.NewString(),
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, service.sessions.Create(context.Background(), session))
+
+	updated, err := service.SetUserRoleByUsername(context.Background(), user.Username, models.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, updated.Role)
+
+	active, err := service.sessions.IsAccessTokenActive(context.Background(), session.AccessTokenID)
+	assert.NoError(t, err)
+	assert.False(t, active)
+
+	var entries []models.AuditLog
+	assert.NoError(t, service.repo.DB.Where("action = ? AND resource_id = ?", "admin.user.role", user.ID.String()).Find(&entries).Error)
+	assert.Len(t, entries, 1)
+	assert.Nil(t, entries[0].ActorID)
+	assert.JSONEq(t, `{"role":"customer"}`, entries[0].Before)
+	assert.NotEmpty(t, entries[0].Hash)
+
+	_, err = service.SetUserRoleByUsername(context.Background(), "nobody_"+uuid.NewString()[:8], models.RoleAdmin)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUnlockLogin(t *testing.T) {
+	service := setupTestService(t)
+	service.attempts = ratelimit.NewMemoryStore()
+	user := createTestUser(t, service)
+	policy := ratelimit.Policy{LockoutAfter: 1, LockoutDuration: time.Hour}
+	now := time.Now()
+
+	_, err := service.attempts.RecordFailure(context.Background(), ratelimit.LoginUsernameKey(user.Username), policy, now)
+	assert.NoError(t, err)
+	_, err = service.attempts.RecordFailure(context.Background(), ratelimit.LoginIPKey("10.1.2.3"), policy, now)
+	assert.NoError(t, err)
+
+	unlocked, err := service.unlockUser(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, unlocked.ID)
+	counter, err := service.attempts.Get(context.Background(), ratelimit.LoginUsernameKey(user.Username))
+	assert.NoError(t, err)
+	assert.False(t, counter.Blocked(now))
+
+	assert.ErrorIs(t, service.unlockIP(context.Background(), "not-an-ip"), ErrInvalidIP)
+	assert.NoError(t, service.unlockIP(context.Background(), "10.1.2.3"))
+	counter, err = service.attempts.Get(context.Background(), ratelimit.LoginIPKey("10.1.2.3"))
+	assert.NoError(t, err)
+	assert.False(t, counter.Blocked(now))
+
+	_, err = service.unlockUser(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
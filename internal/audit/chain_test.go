@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	actor := uuid.New()
+	entry := &models.AuditLog{
+		ActorID:      &actor,
+		ActorRole:    models.RoleCustomer,
+		Action:       "account.deposit",
+		ResourceType: "account",
+		ResourceID:   uuid.NewString(),
+		Before:       `{"balance":{"amount":"1.00","currency":"USD"}}`,
+		After:        `{"balance":{"amount":"2.00","currency":"USD"}}`,
+		StatusCode:   200,
+		ClientIP:     "203.0.113.7",
+		RequestID:    "req-1",
+		CreatedAt:    time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+	}
+	hash := Hash(entry)
+	assert.Len(t, hash, 64)
+
+	// The instant is hashed, not its zone
+	local := *entry
+	local.CreatedAt = entry.CreatedAt.In(time.FixedZone("EET", 2*60*60))
+	assert.Equal(t, hash, Hash(&local))
+	// ID and seq are assigned by the database and are not part of the hash
+	stored := *entry
+	stored.ID = uuid.New()
+	stored.Seq = 42
+	assert.Equal(t, hash, Hash(&stored))
+
+	edited := *entry
+	edited.After = `{"balance":{"amount":"20.00","currency":"USD"}}`
+	assert.NotEqual(t, hash, Hash(&edited))
+	relinked := *entry
+	relinked.PrevHash = hash
+	assert.NotEqual(t, hash, Hash(&relinked))
+	anonymous := *entry
+	anonymous.ActorID = nil
+	assert.NotEqual(t, hash, Hash(&anonymous))
+}
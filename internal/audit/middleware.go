@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request, from the client or generated by RequestID
+const RequestIDHeader = "X-Request-ID"
+
+// Context keys under which handlers leave details for the audit entry
+const (
+	requestIDKey  = "request_id"
+	detailsKey    = "audit_details"
+	beforeKey     = "audit_before"
+	afterKey      = "audit_after"
+	resourceIDKey = "audit_resource_id"
+	actorIDKey    = "audit_actor_id"
+)
+
+// RequestID returns a Gin middleware that gives every request an ID, taken from the
+// X-Request-ID header when the client sends a sensible one, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = uuid.NewString()
+		}
+		ctx.Set(requestIDKey, id)
+		ctx.Header(RequestIDHeader, id)
+		ctx.Next()
+	}
+}
+
+// Action returns a Gin middleware that records the request as action on resourceType once
+// the handler has run. The resource ID is taken from the :id path parameter unless the
+// handler sets one, and handlers can attach details with SetDetails and snapshots with
+// SetChanges. It must run after auth.UserMiddleware on authenticated routes.
+func Action(action, resourceType string) gin.HandlerFunc {
+	repo := InitRepository()
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		entry := &models.AuditLog{
+			ActorRole:    ctx.GetString(auth.RoleKey),
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   ctx.Param("id"),
+			StatusCode:   ctx.Writer.Status(),
+			ClientIP:     ctx.ClientIP(),
+			RequestID:    RequestIDFrom(ctx),
+		}
+		if id := ctx.GetString(resourceIDKey); id != "" {
+			entry.ResourceID = id
+		}
+		actor := ctx.GetString("user_id")
+		if actor == "" {
+			actor = ctx.GetString(actorIDKey)
+		}
+		if actorID, err := uuid.Parse(actor); err == nil {
+			entry.ActorID = &actorID
+		}
+		details, _ := ctx.Get(detailsKey)
+		if details == nil && ctx.Request.URL.RawQuery != "" {
+			details = gin.H{"query": ctx.Request.URL.RawQuery}
+		}
+		entry.Details = encode(details)
+		before, _ := ctx.Get(beforeKey)
+		entry.Before = encode(before)
+		after, _ := ctx.Get(afterKey)
+		entry.After = encode(after)
+
+		// The response has already been written, so a failure can only be logged
+		if err := repo.Record(ctx, entry); err != nil {
+			log.Printf("audit: failed to record %s on %s %s: %v", action, resourceType, entry.ResourceID, err)
+		}
+	}
+}
+
+// SetDetails attaches details to the audit entry of the current request
+func SetDetails(ctx *gin.Context, details any) {
+	ctx.Set(detailsKey, details)
+}
+
+// SetChanges attaches snapshots of the resource before and after the action; either can
+// be nil, e.g. before a resource is created
+func SetChanges(ctx *gin.Context, before, after any) {
+	ctx.Set(beforeKey, before)
+	ctx.Set(afterKey, after)
+}
+
+// SetResourceID names the resource of the audit entry when it is not the :id path parameter,
+// e.g. a transfer the request created
+func SetResourceID(ctx *gin.Context, id string) {
+	ctx.Set(resourceIDKey, id)
+}
+
+// SetActor names the actor of an unauthenticated request once it is known, e.g. after a login
+func SetActor(ctx *gin.Context, userID uuid.UUID) {
+	ctx.Set(actorIDKey, userID.String())
+}
+
+// RequestIDFrom returns the ID that RequestID gave the request of ctx, which can be the
+// *gin.Context itself or a context handed down from it
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// encode returns v as JSON, or an empty string for nil
+func encode(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"gorm.io/gorm"
+)
+
+// chainLock is the Postgres advisory lock that serializes appends to the hash chain
+const chainLock = 0x6175646974 // "audit"
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{
+		DB: db.DB,
+	}
+}
+
+// Record appends an entry to the audit log, chained to the entry before it. Appends are
+// serialized, so entries get their seq in the order of the chain.
+func (r *Repository) Record(ctx context.Context, entry *models.AuditLog) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLock).Error; err != nil {
+			return err
+		}
+		var last models.AuditLog
+		err := tx.Select("hash").Order("seq DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		// Postgres keeps microseconds; the hash must survive the round trip
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.PrevHash = last.Hash
+		entry.Hash = Hash(entry)
+		return tx.Create(entry).Error
+	})
+}
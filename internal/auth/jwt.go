@@ -1,38 +1,50 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/ahmedkhaeld/banking-app/common"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 const minSecretKeySize = 32
 
+// JWTMaker signs HS256 tokens with a shared secret
 type JWTMaker struct {
 	secretkey string
+	kid       string
 }
 
 func NewJWTMaker() (*JWTMaker, error) {
-	sk := os.Getenv("JWT_SECRET_KEY")
+	return NewHMACMaker(os.Getenv(common.JwtSecretKey))
+}
+
+// NewHMACMaker returns an HS256 maker for secret. The kid identifies the secret without revealing it.
+func NewHMACMaker(sk string) (*JWTMaker, error) {
 	if len(sk) < minSecretKeySize {
 		return nil, fmt.Errorf("invalid key size: %d must be at least %d char", len(sk), minSecretKeySize)
 	}
+	sum := sha256.Sum256([]byte(sk))
 
 	return &JWTMaker{
 		secretkey: sk,
+		kid:       "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
 	}, nil
 }
 
-func (maker *JWTMaker) CreateToken(userId string, duration time.Duration) (string, *Payload, error) {
+func (maker *JWTMaker) CreateToken(userId, role string, duration time.Duration) (string, *Payload, error) {
 
-	payload, err := NewPayload(userId, duration)
+	payload, err := NewPayload(userId, role, duration)
 	if err != nil {
 		return "", payload, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload.jwtClaims())
+	token.Header["kid"] = maker.kid
 
 	tokenString, err := token.SignedString([]byte(maker.secretkey))
 	return tokenString, payload, err
@@ -44,22 +56,12 @@ func (maker *JWTMaker) VerifyToken(tokenString string) (*Payload, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrUnexpectedMethod
 		}
+		// Tokens issued before kids were introduced have none
+		if kid, ok := token.Header["kid"].(string); ok && kid != maker.kid {
+			return nil, ErrUnknownKeyID
+		}
 
 		return []byte(maker.secretkey), nil
 	}
-	clms := &Payload{}
-
-	token, err := jwt.ParseWithClaims(tokenString, clms, keyFunc)
-	if err != nil {
-		ErrUnexpectedMethod = err
-		return nil, ErrUnexpectedMethod
-	}
-
-	claims, ok := token.Claims.(*Payload)
-	if !ok {
-		ErrInvalidToken = err
-		return nil, ErrInvalidToken
-	}
-	return claims, nil
-
+	return parsePayload(tokenString, keyFunc)
 }
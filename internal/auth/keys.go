@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadPrivateKeyPEM reads an RSA or Ed25519 private key from a PKCS#8 or PKCS#1 PEM file.
+func LoadPrivateKeyPEM(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w in %s: %s", ErrUnsupportedKey, path, block.Type)
+}
+
+// LoadPublicKeyPEM reads an RSA or Ed25519 public key from a PKIX or PKCS#1 PEM file.
+func LoadPublicKeyPEM(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			return k, nil
+		case ed25519.PublicKey:
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w in %s: %s", ErrUnsupportedKey, path, block.Type)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	return block, nil
+}
+
+// publicJWK describes key as a JWK; its kid is the RFC 7638 thumbprint of the key.
+func publicJWK(key crypto.PublicKey, alg string) (JWK, error) {
+	var jwk JWK
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		jwk = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}
+	default:
+		return JWK{}, ErrUnsupportedKey
+	}
+	// The thumbprint covers only the required members, in lexicographic order
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return JWK{}, err
+	}
+	sum := sha256.Sum256(data)
+	jwk.Kid = base64.RawURLEncoding.EncodeToString(sum[:])
+	jwk.Use = "sig"
+	jwk.Alg = alg
+	return jwk, nil
+}
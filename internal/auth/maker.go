@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+// TokenMaker creates and verifies access tokens
+type TokenMaker interface {
+	CreateToken(userId, role string, duration time.Duration) (string, *Payload, error)
+	VerifyToken(token string) (*Payload, error)
+}
+
+// KeyPublisher is implemented by token makers whose verification keys can be shared
+type KeyPublisher interface {
+	JWKS() JWKS
+}
+
+var (
+	defaultMaker     TokenMaker
+	defaultMakerErr  error
+	defaultMakerOnce sync.Once
+)
+
+// DefaultTokenMaker returns the token maker configured by the environment. Keys are
+// loaded once, on first use.
+func DefaultTokenMaker() (TokenMaker, error) {
+	defaultMakerOnce.Do(func() {
+		defaultMaker, defaultMakerErr = NewTokenMakerFromEnv()
+	})
+	return defaultMaker, defaultMakerErr
+}
+
+// Token formats selectable with TOKEN_FORMAT
+const (
+	TokenFormatJWT          = "jwt"
+	TokenFormatPasetoLocal  = "paseto-local"
+	TokenFormatPasetoPublic = "paseto-public"
+)
+
+// NewTokenMakerFromEnv builds a token maker from the environment. TOKEN_FORMAT picks the
+// format new tokens are issued in; every other format with keys configured is still
+// accepted, so switching formats does not log everyone out.
+//
+//	TOKEN_FORMAT                jwt (default), paseto-local or paseto-public
+//	JWT_SIGNING_ALG             HS256 (default), RS256 or EdDSA
+//	JWT_SECRET_KEY              HMAC secret for HS256
+//	JWT_SIGNING_KEY_FILE        PEM private key for RS256 / EdDSA
+//	JWT_VERIFICATION_KEY_FILES  comma-separated PEM public keys still accepted during rotation
+//	PASETO_LOCAL_KEY            hex-encoded 32-byte key for v4.local
+//	PASETO_SIGNING_KEY_FILE     PEM Ed25519 private key for v4.public
+func NewTokenMakerFromEnv() (TokenMaker, error) {
+	format := os.Getenv(common.TokenFormat)
+	if format == "" {
+		format = TokenFormatJWT
+	}
+
+	maker := &formatMaker{}
+	if format == TokenFormatJWT || os.Getenv(common.JwtSecretKey) != "" || os.Getenv(common.JwtSigningKeyFile) != "" {
+		jwtMaker, err := newJWTMakerFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		maker.jwt = jwtMaker
+	}
+	if format == TokenFormatPasetoLocal || os.Getenv(common.PasetoLocalKey) != "" {
+		key, err := hex.DecodeString(os.Getenv(common.PasetoLocalKey))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", common.PasetoLocalKey, err)
+		}
+		localMaker, err := NewPasetoLocalMaker(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", common.PasetoLocalKey, err)
+		}
+		maker.local = localMaker
+	}
+	if format == TokenFormatPasetoPublic || os.Getenv(common.PasetoSigningKeyFile) != "" {
+		keyFile := os.Getenv(common.PasetoSigningKeyFile)
+		if keyFile == "" {
+			return nil, fmt.Errorf("%s is required for %s", common.PasetoSigningKeyFile, format)
+		}
+		signingKey, err := LoadPrivateKeyPEM(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicMaker, err := NewPasetoPublicMaker(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		maker.public = publicMaker
+	}
+
+	switch format {
+	case TokenFormatJWT:
+		maker.issuer = maker.jwt
+	case TokenFormatPasetoLocal:
+		maker.issuer = maker.local
+	case TokenFormatPasetoPublic:
+		maker.issuer = maker.public
+	default:
+		return nil, fmt.Errorf("unsupported %s: %s", common.TokenFormat, format)
+	}
+	return maker, nil
+}
+
+// newJWTMakerFromEnv builds the JWT maker selected by JWT_SIGNING_ALG
+func newJWTMakerFromEnv() (TokenMaker, error) {
+	alg := os.Getenv(common.JwtSigningAlg)
+	if alg == "" || alg == jwt.SigningMethodHS256.Alg() {
+		return NewJWTMaker()
+	}
+
+	keyFile := os.Getenv(common.JwtSigningKeyFile)
+	if keyFile == "" {
+		return nil, fmt.Errorf("%s is required for %s", common.JwtSigningKeyFile, alg)
+	}
+	signingKey, err := LoadPrivateKeyPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var verificationKeys []crypto.PublicKey
+	for _, path := range strings.Split(os.Getenv(common.JwtVerificationKeyFiles), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := LoadPublicKeyPEM(path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return NewRSAMaker(signingKey, verificationKeys...)
+	case jwt.SigningMethodEdDSA.Alg():
+		return NewEd25519Maker(signingKey, verificationKeys...)
+	default:
+		return nil, fmt.Errorf("unsupported %s: %s", common.JwtSigningAlg, alg)
+	}
+}
+
+// formatMaker issues tokens with one maker and verifies each token with the maker for its format
+type formatMaker struct {
+	issuer TokenMaker
+	jwt    TokenMaker
+	local  TokenMaker
+	public TokenMaker
+}
+
+func (maker *formatMaker) CreateToken(userId, role string, duration time.Duration) (string, *Payload, error) {
+	return maker.issuer.CreateToken(userId, role, duration)
+}
+
+func (maker *formatMaker) VerifyToken(token string) (*Payload, error) {
+	var verifier TokenMaker
+	switch {
+	case strings.HasPrefix(token, pasetoLocalHeader):
+		verifier = maker.local
+	case strings.HasPrefix(token, pasetoPublicHeader):
+		verifier = maker.public
+	default:
+		verifier = maker.jwt
+	}
+	if verifier == nil {
+		return nil, ErrUnexpectedMethod
+	}
+	return verifier.VerifyToken(token)
+}
+
+// JWKS publishes the JWT verification keys, if the JWT maker has any
+func (maker *formatMaker) JWKS() JWKS {
+	if publisher, ok := maker.jwt.(KeyPublisher); ok {
+		return publisher.JWKS()
+	}
+	return JWKS{Keys: []JWK{}}
+}
+
+// asymmetricMaker signs with one private key and verifies with any of its public keys, selected by kid
+type asymmetricMaker struct {
+	method     jwt.SigningMethod
+	signingKID string
+	signingKey crypto.Signer
+	keys       map[string]crypto.PublicKey
+	jwks       JWKS
+}
+
+func newAsymmetricMaker(method jwt.SigningMethod, signingKey crypto.Signer, verificationKeys []crypto.PublicKey) (*asymmetricMaker, error) {
+	maker := &asymmetricMaker{
+		method:     method,
+		signingKey: signingKey,
+		keys:       map[string]crypto.PublicKey{},
+	}
+	for i, key := range append([]crypto.PublicKey{signingKey.Public()}, verificationKeys...) {
+		jwk, err := publicJWK(key, method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			maker.signingKID = jwk.Kid
+		}
+		if _, ok := maker.keys[jwk.Kid]; ok {
+			continue
+		}
+		maker.keys[jwk.Kid] = key
+		maker.jwks.Keys = append(maker.jwks.Keys, jwk)
+	}
+	return maker, nil
+}
+
+func (maker *asymmetricMaker) CreateToken(userId, role string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(userId, role, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	token := jwt.NewWithClaims(maker.method, payload.jwtClaims())
+	token.Header["kid"] = maker.signingKID
+	tokenString, err := token.SignedString(maker.signingKey)
+	return tokenString, payload, err
+}
+
+func (maker *asymmetricMaker) VerifyToken(tokenString string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != maker.method.Alg() {
+			return nil, ErrUnexpectedMethod
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		return key, nil
+	}
+	return parsePayload(tokenString, keyFunc)
+}
+
+func (maker *asymmetricMaker) JWKS() JWKS {
+	return maker.jwks
+}
+
+// RSAMaker signs RS256 tokens
+type RSAMaker struct {
+	*asymmetricMaker
+}
+
+// NewRSAMaker returns a maker that signs with signingKey and also accepts tokens signed by
+// the private halves of verificationKeys.
+func NewRSAMaker(signingKey crypto.Signer, verificationKeys ...crypto.PublicKey) (*RSAMaker, error) {
+	rsaKey, ok := signingKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: RS256 needs an RSA private key", ErrUnsupportedKey)
+	}
+	if rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("invalid key size: %d must be at least %d bits", rsaKey.N.BitLen(), minRSAKeyBits)
+	}
+	for _, key := range verificationKeys {
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: RS256 verification keys must be RSA", ErrUnsupportedKey)
+		}
+	}
+	maker, err := newAsymmetricMaker(jwt.SigningMethodRS256, signingKey, verificationKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &RSAMaker{maker}, nil
+}
+
+// Ed25519Maker signs EdDSA tokens
+type Ed25519Maker struct {
+	*asymmetricMaker
+}
+
+// NewEd25519Maker returns a maker that signs with signingKey and also accepts tokens signed by
+// the private halves of verificationKeys.
+func NewEd25519Maker(signingKey crypto.Signer, verificationKeys ...crypto.PublicKey) (*Ed25519Maker, error) {
+	if _, ok := signingKey.(ed25519.PrivateKey); !ok {
+		return nil, fmt.Errorf("%w: EdDSA needs an Ed25519 private key", ErrUnsupportedKey)
+	}
+	for _, key := range verificationKeys {
+		if _, ok := key.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: EdDSA verification keys must be Ed25519", ErrUnsupportedKey)
+		}
+	}
+	maker, err := newAsymmetricMaker(jwt.SigningMethodEdDSA, signingKey, verificationKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &Ed25519Maker{maker}, nil
+}
+
+// parsePayload verifies tokenString with keyFunc and returns its claims
+func parsePayload(tokenString string, keyFunc jwt.Keyfunc) (*Payload, error) {
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(TokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	payload := payloadFromClaims(claims)
+	if err := payload.Valid(); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// JWKSHandler serves the public verification keys of the default token maker.
+// HMAC makers have no public keys, so the set is empty.
+func JWKSHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		maker, err := DefaultTokenMaker()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "token maker is not configured"})
+			return
+		}
+		jwks := JWKS{Keys: []JWK{}}
+		if publisher, ok := maker.(KeyPublisher); ok {
+			jwks = publisher.JWKS()
+		}
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(http.StatusOK, jwks)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMACMaker_RoundTrip(t *testing.T) {
+	maker, err := NewHMACMaker("0123456789abcdef0123456789abcdef")
+	assert.NoError(t, err)
+
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	payload, err := maker.VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", payload.UserID())
+
+	other, err := NewHMACMaker("fedcba9876543210fedcba9876543210")
+	assert.NoError(t, err)
+	_, err = other.VerifyToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestHMACMaker_Expired(t *testing.T) {
+	maker, err := NewHMACMaker("0123456789abcdef0123456789abcdef")
+	assert.NoError(t, err)
+
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, -time.Minute)
+	assert.NoError(t, err)
+	_, err = maker.VerifyToken(token)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestEd25519Maker_Rotation(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	oldMaker, err := NewEd25519Maker(oldKey)
+	assert.NoError(t, err)
+	oldToken, _, err := oldMaker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+
+	// The new maker still accepts tokens signed by the retired key
+	newMaker, err := NewEd25519Maker(newKey, oldKey.Public())
+	assert.NoError(t, err)
+	_, err = newMaker.VerifyToken(oldToken)
+	assert.NoError(t, err)
+	assert.Len(t, newMaker.JWKS().Keys, 2)
+
+	// Once the retired key is dropped its tokens are rejected
+	rotated, err := NewEd25519Maker(newKey)
+	assert.NoError(t, err)
+	_, err = rotated.VerifyToken(oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestRSAMaker(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	maker, err := NewRSAMaker(key)
+	assert.NoError(t, err)
+
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	_, err = maker.VerifyToken(token)
+	assert.NoError(t, err)
+
+	jwks := maker.JWKS()
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "RS256", jwks.Keys[0].Alg)
+
+	// An HS256 token must not be accepted by an RS256 maker
+	hmac, err := NewHMACMaker("0123456789abcdef0123456789abcdef")
+	assert.NoError(t, err)
+	hsToken, _, err := hmac.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	_, err = maker.VerifyToken(hsToken)
+	assert.ErrorIs(t, err, ErrUnexpectedMethod)
+}
+
+func TestRSAMaker_RejectsWeakKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	_, err = NewRSAMaker(key)
+	assert.Error(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, err = NewRSAMaker(edKey)
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, err = NewEd25519Maker(edKey, crypto.PublicKey(&rsaKey.PublicKey))
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
@@ -13,16 +13,22 @@ const (
 	authorizationHeaderKey  = "Authorization"
 	authorizationTypeBearer = "Bearer"
 	authorizationPayloadKey = "authorization_payload"
+	// TokenIDKey is the context key of the access token's jti
+	TokenIDKey = "token_id"
+	// RoleKey is the context key of the caller's role
+	RoleKey = "role"
 )
 
 var (
 	ErrInvalidAuthorizationHeader = errors.New("invalid authorization header")
 	ErrInvalidAuthorizationType   = errors.New("invalid authorization type")
 	ErrInvalidAuthorizationFormat = errors.New("invalid authorization format")
+	ErrInsufficientRole           = errors.New("insufficient role for this operation")
 )
 
 // BearerMiddleware returns a Gin middleware for Bearer token authentication.
 func UserMiddleware() gin.HandlerFunc {
+	sessions := InitSessionRepository()
 	return func(ctx *gin.Context) {
 		header := strings.TrimSpace(ctx.GetHeader(authorizationHeaderKey))
 		if header == "" {
@@ -41,7 +47,7 @@ func UserMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenMaker, err := NewJWTMaker()
+		tokenMaker, err := DefaultTokenMaker()
 		if err != nil {
 			log.Fatalf("Error creating token maker: %v", err)
 		}
@@ -53,17 +59,54 @@ func UserMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Reject access tokens whose session was revoked by logout, rotation or reuse detection
+		active, err := sessions.IsAccessTokenActive(ctx, payload.TokenID())
+		if err != nil {
+			httpUnauthorized(ctx, err)
+			return
+		}
+		if !active {
+			httpUnauthorized(ctx, ErrSessionRevoked)
+			return
+		}
+
 		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Set(TokenIDKey, payload.TokenID())
 
 		// Extract user identifier from payload and set in context
-		if sub, ok := payload.MapClaims["sub"].(string); ok {
-			ctx.Set("user_id", sub)
-		}
+		ctx.Set("user_id", payload.UserID())
+		ctx.Set(RoleKey, payload.UserRole())
 
 		ctx.Next()
 	}
 }
 
+// RequireRole returns a Gin middleware that only lets callers with one of roles through.
+// It must run after UserMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !HasRole(ctx, roles...) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":  ErrInsufficientRole.Error(),
+				"status": http.StatusForbidden,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// HasRole reports whether the authenticated caller has one of roles
+func HasRole(ctx *gin.Context, roles ...string) bool {
+	role := ctx.GetString(RoleKey)
+	for _, r := range roles {
+		if role != "" && role == r {
+			return true
+		}
+	}
+	return false
+}
+
 func httpUnauthorized(ctx *gin.Context, err error) {
 	ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 		"error":  err.Error(),
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		role   string
+		status int
+	}{
+		{models.RoleAdmin, http.StatusOK},
+		{models.RoleTeller, http.StatusOK},
+		{models.RoleCustomer, http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		router := gin.New()
+		router.GET("/", func(ctx *gin.Context) {
+			if tc.role != "" {
+				ctx.Set(RoleKey, tc.role)
+			}
+			ctx.Next()
+		}, RequireRole(models.RoleTeller, models.RoleAdmin), func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, tc.status, w.Code, "role %q", tc.role)
+	}
+}
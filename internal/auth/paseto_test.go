@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLocalMaker(t *testing.T) *PasetoMaker {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	maker, err := NewPasetoLocalMaker(key)
+	assert.NoError(t, err)
+	return maker
+}
+
+func TestPasetoLocal_RoundTrip(t *testing.T) {
+	maker := newTestLocalMaker(t)
+
+	token, issued, err := maker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v4.local."))
+	assert.NotContains(t, token, "user-1")
+
+	payload, err := maker.VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", payload.UserID())
+	assert.Equal(t, issued.TokenID(), payload.TokenID())
+	assert.Equal(t, TokenIssuer, payload.Issuer)
+	assert.Equal(t, TokenAudience, payload.Audience)
+	assert.True(t, issued.ExpiresAt.Equal(payload.ExpiresAt))
+
+	_, err = newTestLocalMaker(t).VerifyToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPasetoLocal_Tampered(t *testing.T) {
+	maker := newTestLocalMaker(t)
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+
+	body, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, pasetoLocalHeader))
+	assert.NoError(t, err)
+	body[40] ^= 1
+	_, err = maker.VerifyToken(pasetoLocalHeader + base64.RawURLEncoding.EncodeToString(body))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = maker.VerifyToken(token + ".Zm9vdGVy")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPasetoLocal_Expired(t *testing.T) {
+	maker := newTestLocalMaker(t)
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, -time.Minute)
+	assert.NoError(t, err)
+	_, err = maker.VerifyToken(token)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestPasetoLocal_InvalidKey(t *testing.T) {
+	_, err := NewPasetoLocalMaker([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidPasetoKey)
+}
+
+func TestPasetoPublic_RoundTrip(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	maker, err := NewPasetoPublicMaker(key)
+	assert.NoError(t, err)
+
+	token, _, err := maker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v4.public."))
+	payload, err := maker.VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", payload.UserID())
+
+	// A local token is not accepted by a public maker
+	localToken, _, err := newTestLocalMaker(t).CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	_, err = maker.VerifyToken(localToken)
+	assert.ErrorIs(t, err, ErrUnexpectedMethod)
+}
+
+// Test vector 4-S-1 from the PASETO specification
+func TestPasetoPublic_SpecVector(t *testing.T) {
+	secretKey, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	assert.NoError(t, err)
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	expected := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	signature := ed25519.Sign(ed25519.PrivateKey(secretKey), pae([]byte(pasetoPublicHeader), message, nil, nil))
+	assert.Equal(t, expected, pasetoPublicHeader+base64.RawURLEncoding.EncodeToString(append(message, signature...)))
+}
+
+func TestPAE(t *testing.T) {
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x00\x00\x00\x00"), pae())
+	assert.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00test"), pae([]byte("test")))
+}
+
+func TestNewTokenMakerFromEnv_Migration(t *testing.T) {
+	t.Setenv("JWT_SIGNING_ALG", "")
+	t.Setenv("JWT_SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("PASETO_LOCAL_KEY", "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	t.Setenv("PASETO_SIGNING_KEY_FILE", "")
+
+	t.Setenv("TOKEN_FORMAT", "jwt")
+	jwtMaker, err := NewTokenMakerFromEnv()
+	assert.NoError(t, err)
+	jwtToken, _, err := jwtMaker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+
+	t.Setenv("TOKEN_FORMAT", "paseto-local")
+	pasetoMaker, err := NewTokenMakerFromEnv()
+	assert.NoError(t, err)
+	pasetoToken, _, err := pasetoMaker.CreateToken("user-1", models.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(pasetoToken, pasetoLocalHeader))
+
+	// Tokens of both formats verify while both are configured
+	_, err = pasetoMaker.VerifyToken(jwtToken)
+	assert.NoError(t, err)
+	_, err = jwtMaker.VerifyToken(pasetoToken)
+	assert.NoError(t, err)
+
+	t.Setenv("TOKEN_FORMAT", "paseto-public")
+	_, err = NewTokenMakerFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("TOKEN_FORMAT", "bogus")
+	_, err = NewTokenMakerFromEnv()
+	assert.Error(t, err)
+}
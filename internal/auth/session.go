@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const refreshTokenBytes = 32
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+)
+
+// SessionRepository stores refresh tokens and answers whether an access token's session is still active.
+type SessionRepository struct {
+	DB *gorm.DB
+}
+
+func InitSessionRepository() *SessionRepository {
+	return &SessionRepository{
+		DB: db.DB,
+	}
+}
+
+// WithTx returns a copy of the repository that runs on tx, so that sessions can be revoked
+// in the same transaction as the change that invalidates them
+func (r *SessionRepository) WithTx(tx *gorm.DB) *SessionRepository {
+	return &SessionRepository{DB: tx}
+}
+
+// NewRefreshToken returns an opaque random refresh token and the hash to store for it.
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the value stored in sessions.token_hash for token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a new session
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return r.DB.WithContext(ctx).Create(session).Error
+}
+
+// Rotate consumes the refresh token and stores the session returned by issue in the same
+// family. Replaying a token that was already rotated or revoked revokes every session of its family.
+func (r *SessionRepository) Rotate(ctx context.Context, refreshToken string, issue func(userID uuid.UUID) (*models.Session, error)) error {
+	var reused bool
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", HashRefreshToken(refreshToken)).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if current.RevokedAt != nil || current.ReplacedByID != nil {
+			reused = true
+			return revokeFamily(tx, current.FamilyID)
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		next, err := issue(current.UserID)
+		if err != nil {
+			return err
+		}
+		next.FamilyID = current.FamilyID
+		next.UserID = current.UserID
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		return tx.Model(&current).Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"replaced_by_id": next.ID,
+		}).Error
+	})
+	if err == nil && reused {
+		return ErrRefreshTokenReused
+	}
+	return err
+}
+
+// RevokeByAccessTokenID revokes the whole family of the session that issued the access token.
+func (r *SessionRepository) RevokeByAccessTokenID(ctx context.Context, accessTokenID string) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.Where("access_token_id = ?", accessTokenID).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		if err != nil {
+			return err
+		}
+		return revokeFamily(tx, session.FamilyID)
+	})
+}
+
+// RevokeUser revokes every session of a user, e.g. after a password change.
+func (r *SessionRepository) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	return r.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsAccessTokenActive reports whether the session that issued the access token is still live.
+func (r *SessionRepository) IsAccessTokenActive(ctx context.Context, accessTokenID string) (bool, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("access_token_id = ? AND revoked_at IS NULL", accessTokenID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func revokeFamily(tx *gorm.DB, familyID uuid.UUID) error {
+	return tx.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
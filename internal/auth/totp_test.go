@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B, SHA1 vectors
+func TestHOTP_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, hotp(key, totpStep(time.Unix(unix, 0)), 8), "t=%d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+
+	code, err := TOTPCode(secret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	s, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), s)
+
+	// One period of drift is tolerated, two are not
+	_, ok = ValidateTOTP(secret, code, now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(90*time.Second))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "000000", now)
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(secret, "28708", now)
+	assert.False(t, ok)
+	_, ok = ValidateTOTP("not base32!", code, now)
+	assert.False(t, ok)
+}
+
+func TestGenerateTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	code, err := TOTPCode(secret, time.Now())
+	assert.NoError(t, err)
+	_, ok := ValidateTOTP(secret, code, time.Now())
+	assert.True(t, ok)
+
+	uri, err := url.Parse(TOTPProvisioningURI("Banking App", "ahmed@example.com", secret))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.True(t, strings.HasSuffix(uri.Path, ":ahmed@example.com"))
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Banking App", uri.Query().Get("issuer"))
+}
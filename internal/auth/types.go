@@ -2,47 +2,133 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+const (
+	// TokenIssuer and TokenAudience are stamped into every access token and checked on verification
+	TokenIssuer   = "banking-app"
+	TokenAudience = "banking-app-api"
+)
+
 var (
 	ErrExpiredToken     = errors.New("token has expired")
 	ErrInvalidToken     = errors.New("token is invalid")
 	ErrUnexpectedMethod = errors.New("unexpected signing method")
 )
 
+// Payload holds the claims of an access token, independent of the token format
 type Payload struct {
-	jwt.MapClaims
+	ID        string    `json:"jti"`
+	Issuer    string    `json:"iss"`
+	Audience  string    `json:"aud"`
+	Subject   string    `json:"sub"`
+	Role      string    `json:"role"`
+	IssuedAt  time.Time `json:"iat"`
+	NotBefore time.Time `json:"nbf"`
+	ExpiresAt time.Time `json:"exp"`
 }
 
-func NewPayload(userId string, duration time.Duration) (*Payload, error) {
+func NewPayload(userId, role string, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Payload{MapClaims: jwt.MapClaims{
-		"iss": tokenID,
-		"sub": userId,
-		"aud": userId,
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(duration).Unix(),
-		"nbf": time.Now().Unix(),
-		"jti": uuid.New().String(),
-	},
+	now := time.Now().UTC().Truncate(time.Second)
+	return &Payload{
+		ID:        tokenID.String(),
+		Issuer:    TokenIssuer,
+		Audience:  TokenAudience,
+		Subject:   userId,
+		Role:      role,
+		IssuedAt:  now,
+		NotBefore: now,
+		ExpiresAt: now.Add(duration),
 	}, nil
 }
 
+// Valid checks the time window, issuer and audience of the payload
 func (payload *Payload) Valid() error {
-	expiration, err := payload.GetExpirationTime()
-	if err != nil {
-		return err
-	}
-	if time.Now().After(expiration.Time) {
+	now := time.Now()
+	if now.After(payload.ExpiresAt) {
 		return ErrExpiredToken
 	}
+	if now.Before(payload.NotBefore) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if payload.Issuer != TokenIssuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, payload.Issuer)
+	}
+	if payload.Audience != TokenAudience {
+		return fmt.Errorf("%w: unexpected audience %q", ErrInvalidToken, payload.Audience)
+	}
+	if payload.Subject == "" || payload.ID == "" {
+		return fmt.Errorf("%w: missing subject or token id", ErrInvalidToken)
+	}
 	return nil
 }
+
+// TokenID returns the jti claim
+func (payload *Payload) TokenID() string {
+	return payload.ID
+}
+
+// UserID returns the sub claim
+func (payload *Payload) UserID() string {
+	return payload.Subject
+}
+
+// UserRole returns the role claim
+func (payload *Payload) UserRole() string {
+	return payload.Role
+}
+
+// jwtClaims is the JWT form of a Payload
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+}
+
+// jwtClaims converts the payload to its JWT form
+func (payload *Payload) jwtClaims() jwtClaims {
+	return jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        payload.ID,
+			Issuer:    payload.Issuer,
+			Audience:  jwt.ClaimStrings{payload.Audience},
+			Subject:   payload.Subject,
+			IssuedAt:  jwt.NewNumericDate(payload.IssuedAt),
+			NotBefore: jwt.NewNumericDate(payload.NotBefore),
+			ExpiresAt: jwt.NewNumericDate(payload.ExpiresAt),
+		},
+		Role: payload.Role,
+	}
+}
+
+// payloadFromClaims converts verified JWT claims back to a Payload
+func payloadFromClaims(claims *jwtClaims) *Payload {
+	payload := &Payload{
+		ID:      claims.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Role:    claims.Role,
+	}
+	if len(claims.Audience) > 0 {
+		payload.Audience = claims.Audience[0]
+	}
+	if claims.IssuedAt != nil {
+		payload.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.NotBefore != nil {
+		payload.NotBefore = claims.NotBefore.Time
+	}
+	if claims.ExpiresAt != nil {
+		payload.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return payload
+}
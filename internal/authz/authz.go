@@ -0,0 +1,72 @@
+// Package authz decides which resources an authenticated caller may see. Read paths load
+// the resource first and then ask CanView; callers that may not see it get the same 404 as
+// for a resource that does not exist, so IDs cannot be probed.
+package authz
+
+import (
+	"errors"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var ErrNoSubject = errors.New("user_id not found in context")
+
+// Subject is the authenticated caller
+type Subject struct {
+	UserID uuid.UUID
+	Role   string
+}
+
+// IsStaff reports whether the subject is a teller or an admin
+func (s Subject) IsStaff() bool {
+	return s.Role == models.RoleTeller || s.Role == models.RoleAdmin
+}
+
+// SubjectFromContext returns the caller set by auth.UserMiddleware
+func SubjectFromContext(ctx *gin.Context) (Subject, error) {
+	userID, err := uuid.Parse(ctx.GetString("user_id"))
+	if err != nil {
+		return Subject{}, ErrNoSubject
+	}
+	return Subject{UserID: userID, Role: ctx.GetString(auth.RoleKey)}, nil
+}
+
+// CanView reports whether subject may read resource. Staff may read everything. Customers
+// may read their own user and accounts, and transfers where they own either account; the
+// transfer must be loaded with FromAccount and ToAccount, and their own scheduled transfers.
+// Unknown resource types are denied.
+func CanView(subject Subject, resource any) bool {
+	if subject.IsStaff() {
+		return true
+	}
+	switch r := resource.(type) {
+	case *models.User:
+		return r != nil && r.ID == subject.UserID
+	case *models.Account:
+		return r != nil && !r.IsSystem && r.UserID == subject.UserID
+	case *models.Transfer:
+		if r == nil {
+			return false
+		}
+		return CanView(subject, r.FromAccount) || CanView(subject, r.ToAccount)
+	case *models.ScheduledTransfer:
+		return r != nil && r.UserID == subject.UserID
+	default:
+		return false
+	}
+}
+
+// CanReverse reports whether subject may reverse a transfer: admins, and the owner of the
+// account that received it. The transfer must be loaded with ToAccount.
+func CanReverse(subject Subject, transfer *models.Transfer) bool {
+	if transfer == nil {
+		return false
+	}
+	if subject.Role == models.RoleAdmin {
+		return true
+	}
+	return transfer.ToAccount != nil && !transfer.ToAccount.IsSystem && transfer.ToAccount.UserID == subject.UserID
+}
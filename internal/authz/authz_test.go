@@ -0,0 +1,78 @@
+package authz
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanView(t *testing.T) {
+	alice := Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	bob := Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	teller := Subject{UserID: uuid.New(), Role: models.RoleTeller}
+
+	aliceAccount := &models.Account{ID: uuid.New(), UserID: alice.UserID}
+	bobAccount := &models.Account{ID: uuid.New(), UserID: bob.UserID}
+	transfer := &models.Transfer{FromAccount: aliceAccount, ToAccount: bobAccount}
+	carol := Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+
+	assert.True(t, CanView(alice, &models.User{ID: alice.UserID}))
+	assert.False(t, CanView(alice, &models.User{ID: bob.UserID}))
+	assert.True(t, CanView(teller, &models.User{ID: bob.UserID}))
+
+	assert.True(t, CanView(alice, aliceAccount))
+	assert.False(t, CanView(alice, bobAccount))
+	assert.True(t, CanView(teller, bobAccount))
+	assert.False(t, CanView(alice, &models.Account{UserID: alice.UserID, IsSystem: true}))
+
+	assert.True(t, CanView(alice, transfer))
+	assert.True(t, CanView(bob, transfer))
+	assert.False(t, CanView(carol, transfer))
+	assert.False(t, CanView(alice, &models.Transfer{}))
+
+	standingOrder := &models.ScheduledTransfer{UserID: alice.UserID, ToAccountID: bobAccount.ID}
+	assert.True(t, CanView(alice, standingOrder))
+	assert.False(t, CanView(bob, standingOrder))
+	assert.True(t, CanView(teller, standingOrder))
+
+	var nilAccount *models.Account
+	assert.False(t, CanView(alice, nilAccount))
+	assert.False(t, CanView(alice, "something else"))
+}
+
+func TestCanReverse(t *testing.T) {
+	alice := Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	bob := Subject{UserID: uuid.New(), Role: models.RoleCustomer}
+	teller := Subject{UserID: uuid.New(), Role: models.RoleTeller}
+	admin := Subject{UserID: uuid.New(), Role: models.RoleAdmin}
+
+	transfer := &models.Transfer{
+		FromAccount: &models.Account{UserID: alice.UserID},
+		ToAccount:   &models.Account{UserID: bob.UserID},
+	}
+	assert.True(t, CanReverse(bob, transfer))
+	assert.True(t, CanReverse(admin, transfer))
+	assert.False(t, CanReverse(alice, transfer))
+	assert.False(t, CanReverse(teller, transfer))
+	assert.False(t, CanReverse(bob, &models.Transfer{}))
+	assert.False(t, CanReverse(admin, nil))
+}
+
+func TestSubjectFromContext(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, err := SubjectFromContext(ctx)
+	assert.ErrorIs(t, err, ErrNoSubject)
+
+	userID := uuid.New()
+	ctx.Set("user_id", userID.String())
+	ctx.Set(auth.RoleKey, models.RoleAdmin)
+	subject, err := SubjectFromContext(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, subject.UserID)
+	assert.True(t, subject.IsStaff())
+}
@@ -0,0 +1,137 @@
+// Package events publishes domain events through a transactional outbox. A change and the
+// events describing it commit together in one transaction; a relay then hands the events to
+// a Publisher. Delivery is at least once, and every event carries an ID to drop duplicates.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Event types
+const (
+	TransferCompleted = "transfer.completed"
+	AccountCreated    = "account.created"
+	UserRegistered    = "user.registered"
+	BalanceChanged    = "balance.changed"
+	AccountFrozen     = "account.frozen"
+)
+
+// Aggregate types
+const (
+	AggregateTransfer = "transfer"
+	AggregateAccount  = "account"
+	AggregateUser     = "user"
+)
+
+// Publisher backends selectable with EVENTS_PUBLISHER
+const (
+	PublisherLog  = "log"
+	PublisherNATS = "nats"
+)
+
+// SubjectPrefix prefixes the event type in the NATS subject, e.g. banking.transfer.completed
+const SubjectPrefix = "banking"
+
+// Errors
+var (
+	ErrUnknownPublisher = errors.New("unknown events publisher")
+	// ErrUndeliverable is wrapped by Undeliverable
+	ErrUndeliverable = errors.New("event cannot be delivered")
+)
+
+// Event is a published domain event
+type Event struct {
+	// ID is unique per event and stays the same when the event is published again
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   uuid.UUID       `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// BalanceChangedData is the payload of BalanceChanged, one per customer account in a journal
+type BalanceChangedData struct {
+	AccountID  uuid.UUID   `json:"account_id"`
+	UserID     uuid.UUID   `json:"user_id"`
+	JournalID  uuid.UUID   `json:"journal_id"`
+	Kind       string      `json:"kind"`
+	TransferID *uuid.UUID  `json:"transfer_id,omitempty"`
+	Amount     money.Money `json:"amount"`
+	Balance    money.Money `json:"balance"`
+}
+
+// UserRegisteredData is the payload of UserRegistered
+type UserRegisteredData struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+}
+
+// Publisher delivers events to consumers. Publish may be called again with an event it
+// already delivered.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Undeliverable marks err as one that retrying cannot fix, e.g. a payload the subscriber
+// cannot decode, so that the relay parks the event instead of retrying it
+func Undeliverable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUndeliverable, err)
+}
+
+// Record adds an event to the outbox inside tx, so that it is published if and only if tx
+// commits
+func Record(tx *gorm.DB, eventType, aggregateType string, aggregateID uuid.UUID, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("events: encoding %s payload: %w", eventType, err)
+	}
+	return tx.Create(&models.OutboxEvent{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       string(data),
+	}).Error
+}
+
+// fromOutbox returns the event stored in an outbox row
+func fromOutbox(row *models.OutboxEvent) Event {
+	return Event{
+		ID:            row.ID,
+		Type:          row.Type,
+		AggregateType: row.AggregateType,
+		AggregateID:   row.AggregateID,
+		Payload:       json.RawMessage(row.Payload),
+		OccurredAt:    row.CreatedAt,
+	}
+}
+
+// InitPublisher returns the publisher configured by EVENTS_PUBLISHER: log (default), which
+// writes events to the application log, or nats, which publishes them to NATS_URL
+func InitPublisher() (Publisher, error) {
+	switch kind := strings.TrimSpace(os.Getenv(common.EventsPublisher)); kind {
+	case "", PublisherLog:
+		return NewLogPublisher(nil), nil
+	case PublisherNATS:
+		url := os.Getenv(common.NatsURL)
+		if url == "" {
+			url = "nats://127.0.0.1:4222"
+		}
+		return NewNATSPublisher(url, SubjectPrefix)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPublisher, kind)
+	}
+}
@@ -0,0 +1,251 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEvent(eventType string) Event {
+	return Event{
+		ID:            uuid.New(),
+		Type:          eventType,
+		AggregateType: AggregateAccount,
+		AggregateID:   uuid.New(),
+		Payload:       json.RawMessage(`{"amount":"1.00"}`),
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	assert.NoError(t, publisher.Publish(context.Background(), testEvent(AccountCreated)))
+	assert.NoError(t, publisher.Publish(context.Background(), testEvent(BalanceChanged)))
+
+	publisher.Err = assert.AnError
+	assert.ErrorIs(t, publisher.Publish(context.Background(), testEvent(BalanceChanged)), assert.AnError)
+
+	assert.Len(t, publisher.Events(), 2)
+	assert.Len(t, publisher.OfType(BalanceChanged), 1)
+}
+
+func TestLogPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := NewLogPublisher(log.New(&buf, "", 0))
+	event := testEvent(TransferCompleted)
+	assert.NoError(t, publisher.Publish(context.Background(), event))
+	assert.Contains(t, buf.String(), event.ID.String())
+	assert.Contains(t, buf.String(), `"type":"transfer.completed"`)
+}
+
+func TestInitPublisher(t *testing.T) {
+	t.Setenv(common.EventsPublisher, "")
+	publisher, err := InitPublisher()
+	assert.NoError(t, err)
+	assert.IsType(t, &LogPublisher{}, publisher)
+
+	t.Setenv(common.EventsPublisher, "kafka")
+	_, err = InitPublisher()
+	assert.ErrorIs(t, err, ErrUnknownPublisher)
+
+	t.Setenv(common.EventsPublisher, PublisherNATS)
+	t.Setenv(common.NatsURL, "http://localhost")
+	_, err = InitPublisher()
+	assert.ErrorIs(t, err, ErrNATS)
+}
+
+func TestRelayIntervalFromEnv(t *testing.T) {
+	for spec, want := range map[string]time.Duration{"": time.Second, "off": 0, "250ms": 250 * time.Millisecond} {
+		t.Setenv(common.OutboxRelayInterval, spec)
+		got, err := relayIntervalFromEnv()
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	t.Setenv(common.OutboxRelayInterval, "-1s")
+	_, err := relayIntervalFromEnv()
+	assert.Error(t, err)
+}
+
+// natsMessage is a message received by fakeNATS
+type natsMessage struct {
+	subject string
+	header  string
+	payload []byte
+}
+
+// fakeNATS serves one client connection with the parts of the NATS protocol the publisher
+// uses. Messages on a subject ending in .refused are answered with -ERR.
+func fakeNATS(t *testing.T) (string, <-chan natsMessage, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan natsMessage, 10)
+	connects := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				io.WriteString(conn, "INFO {\"server_id\":\"fake\",\"headers\":true}\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					if len(fields) == 0 {
+						continue
+					}
+					switch fields[0] {
+					case "CONNECT":
+						connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+					case "PING":
+						io.WriteString(conn, "PONG\r\n")
+					case "HPUB":
+						headerLen, _ := strconv.Atoi(fields[2])
+						total, _ := strconv.Atoi(fields[3])
+						body := make([]byte, total+2)
+						if _, err := io.ReadFull(r, body); err != nil {
+							return
+						}
+						if strings.HasSuffix(fields[1], ".refused") {
+							io.WriteString(conn, "-ERR 'Permissions Violation'\r\n")
+							continue
+						}
+						messages <- natsMessage{subject: fields[1], header: string(body[:headerLen]), payload: body[headerLen:total]}
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), messages, connects
+}
+
+func TestNATSPublisher(t *testing.T) {
+	addr, messages, connects := fakeNATS(t)
+	publisher, err := NewNATSPublisher("nats://svc:secret@"+addr, SubjectPrefix)
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	event := testEvent(TransferCompleted)
+	assert.NoError(t, publisher.Publish(context.Background(), event))
+	connect := <-connects
+	assert.Contains(t, connect, `"user":"svc"`)
+	assert.Contains(t, connect, `"headers":true`)
+
+	msg := <-messages
+	assert.Equal(t, "banking.transfer.completed", msg.subject)
+	assert.Contains(t, msg.header, "Nats-Msg-Id: "+event.ID.String())
+	var got Event
+	assert.NoError(t, json.Unmarshal(msg.payload, &got))
+	assert.Equal(t, event.ID, got.ID)
+	assert.JSONEq(t, string(event.Payload), string(got.Payload))
+
+	// A refused message is an error, and the publisher reconnects for the next one
+	err = publisher.Publish(context.Background(), testEvent("refused"))
+	assert.ErrorIs(t, err, ErrNATS)
+	assert.NoError(t, publisher.Publish(context.Background(), testEvent(AccountCreated)))
+	assert.Equal(t, "banking.account.created", (<-messages).subject)
+	assert.Len(t, connects, 1)
+}
+
+func TestNewNATSPublisher(t *testing.T) {
+	publisher, err := NewNATSPublisher("nats://token123@nats", SubjectPrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, "nats:4222", publisher.addr)
+	assert.Equal(t, "token123", publisher.connect.AuthToken)
+
+	_, err = NewNATSPublisher("localhost:4222", SubjectPrefix)
+	assert.ErrorIs(t, err, ErrNATS)
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	account := uuid.New()
+	changed, stop := hub.Subscribe(account)
+	other, stopOther := hub.Subscribe(uuid.New())
+	defer stopOther()
+
+	// Notifications coalesce and never block the notifier
+	hub.Notify(account)
+	hub.Notify(account, uuid.New())
+	select {
+	case <-changed:
+	default:
+		t.Fatal("listener was not notified")
+	}
+	select {
+	case <-changed:
+		t.Fatal("notifications were not coalesced")
+	case <-other:
+		t.Fatal("listener of another account was notified")
+	default:
+	}
+
+	stop()
+	hub.Notify(account)
+	select {
+	case <-changed:
+		t.Fatal("stopped listener was notified")
+	default:
+	}
+	assert.NotContains(t, hub.listeners, account)
+}
+
+func TestHub_AfterCommit(t *testing.T) {
+	hub := NewHub()
+	account := uuid.New()
+	changed, stop := hub.Subscribe(account)
+	defer stop()
+
+	// A transaction in a savepoint of another hands its accounts to the outer one
+	ctx, outerCommitted := hub.AfterCommit(context.Background())
+	innerCtx, innerCommitted := hub.AfterCommit(ctx)
+	assert.Equal(t, ctx, innerCtx)
+	innerCommitted(account)
+	select {
+	case <-changed:
+		t.Fatal("listener was notified before the outer transaction committed")
+	default:
+	}
+	outerCommitted()
+	select {
+	case <-changed:
+	default:
+		t.Fatal("listener was not notified after the outer transaction committed")
+	}
+
+	// Without an enclosing transaction the accounts are notified right away
+	_, committed := hub.AfterCommit(context.Background())
+	committed(account)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("listener was not notified")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 4*time.Second, retryDelay(3))
+	assert.Equal(t, retryCap, retryDelay(100))
+	assert.ErrorIs(t, Undeliverable(io.ErrUnexpectedEOF), ErrUndeliverable)
+	assert.ErrorIs(t, Undeliverable(io.ErrUnexpectedEOF), io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Hub wakes listeners in this process when an account has new events in the outbox. It
+// carries no events itself: a woken listener reads what it has not seen from the outbox,
+// so notifications may be coalesced or dropped without losing events.
+type Hub struct {
+	mu        sync.Mutex
+	listeners map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{listeners: make(map[uuid.UUID]map[chan struct{}]struct{})}
+}
+
+// Live is the hub that money movements notify after they commit
+var Live = NewHub()
+
+// pending holds the accounts changed by a transaction and the savepoints inside it
+type pending struct {
+	mu         sync.Mutex
+	accountIDs []uuid.UUID
+}
+
+// Subscribe returns a channel that receives a value after accountID changes, and a function
+// that stops the subscription
+func (h *Hub) Subscribe(accountID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listeners[accountID] == nil {
+		h.listeners[accountID] = make(map[chan struct{}]struct{})
+	}
+	h.listeners[accountID][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.listeners[accountID], ch)
+		if len(h.listeners[accountID]) == 0 {
+			delete(h.listeners, accountID)
+		}
+	}
+}
+
+// Notify wakes the listeners of accountIDs. It never blocks; a listener that has not
+// caught up with its last notification gets no second one.
+func (h *Hub) Notify(accountIDs ...uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range accountIDs {
+		for ch := range h.listeners[id] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// AfterCommit returns a context for a transaction and a function to call with the accounts
+// it changed once it has committed. When ctx belongs to an enclosing transaction, which runs
+// this one in a savepoint, the accounts are handed to it instead, and its listeners are only
+// woken after the outermost transaction commits; if that one rolls back they never are.
+func (h *Hub) AfterCommit(ctx context.Context) (context.Context, func(accountIDs ...uuid.UUID)) {
+	if outer, ok := ctx.Value(h).(*pending); ok {
+		return ctx, func(accountIDs ...uuid.UUID) {
+			outer.mu.Lock()
+			defer outer.mu.Unlock()
+			outer.accountIDs = append(outer.accountIDs, accountIDs...)
+		}
+	}
+	p := &pending{}
+	return context.WithValue(ctx, h, p), func(accountIDs ...uuid.UUID) {
+		p.mu.Lock()
+		accountIDs = append(p.accountIDs, accountIDs...)
+		p.accountIDs = nil
+		p.mu.Unlock()
+		h.Notify(accountIDs...)
+	}
+}
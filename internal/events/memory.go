@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// MemoryPublisher keeps published events in memory, for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	// Err, when set, fails every Publish
+	Err error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns every event published so far
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
+
+// OfType returns the events of eventType published so far
+func (p *MemoryPublisher) OfType(eventType string) []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matched []Event
+	for _, e := range p.events {
+		if e.Type == eventType {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// LogPublisher writes each event as a JSON line to a logger
+type LogPublisher struct {
+	logger *log.Logger
+}
+
+// NewLogPublisher returns a publisher writing to logger, or to the standard logger when nil
+func NewLogPublisher(logger *log.Logger) *LogPublisher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.logger.Printf("event: %s", data)
+	return nil
+}
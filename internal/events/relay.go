@@ -0,0 +1,241 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// relayBatchSize is the number of rows claimed per transaction
+	relayBatchSize = 100
+	// retryBase is the wait after the first failed delivery to a subscriber; it doubles with
+	// every further one
+	retryBase = time.Second
+	// retryCap bounds the wait between attempts
+	retryCap = 5 * time.Minute
+)
+
+// SubscriberPublisher names the subscriber for the publisher selected by EVENTS_PUBLISHER
+const SubscriberPublisher = "publisher"
+
+// Subscriber is a publisher the relay hands every event to. The name keys its deliveries,
+// so it must stay the same across restarts.
+type Subscriber struct {
+	Name      string
+	Publisher Publisher
+}
+
+// retryDelay returns the wait after the given failed attempt
+func retryDelay(attempt int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempt && delay < retryCap; i++ {
+		delay *= 2
+	}
+	return min(delay, retryCap)
+}
+
+// Relay hands the events of the outbox to its subscribers. It first queues a delivery of
+// every new event per subscriber, then sends each subscriber its due deliveries. Rows are
+// claimed with SKIP LOCKED, so any number of replicas can run a relay. A delivery is deleted
+// only after its subscriber accepted it, so a crash in between delivers it again. A failed
+// delivery is retried with a growing delay until it goes through, unless the subscriber
+// reports it ErrUndeliverable, which parks it.
+type Relay struct {
+	db          *gorm.DB
+	subscribers []Subscriber
+	interval    time.Duration
+}
+
+func NewRelay(database *gorm.DB, subscribers []Subscriber, interval time.Duration) *Relay {
+	return &Relay{
+		db:          database,
+		subscribers: subscribers,
+		interval:    interval,
+	}
+}
+
+// InitRelay returns a relay to the publisher configured by EVENTS_PUBLISHER, and to the
+// in-process subscribers, that polls every OUTBOX_RELAY_INTERVAL (a second by default), or
+// nil when it is set to off
+func InitRelay(subscribers ...Subscriber) *Relay {
+	interval, err := relayIntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading outbox relay interval: %v", err)
+	}
+	if interval == 0 {
+		return nil
+	}
+	publisher, err := InitPublisher()
+	if err != nil {
+		log.Fatalf("Error loading events publisher: %v", err)
+	}
+	return NewRelay(db.DB, append([]Subscriber{{Name: SubscriberPublisher, Publisher: publisher}}, subscribers...), interval)
+}
+
+// relayIntervalFromEnv reads OUTBOX_RELAY_INTERVAL, a Go duration such as 500ms or "off"
+func relayIntervalFromEnv() (time.Duration, error) {
+	spec := strings.TrimSpace(os.Getenv(common.OutboxRelayInterval))
+	switch spec {
+	case "":
+		return time.Second, nil
+	case "off":
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(spec)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration or off, got %q", common.OutboxRelayInterval, spec)
+	}
+	return interval, nil
+}
+
+// Run publishes pending events every interval until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayPending(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending queues the new events of the outbox for every subscriber and sends each
+// subscriber the deliveries due by now. It returns how many deliveries went through. A
+// subscriber that fails is left until its next attempt, while the others carry on.
+// Subscribers receive events in about the order they were recorded, but a failed delivery
+// is retried after later ones, and replicas relay side by side, so order is not guaranteed.
+func (r *Relay) RelayPending(ctx context.Context, now time.Time) (int, error) {
+	if err := r.queuePending(ctx, now); err != nil {
+		return 0, err
+	}
+	total := 0
+	var errs []error
+	for _, subscriber := range r.subscribers {
+		delivered, err := r.deliverDue(ctx, subscriber, now)
+		total += delivered
+		if err != nil {
+			errs = append(errs, fmt.Errorf("relaying outbox events to %s: %w", subscriber.Name, err))
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// queuePending queues a delivery of every unpublished event for each subscriber
+func (r *Relay) queuePending(ctx context.Context, now time.Time) error {
+	for {
+		claimed := 0
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var rows []models.OutboxEvent
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("published_at IS NULL").
+				Order("seq").
+				Limit(relayBatchSize).
+				Find(&rows).Error
+			if err != nil || len(rows) == 0 {
+				return err
+			}
+			claimed = len(rows)
+			deliveries := make([]models.OutboxDelivery, 0, len(rows)*len(r.subscribers))
+			ids := make([]uuid.UUID, 0, len(rows))
+			for _, row := range rows {
+				ids = append(ids, row.ID)
+				for _, subscriber := range r.subscribers {
+					deliveries = append(deliveries, models.OutboxDelivery{
+						EventID:       row.ID,
+						Subscriber:    subscriber.Name,
+						Seq:           row.Seq,
+						NextAttemptAt: now,
+					})
+				}
+			}
+			if len(deliveries) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("published_at", now).Error
+		})
+		if err != nil || claimed < relayBatchSize {
+			return err
+		}
+	}
+}
+
+// deliverDue sends a subscriber its deliveries due by now and returns how many went through.
+// It stops at the first that fails, as the subscriber is likely down; that one is retried
+// after retryDelay.
+func (r *Relay) deliverDue(ctx context.Context, subscriber Subscriber, now time.Time) (int, error) {
+	total := 0
+	for {
+		claimed, delivered := 0, 0
+		var deliverErr error
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var rows []models.OutboxDelivery
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Preload("Event").
+				Where("subscriber = ? AND parked_at IS NULL AND next_attempt_at <= ?", subscriber.Name, now).
+				Order("seq").
+				Limit(relayBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return err
+			}
+			claimed = len(rows)
+			for i := range rows {
+				row := &rows[i]
+				err := subscriber.Publisher.Publish(ctx, fromOutbox(&row.Event))
+				if err == nil {
+					if err := tx.Delete(&models.OutboxDelivery{}, "id = ?", row.ID).Error; err != nil {
+						return err
+					}
+					delivered++
+					continue
+				}
+				updates := map[string]interface{}{
+					"attempts":   row.Attempts + 1,
+					"last_error": err.Error(),
+				}
+				if errors.Is(err, ErrUndeliverable) {
+					updates["parked_at"] = now
+					log.Printf("events: parked %s event %s for %s: %v", row.Event.Type, row.EventID, subscriber.Name, err)
+					if err := tx.Model(&models.OutboxDelivery{}).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				deliverErr = err
+				updates["next_attempt_at"] = now.Add(retryDelay(row.Attempts + 1))
+				return tx.Model(&models.OutboxDelivery{}).Where("id = ?", row.ID).Updates(updates).Error
+			}
+			return nil
+		})
+		if err != nil {
+			// Nothing was marked delivered; the events will be delivered again
+			return total, err
+		}
+		total += delivered
+		if deliverErr != nil {
+			return total, deliverErr
+		}
+		if claimed < relayBatchSize {
+			return total, nil
+		}
+	}
+}
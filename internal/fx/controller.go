@@ -0,0 +1,52 @@
+package fx
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service *Service
+}
+
+// GetQuote godoc
+// @Summary  Get an FX quote
+// @Description  Returns a time-limited exchange rate quote that a cross-currency transfer can reference via quote_id
+// @Tags     fx
+// @Security JWT
+// @Param    from    query  string  true  "Source currency"
+// @Param    to      query  string  true  "Destination currency"
+// @Param    amount  query  string  true  "Decimal amount in the source currency, e.g. 10.50"
+// @Success  200  {object}  QuoteResponse
+// @Failure  400  {object}  map[string]string
+// @Router   /api/v1/fx/quote [get]
+func (c *Controller) getQuote(ctx *gin.Context) {
+	var req QuoteRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id not found in context"})
+		return
+	}
+	userIDStr, ok := userID.(string)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id in context is not a string"})
+		return
+	}
+	resp, err := c.service.createQuote(ctx, req, userIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
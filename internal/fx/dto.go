@@ -0,0 +1,32 @@
+package fx
+
+import "github.com/ahmedkhaeld/banking-app/internal/money"
+
+// QuoteRequest represents the query parameters for requesting an FX quote.
+// swagger:model QuoteRequest
+type QuoteRequest struct {
+	// Currency of the source account.
+	// Example: USD
+	From string `form:"from" binding:"required,oneof=USD EUR GBP JPY EGP CAD AUD"`
+	// Currency of the destination account.
+	// Example: EUR
+	To string `form:"to" binding:"required,oneof=USD EUR GBP JPY EGP CAD AUD"`
+	// Amount to send as a decimal in the source currency.
+	// Example: 10.50
+	Amount string `form:"amount" binding:"required"`
+}
+
+type QuoteResponse struct {
+	// ID of the quote; pass it as quote_id when creating the transfer.
+	ID string `json:"id"`
+	// Units of the destination currency bought by one unit of the source currency.
+	// Example: "0.9200000000"
+	Rate string `json:"rate"`
+	// Amount debited from the source account.
+	SourceAmount money.Money `json:"source_amount"`
+	// Amount credited to the destination account.
+	DestinationAmount money.Money `json:"destination_amount"`
+	// ExpiresAt is the time after which the quote can no longer be used.
+	// Example: "2023-10-01T12:00:00Z"
+	ExpiresAt string `json:"expires_at"`
+}
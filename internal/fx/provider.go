@@ -0,0 +1,149 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+)
+
+// RateDecimals is the precision rates are rounded to before they are stored or applied.
+const RateDecimals = 10
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrInvalidRate         = errors.New("invalid exchange rate")
+	ErrAmountOverflow      = errors.New("converted amount overflows")
+)
+
+// RateProvider returns how many units of `to` one unit of `from` buys.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*big.Rat, error)
+}
+
+// defaultRates are indicative rates against USD used when no rates file is configured.
+var defaultRates = map[string]string{
+	"USD": "1",
+	"EUR": "0.92",
+	"GBP": "0.79",
+	"JPY": "150",
+	"EGP": "48.5",
+	"CAD": "1.36",
+	"AUD": "1.52",
+}
+
+// StaticProvider serves fixed rates quoted against a single base currency.
+type StaticProvider struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// NewStaticProvider builds a provider from rates expressed as units of each currency per one unit of base.
+func NewStaticProvider(base string, rates map[string]string) (*StaticProvider, error) {
+	p := &StaticProvider{
+		base:  strings.ToUpper(base),
+		rates: make(map[string]*big.Rat, len(rates)+1),
+	}
+	p.rates[p.base] = big.NewRat(1, 1)
+	for currency, value := range rates {
+		rate, err := ParseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", currency, err)
+		}
+		p.rates[strings.ToUpper(currency)] = rate
+	}
+	return p, nil
+}
+
+// rateFile is the on-disk format read by NewFileProvider, e.g.
+// {"base": "USD", "rates": {"EUR": "0.92", "JPY": "150"}}
+type rateFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+// NewFileProvider loads a StaticProvider from a JSON rates file.
+func NewFileProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file rateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid rates file: %w", err)
+	}
+	if file.Base == "" {
+		return nil, errors.New("invalid rates file: base currency is required")
+	}
+	return NewStaticProvider(file.Base, file.Rates)
+}
+
+// InitProvider returns the provider configured by FX_RATES_FILE, falling back to the built-in rates.
+func InitProvider() (RateProvider, error) {
+	if path := os.Getenv(common.FxRatesFile); path != "" {
+		return NewFileProvider(path)
+	}
+	return NewStaticProvider("USD", defaultRates)
+}
+
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	fromRate, ok := p.rates[strings.ToUpper(from)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	toRate, ok := p.rates[strings.ToUpper(to)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+	}
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+// ParseRate parses a positive decimal rate such as "0.92".
+func ParseRate(value string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok || rate.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+	return rate, nil
+}
+
+// FormatRate renders a rate with RateDecimals digits, as stored on transfers and quotes.
+func FormatRate(rate *big.Rat) string {
+	return rate.FloatString(RateDecimals)
+}
+
+// Convert applies rate to amount and returns the result in the minor units of currency `to`,
+// accounting for the currencies' exponents. The rate is rounded to RateDecimals first so that
+// the stored rate reproduces the result. The converted amount is rounded down.
+func Convert(amount money.Money, to string, rate *big.Rat) (money.Money, error) {
+	fromExp, err := money.Exponent(amount.Currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	toExp, err := money.Exponent(to)
+	if err != nil {
+		return money.Money{}, err
+	}
+	rounded, err := ParseRate(FormatRate(rate))
+	if err != nil {
+		return money.Money{}, err
+	}
+	num := new(big.Int).Mul(big.NewInt(amount.Amount), rounded.Num())
+	num.Mul(num, pow10(toExp))
+	den := new(big.Int).Mul(rounded.Denom(), pow10(fromExp))
+	result := num.Quo(num, den)
+	if !result.IsInt64() {
+		return money.Money{}, ErrAmountOverflow
+	}
+	return money.Money{Amount: result.Int64(), Currency: to}, nil
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
@@ -0,0 +1,80 @@
+package fx
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticProvider_CrossRate(t *testing.T) {
+	provider, err := NewStaticProvider("USD", map[string]string{"EUR": "0.5", "GBP": "0.25"})
+	assert.NoError(t, err)
+
+	rate, err := provider.Rate(context.Background(), "EUR", "GBP")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.5000000000", FormatRate(rate))
+
+	rate, err = provider.Rate(context.Background(), "GBP", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "4.0000000000", FormatRate(rate))
+}
+
+func TestStaticProvider_UnsupportedCurrency(t *testing.T) {
+	provider, err := NewStaticProvider("USD", map[string]string{"EUR": "0.5"})
+	assert.NoError(t, err)
+
+	_, err = provider.Rate(context.Background(), "USD", "CHF")
+	assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+}
+
+func TestNewStaticProvider_InvalidRate(t *testing.T) {
+	_, err := NewStaticProvider("USD", map[string]string{"EUR": "-1"})
+	assert.ErrorIs(t, err, ErrInvalidRate)
+}
+
+func TestNewFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	err := os.WriteFile(path, []byte(`{"base": "EUR", "rates": {"USD": "2"}}`), 0o600)
+	assert.NoError(t, err)
+
+	provider, err := NewFileProvider(path)
+	assert.NoError(t, err)
+	rate, err := provider.Rate(context.Background(), "USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.5000000000", FormatRate(rate))
+}
+
+func TestConvert(t *testing.T) {
+	// 10.00 USD at 0.92 is 9.20 EUR
+	amount, err := Convert(money.Money{Amount: 1000, Currency: "USD"}, "EUR", big.NewRat(92, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 920, Currency: "EUR"}, amount)
+
+	// Rounded down
+	amount, err = Convert(money.Money{Amount: 10, Currency: "USD"}, "EUR", big.NewRat(1, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), amount.Amount)
+}
+
+func TestConvert_Exponents(t *testing.T) {
+	// 1.00 USD at 150 is 150 JPY, which has no minor units
+	amount, err := Convert(money.Money{Amount: 100, Currency: "USD"}, "JPY", big.NewRat(150, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 150, Currency: "JPY"}, amount)
+
+	// 150 JPY back at 1/150 is 1.00 USD
+	amount, err = Convert(money.Money{Amount: 150, Currency: "JPY"}, "USD", big.NewRat(1, 150))
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 100, Currency: "USD"}, amount)
+}
+
+func TestConvert_Overflow(t *testing.T) {
+	_, err := Convert(money.Money{Amount: math.MaxInt64, Currency: "USD"}, "EUR", big.NewRat(2, 1))
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
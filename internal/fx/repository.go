@@ -0,0 +1,59 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrQuoteNotFound = errors.New("fx quote not found")
+	ErrQuoteExpired  = errors.New("fx quote has expired")
+	ErrQuoteUsed     = errors.New("fx quote has already been used")
+)
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{
+		DB: db.DB,
+	}
+}
+
+func (r *Repository) createQuote(ctx context.Context, quote *models.FxQuote) error {
+	return r.DB.WithContext(ctx).Create(quote).Error
+}
+
+// ClaimQuote locks a quote inside the caller's transaction, checks that it belongs to
+// userID and is still valid, and marks it as used so it cannot back a second transfer.
+func ClaimQuote(tx *gorm.DB, quoteID, userID uuid.UUID) (*models.FxQuote, error) {
+	var quote models.FxQuote
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", quoteID, userID).
+		First(&quote).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrQuoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if quote.UsedAt != nil {
+		return nil, ErrQuoteUsed
+	}
+	if now.After(quote.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+	if err := tx.Model(&quote).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
@@ -0,0 +1,13 @@
+package fx
+
+import (
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(routerGroup *gin.RouterGroup) {
+	service := InitService()
+	controller := NewController(service)
+
+	routerGroup.GET("quote", auth.UserMiddleware(), controller.getQuote)
+}
@@ -0,0 +1,76 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+)
+
+// QuoteTTL is how long a quote can be referenced by a transfer.
+const QuoteTTL = 60 * time.Second
+
+type Service struct {
+	repo  *Repository
+	rates RateProvider
+}
+
+func NewService(repository *Repository, rates RateProvider) *Service {
+	return &Service{
+		repo:  repository,
+		rates: rates,
+	}
+}
+
+func InitService() *Service {
+	rates, err := InitProvider()
+	if err != nil {
+		log.Fatalf("Error loading fx rates: %v", err)
+	}
+	return NewService(InitRepository(), rates)
+}
+
+func (s *Service) createQuote(ctx context.Context, req QuoteRequest, userId string) (*QuoteResponse, error) {
+	userID, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, errors.New("invalid user_id format")
+	}
+	amount, err := money.Parse(req.Amount, req.From)
+	if err != nil {
+		return nil, err
+	}
+	if !amount.IsPositive() {
+		return nil, errors.New("amount must be positive")
+	}
+	rate, err := s.rates.Rate(ctx, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	destinationAmount, err := Convert(amount, req.To, rate)
+	if err != nil {
+		return nil, err
+	}
+	quote := &models.FxQuote{
+		UserID:            userID,
+		FromCurrency:      req.From,
+		ToCurrency:        req.To,
+		Rate:              FormatRate(rate),
+		SourceAmount:      amount.Amount,
+		DestinationAmount: destinationAmount.Amount,
+		ExpiresAt:         time.Now().Add(QuoteTTL),
+	}
+	if err := s.repo.createQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return &QuoteResponse{
+		ID:                quote.ID.String(),
+		Rate:              quote.Rate,
+		SourceAmount:      amount,
+		DestinationAmount: destinationAmount,
+		ExpiresAt:         quote.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	}, nil
+}
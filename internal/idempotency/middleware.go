@@ -0,0 +1,131 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderKey         = "Idempotency-Key"
+	replayedHeaderKey = "Idempotent-Replayed"
+	maxKeyLength      = 255
+	keyTTL            = 24 * time.Hour
+	// inFlightLease is how long a request holds its key before a retry may take it over
+	inFlightLease = time.Minute
+)
+
+var (
+	ErrKeyTooLong        = errors.New("idempotency key is too long")
+	ErrKeyReused         = errors.New("idempotency key was already used with a different request")
+	ErrRequestInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Middleware returns a Gin middleware that makes a route idempotent for requests
+// carrying an Idempotency-Key header. It must run after auth.UserMiddleware since
+// keys are scoped per user, and before audit.Action so that replays are not audited
+// as new actions. Requests without the header pass through unchanged.
+func Middleware() gin.HandlerFunc {
+	repo := InitRepository()
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(HeaderKey)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": ErrKeyTooLong.Error()})
+			return
+		}
+		userID, err := uuid.Parse(ctx.GetString("user_id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "user_id not found in context"})
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := hashRequest(ctx.Request.Method, ctx.FullPath(), ctx.Param("id"), body)
+		record, reserved, err := repo.reserve(ctx, userID, key, requestHash, keyTTL, inFlightLease)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if !reserved {
+			switch {
+			case record.RequestHash != requestHash:
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"message": ErrKeyReused.Error()})
+			case record.ResponseStatus == 0:
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": ErrRequestInProgress.Error()})
+			default:
+				ctx.Header(replayedHeaderKey, "true")
+				ctx.Data(record.ResponseStatus, "application/json; charset=utf-8", record.ResponseBody)
+				ctx.Abort()
+			}
+			return
+		}
+
+		// A handler that panics must not leave the key in progress for good, which would refuse
+		// every retry; release it and let the panic reach the recovery middleware
+		defer func() {
+			if r := recover(); r != nil {
+				_ = repo.release(ctx, record.ID)
+				panic(r)
+			}
+		}()
+
+		writer := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+
+		// Server errors are not cached so the client can retry with the same key. Neither are
+		// 401 and 403, which the client can fix, e.g. by adding a missing TOTP code.
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusUnauthorized || status == http.StatusForbidden {
+			_ = repo.release(ctx, record.ID)
+			return
+		}
+		_ = repo.complete(ctx, record.ID, status, writer.body.Bytes())
+	}
+}
+
+// hashRequest fingerprints a request so a reused key with a different payload can be detected
+func hashRequest(method, route, resourceID string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(route))
+	h.Write([]byte{0})
+	h.Write([]byte(resourceID))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder tees the response body so it can be stored for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
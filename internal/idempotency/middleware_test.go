@@ -0,0 +1,177 @@
+package idempotency
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	dsn := os.Getenv("DB_SOURCE_TEST")
+	if err := db.Open(dsn); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+
+	err := db.AddUUIDExtension()
+	if err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+
+	// Run migrations
+	if err := db.DB.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	// Run tests
+	code := m.Run()
+	os.Exit(code)
+}
+
+// setupTestRouter returns a router whose handler counts how many times it actually ran
+func setupTestRouter(t *testing.T, userID string, calls *int) *gin.Engine {
+	t.Cleanup(func() {
+		db.DB.Exec("DELETE FROM idempotency_keys")
+	})
+	router := gin.New()
+	router.POST("/transfers", func(ctx *gin.Context) {
+		ctx.Set("user_id", userID)
+	}, Middleware(), func(ctx *gin.Context) {
+		*calls++
+		ctx.JSON(http.StatusCreated, gin.H{"data": gin.H{"call": *calls}})
+	})
+	return router
+}
+
+func doRequest(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_ReplaysResponse(t *testing.T) {
+	calls := 0
+	router := setupTestRouter(t, uuid.New().String(), &calls)
+	key := uuid.New().String()
+
+	first := doRequest(router, key, `{"amount":100}`)
+	second := doRequest(router, key, `{"amount":100}`)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(replayedHeaderKey))
+	assert.Equal(t, 1, calls)
+}
+
+func TestMiddleware_KeyReusedWithDifferentBody(t *testing.T) {
+	calls := 0
+	router := setupTestRouter(t, uuid.New().String(), &calls)
+	key := uuid.New().String()
+
+	first := doRequest(router, key, `{"amount":100}`)
+	second := doRequest(router, key, `{"amount":200}`)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, second.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMiddleware_WithoutKey(t *testing.T) {
+	calls := 0
+	router := setupTestRouter(t, uuid.New().String(), &calls)
+
+	doRequest(router, "", `{"amount":100}`)
+	doRequest(router, "", `{"amount":100}`)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_KeysAreScopedPerUser(t *testing.T) {
+	calls := 0
+	key := uuid.New().String()
+	router1 := setupTestRouter(t, uuid.New().String(), &calls)
+	router2 := setupTestRouter(t, uuid.New().String(), &calls)
+
+	doRequest(router1, key, `{"amount":100}`)
+	doRequest(router2, key, `{"amount":100}`)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_PanicReleasesKey(t *testing.T) {
+	t.Cleanup(func() {
+		db.DB.Exec("DELETE FROM idempotency_keys")
+	})
+	calls := 0
+	userID := uuid.New().String()
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(ctx *gin.Context, _ any) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.POST("/transfers", func(ctx *gin.Context) {
+		ctx.Set("user_id", userID)
+	}, Middleware(), func(ctx *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		ctx.JSON(http.StatusCreated, gin.H{"data": gin.H{"call": calls}})
+	})
+	key := uuid.New().String()
+
+	assert.Equal(t, http.StatusInternalServerError, doRequest(router, key, `{"amount":100}`).Code)
+
+	// The retry runs the handler again instead of finding the key in progress
+	retry := doRequest(router, key, `{"amount":100}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_TakesOverLapsedInFlightKey(t *testing.T) {
+	calls := 0
+	userID := uuid.New()
+	router := setupTestRouter(t, userID.String(), &calls)
+	body := `{"amount":100}`
+	requestHash := hashRequest(http.MethodPost, "/transfers", "", []byte(body))
+	now := time.Now()
+
+	// A request whose process died a while ago, and one that is still running
+	lapsed, running := now.Add(-time.Second), now.Add(inFlightLease)
+	for key, lockedUntil := range map[string]*time.Time{"lapsed": &lapsed, "running": &running} {
+		err := db.DB.Create(&models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			LockedUntil: lockedUntil,
+			ExpiresAt:   now.Add(keyTTL),
+		}).Error
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, http.StatusCreated, doRequest(router, "lapsed", body).Code)
+	assert.Equal(t, http.StatusConflict, doRequest(router, "running", body).Code)
+	assert.Equal(t, 1, calls)
+}
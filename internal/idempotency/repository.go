@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{
+		DB: db.DB,
+	}
+}
+
+// reserve inserts a new in-flight key, leased for lease. It returns the existing row and
+// false if the key has already been used by this user, unless the same request left it in
+// flight past its lease, which is taken over.
+func (r *Repository) reserve(ctx context.Context, userID uuid.UUID, key, requestHash string, ttl, lease time.Duration) (*models.IdempotencyKey, bool, error) {
+	db := r.DB.WithContext(ctx)
+	now := time.Now()
+	// Expired keys may be reused
+	if err := db.Where("user_id = ? AND key = ? AND expires_at < ?", userID, key, now).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+	lockedUntil := now.Add(lease)
+	record := models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: &lockedUntil,
+		ExpiresAt:   now.Add(ttl),
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return &record, true, nil
+	}
+	res = db.Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND key = ? AND request_hash = ? AND response_status = 0", userID, key, requestHash).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Update("locked_until", lockedUntil)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	var existing models.IdempotencyKey
+	if err := db.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, res.RowsAffected == 1, nil
+}
+
+// complete stores the response for a reserved key
+func (r *Repository) complete(ctx context.Context, id uuid.UUID, status int, body []byte) error {
+	return r.DB.WithContext(ctx).Model(&models.IdempotencyKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"response_status": status, "response_body": body}).Error
+}
+
+// release deletes a reserved key so the request can be retried
+func (r *Repository) release(ctx context.Context, id uuid.UUID) error {
+	err := r.DB.WithContext(ctx).Where("id = ?", id).Delete(&models.IdempotencyKey{}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Journal kinds
+const (
+	// KindOpening is only found on accounts opened with a balance, before deposits existed
+	KindOpening    = "opening"
+	KindDeposit    = "deposit"
+	KindWithdrawal = "withdrawal"
+	KindTransfer   = "transfer"
+	KindReversal   = "reversal"
+)
+
+// System account kinds
+const (
+	// SystemCash is the counterparty of money entering or leaving the bank
+	SystemCash = "cash"
+	// SystemFX is the counterparty of currency conversions
+	SystemFX = "fx"
+)
+
+var (
+	ErrTooFewPostings   = errors.New("a journal needs at least two postings")
+	ErrUnbalanced       = errors.New("journal postings do not sum to zero")
+	ErrCurrencyMismatch = errors.New("posting currency does not match the account")
+	ErrAccountNotFound  = errors.New("ledger account not found")
+	ErrNegativeBalance  = errors.New("posting would make the account balance negative")
+)
+
+// systemNamespace seeds the deterministic IDs of system accounts
+var systemNamespace = uuid.MustParse("6f1c2a3e-5b7d-4e8f-9a0b-1c2d3e4f5a6b")
+
+// Posting moves amount into (positive) or out of (negative) an account
+type Posting struct {
+	AccountID uuid.UUID
+	Amount    money.Money
+}
+
+// JournalParams describes a journal transaction to record
+type JournalParams struct {
+	Kind        string
+	TransferID  *uuid.UUID
+	Reference   string
+	Description string
+	Postings    []Posting
+}
+
+// SystemAccountID returns the well-known ID of the system account of kind for currency.
+func SystemAccountID(kind, currency string) uuid.UUID {
+	return uuid.NewSHA1(systemNamespace, []byte(kind+":"+currency))
+}
+
+// SystemAccount makes sure the system account of kind for currency exists and returns its ID.
+func SystemAccount(tx *gorm.DB, kind, currency string) (uuid.UUID, error) {
+	if _, err := money.Exponent(currency); err != nil {
+		return uuid.Nil, err
+	}
+	account := models.Account{
+		ID:       SystemAccountID(kind, currency),
+		UserID:   uuid.Nil,
+		Owner:    "system:" + kind,
+		Currency: currency,
+		IsSystem: true,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return uuid.Nil, err
+	}
+	return account.ID, nil
+}
+
+// Validate checks that params has at least two postings summing to zero per currency.
+func Validate(params JournalParams) error {
+	if len(params.Postings) < 2 {
+		return ErrTooFewPostings
+	}
+	totals := map[string]money.Money{}
+	for _, p := range params.Postings {
+		total, ok := totals[p.Amount.Currency]
+		if !ok {
+			total = money.Money{Currency: p.Amount.Currency}
+		}
+		total, err := total.Add(p.Amount)
+		if err != nil {
+			return err
+		}
+		totals[p.Amount.Currency] = total
+	}
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("%w: %s is off by %s", ErrUnbalanced, currency, total.Decimal())
+		}
+	}
+	return nil
+}
+
+// Post records a journal and its entries and applies them to the account balances inside tx.
+// Accounts are locked in ID order; customer accounts may not go negative.
+// The returned journal's Entries are in the same order as params.Postings.
+func Post(tx *gorm.DB, params JournalParams) (*models.Journal, error) {
+	if err := Validate(params); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(params.Postings))
+	seen := make(map[uuid.UUID]bool, len(params.Postings))
+	for _, p := range params.Postings {
+		if !seen[p.AccountID] {
+			seen[p.AccountID] = true
+			ids = append(ids, p.AccountID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	accounts := make(map[uuid.UUID]*models.Account, len(ids))
+	for _, id := range ids {
+		var account models.Account
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts[id] = &account
+	}
+
+	// Apply postings in memory first so nothing is written if any of them fails
+	for _, p := range params.Postings {
+		account := accounts[p.AccountID]
+		if account.Currency != p.Amount.Currency {
+			return nil, fmt.Errorf("%w: %s posting to %s account", ErrCurrencyMismatch, p.Amount.Currency, account.Currency)
+		}
+		balance, err := money.Money{Amount: account.Balance, Currency: account.Currency}.Add(p.Amount)
+		if err != nil {
+			return nil, err
+		}
+		account.Balance = balance.Amount
+	}
+	for _, account := range accounts {
+		if !account.IsSystem && account.Balance < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNegativeBalance, account.ID)
+		}
+	}
+
+	journal := models.Journal{
+		Kind:        params.Kind,
+		TransferID:  params.TransferID,
+		Reference:   params.Reference,
+		Description: params.Description,
+	}
+	if err := tx.Create(&journal).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range params.Postings {
+		entry := models.Entry{
+			AccountID:  p.AccountID,
+			JournalID:  &journal.ID,
+			TransferID: params.TransferID,
+			Amount:     p.Amount.Amount,
+			Currency:   p.Amount.Currency,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return nil, err
+		}
+		journal.Entries = append(journal.Entries, entry)
+	}
+	for _, id := range ids {
+		account := accounts[id]
+		if err := tx.Model(&models.Account{}).Where("id = ?", id).UpdateColumn("balance", account.Balance).Error; err != nil {
+			return nil, err
+		}
+		if account.IsSystem {
+			continue
+		}
+		if err := recordBalanceChanged(tx, &journal, account, params.Postings); err != nil {
+			return nil, err
+		}
+	}
+	return &journal, nil
+}
+
+// recordBalanceChanged adds the BalanceChanged event of a customer account posted by journal
+func recordBalanceChanged(tx *gorm.DB, journal *models.Journal, account *models.Account, postings []Posting) error {
+	amount := money.Money{Currency: account.Currency}
+	for _, p := range postings {
+		if p.AccountID != account.ID {
+			continue
+		}
+		var err error
+		if amount, err = amount.Add(p.Amount); err != nil {
+			return err
+		}
+	}
+	return events.Record(tx, events.BalanceChanged, events.AggregateAccount, account.ID, events.BalanceChangedData{
+		AccountID:  account.ID,
+		UserID:     account.UserID,
+		JournalID:  journal.ID,
+		Kind:       journal.Kind,
+		TransferID: journal.TransferID,
+		Amount:     amount,
+		Balance:    money.Money{Amount: account.Balance, Currency: account.Currency},
+	})
+}
@@ -0,0 +1,143 @@
+package ledger
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	dsn := os.Getenv("DB_SOURCE_TEST")
+	if err := db.Open(dsn); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+
+	err := db.AddUUIDExtension()
+	if err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+
+	// Run migrations
+	if err := db.DB.AutoMigrate(&models.Account{}, &models.Journal{}, &models.Entry{}, &models.OutboxEvent{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+
+	// Run tests
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createTestAccount(t *testing.T, currency string) *models.Account {
+	acc := &models.Account{
+		ID:       uuid.New(),
+		UserID:   uuid.New(),
+		Owner:    "ledger_" + uuid.New().String()[:8],
+		Currency: currency,
+	}
+	err := db.DB.Create(acc).Error
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		db.DB.Exec("DELETE FROM entries WHERE account_id = ?", acc.ID)
+		db.DB.Exec("DELETE FROM accounts WHERE id = ?", acc.ID)
+	})
+	return acc
+}
+
+func usd(amount int64) money.Money {
+	return money.Money{Amount: amount, Currency: "USD"}
+}
+
+func TestValidate(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	assert.ErrorIs(t, Validate(JournalParams{Postings: []Posting{{AccountID: a, Amount: usd(0)}}}), ErrTooFewPostings)
+	assert.ErrorIs(t, Validate(JournalParams{Postings: []Posting{
+		{AccountID: a, Amount: usd(-100)},
+		{AccountID: b, Amount: usd(99)},
+	}}), ErrUnbalanced)
+	assert.ErrorIs(t, Validate(JournalParams{Postings: []Posting{
+		{AccountID: a, Amount: usd(-100)},
+		{AccountID: b, Amount: money.Money{Amount: 100, Currency: "EUR"}},
+	}}), ErrUnbalanced)
+	assert.NoError(t, Validate(JournalParams{Postings: []Posting{
+		{AccountID: a, Amount: usd(-100)},
+		{AccountID: b, Amount: usd(100)},
+	}}))
+}
+
+func TestPost_Success(t *testing.T) {
+	acc := createTestAccount(t, "USD")
+	cashID, err := SystemAccount(db.DB, SystemCash, "USD")
+	assert.NoError(t, err)
+
+	journal, err := Post(db.DB, JournalParams{
+		Kind: KindDeposit,
+		Postings: []Posting{
+			{AccountID: cashID, Amount: usd(-500)},
+			{AccountID: acc.ID, Amount: usd(500)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, journal.Entries, 2)
+	assert.Equal(t, acc.ID, journal.Entries[1].AccountID)
+
+	var updated models.Account
+	assert.NoError(t, db.DB.First(&updated, "id = ?", acc.ID).Error)
+	assert.Equal(t, int64(500), updated.Balance)
+}
+
+func TestPost_NegativeBalance(t *testing.T) {
+	acc := createTestAccount(t, "USD")
+	cashID, err := SystemAccount(db.DB, SystemCash, "USD")
+	assert.NoError(t, err)
+
+	_, err = Post(db.DB, JournalParams{
+		Kind: KindDeposit,
+		Postings: []Posting{
+			{AccountID: acc.ID, Amount: usd(-1)},
+			{AccountID: cashID, Amount: usd(1)},
+		},
+	})
+	assert.ErrorIs(t, err, ErrNegativeBalance)
+}
+
+func TestVerify_DetectsDrift(t *testing.T) {
+	acc := createTestAccount(t, "USD")
+	cashID, err := SystemAccount(db.DB, SystemCash, "USD")
+	assert.NoError(t, err)
+	_, err = Post(db.DB, JournalParams{
+		Kind: KindDeposit,
+		Postings: []Posting{
+			{AccountID: cashID, Amount: usd(-300)},
+			{AccountID: acc.ID, Amount: usd(300)},
+		},
+	})
+	assert.NoError(t, err)
+
+	// Bump the balance behind the ledger's back
+	assert.NoError(t, db.DB.Exec("UPDATE accounts SET balance = balance + 7 WHERE id = ?", acc.ID).Error)
+
+	report, err := Verify(context.Background(), db.DB)
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	var found bool
+	for _, drift := range report.Drifts {
+		if drift.AccountID == acc.ID {
+			found = true
+			assert.Equal(t, int64(7), drift.Difference)
+		}
+	}
+	assert.True(t, found)
+}
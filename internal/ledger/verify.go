@@ -0,0 +1,85 @@
+package ledger
+
+import (
+	"context"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountDrift is an account whose stored balance differs from the sum of its postings
+type AccountDrift struct {
+	AccountID    uuid.UUID `json:"account_id"`
+	Currency     string    `json:"currency"`
+	Balance      int64     `json:"balance"`
+	PostingTotal int64     `json:"posting_total"`
+	Difference   int64     `json:"difference"`
+}
+
+// JournalImbalance is a journal whose postings do not sum to zero in a currency
+type JournalImbalance struct {
+	JournalID uuid.UUID `json:"journal_id"`
+	Currency  string    `json:"currency"`
+	Total     int64     `json:"total"`
+}
+
+// Report is the result of Verify
+type Report struct {
+	AccountsChecked int                `json:"accounts_checked"`
+	Drifts          []AccountDrift     `json:"drifts"`
+	Imbalances      []JournalImbalance `json:"imbalances"`
+}
+
+// OK reports whether the ledger is consistent
+func (r *Report) OK() bool {
+	return len(r.Drifts) == 0 && len(r.Imbalances) == 0
+}
+
+// Verify recomputes every account balance from its postings and checks that every
+// journal sums to zero per currency.
+func Verify(ctx context.Context, db *gorm.DB) (*Report, error) {
+	db = db.WithContext(ctx)
+	report := &Report{}
+
+	var totals []struct {
+		AccountID    uuid.UUID
+		Currency     string
+		Balance      int64
+		PostingTotal int64
+	}
+	// Deleted accounts keep their postings, so they are checked too
+	err := db.Unscoped().Model(&models.Account{}).
+		Select("accounts.id AS account_id, accounts.currency, accounts.balance, COALESCE(SUM(entries.amount), 0) AS posting_total").
+		Joins("LEFT JOIN entries ON entries.account_id = accounts.id").
+		Group("accounts.id, accounts.currency, accounts.balance").
+		Order("accounts.id").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	report.AccountsChecked = len(totals)
+	for _, t := range totals {
+		if t.Balance != t.PostingTotal {
+			report.Drifts = append(report.Drifts, AccountDrift{
+				AccountID:    t.AccountID,
+				Currency:     t.Currency,
+				Balance:      t.Balance,
+				PostingTotal: t.PostingTotal,
+				Difference:   t.Balance - t.PostingTotal,
+			})
+		}
+	}
+
+	err = db.Model(&models.Entry{}).
+		Select("journal_id, currency, SUM(amount) AS total").
+		Where("journal_id IS NOT NULL").
+		Group("journal_id, currency").
+		Having("SUM(amount) <> 0").
+		Order("journal_id").
+		Scan(&report.Imbalances).Error
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,43 @@
+// Package mailer sends transactional email such as password resets and email verification.
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// InitSender returns the sender configured by the environment: SMTP when SMTP_ADDR is set,
+// otherwise a FileSender writing to MAIL_DIR (a temporary directory by default) so that
+// mail can be inspected in development.
+func InitSender() Sender {
+	if addr := os.Getenv(common.SmtpAddr); addr != "" {
+		return NewSMTPSender(addr, os.Getenv(common.SmtpUsername), os.Getenv(common.SmtpPassword), os.Getenv(common.MailFrom))
+	}
+	dir := os.Getenv(common.MailDir)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "banking-app-mail")
+	}
+	fileSenderNotice.Do(func() {
+		log.Printf("mailer: SMTP_ADDR is not set, writing mail to %s", dir)
+	})
+	return NewFileSender(dir)
+}
+
+var fileSenderNotice sync.Once
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySender(t *testing.T) {
+	sender := NewMemorySender()
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "a@example.com", Subject: "first"}))
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "b@example.com", Subject: "other"}))
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "a@example.com", Subject: "second"}))
+
+	assert.Len(t, sender.Messages(), 3)
+	last, ok := sender.Last("a@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "second", last.Subject)
+	_, ok = sender.Last("nobody@example.com")
+	assert.False(t, ok)
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+	sender := NewFileSender(dir)
+	msg := Message{To: "a@example.com", Subject: "hello", Body: "body"}
+	assert.NoError(t, sender.Send(context.Background(), msg))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.NoError(t, err)
+	var got Message
+	assert.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, msg, got)
+}
+
+func TestSMTPSender_Render(t *testing.T) {
+	sender := NewSMTPSender("localhost:25", "", "", "bank@example.com")
+	raw := string(sender.render(Message{To: "a@example.com", Subject: "hi", Body: "line1\nline2"}))
+	assert.True(t, strings.HasPrefix(raw, "From: bank@example.com\r\nTo: a@example.com\r\nSubject: hi\r\n"))
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\nline1\r\nline2"))
+}
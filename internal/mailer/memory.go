@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MemorySender keeps sent messages in memory, for tests
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent so far
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last returns the most recent message sent to to
+func (s *MemorySender) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// FileSender writes each message as a JSON file into a directory
+type FileSender struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFileSender(dir string) *FileSender {
+	return &FileSender{dir: dir}
+}
+
+func (s *FileSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	s.seq++
+	name := fmt.Sprintf("%s-%04d.json", time.Now().UTC().Format("20060102T150405.000000000"), s.seq)
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, name), data, 0o600)
+}
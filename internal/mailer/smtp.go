@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPSender delivers mail through an SMTP server, using STARTTLS when the server offers it
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender returns a sender for the server at addr (host:port). Username and password
+// are optional; PLAIN auth is only used over TLS.
+func NewSMTPSender(addr, username, password, from string) *SMTPSender {
+	sender := &SMTPSender{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	// net/smtp has no context support, so the deadline only bounds the whole call
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, s.render(msg))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// render builds an RFC 5322 message
+func (s *SMTPSender) render(msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
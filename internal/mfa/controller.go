@@ -0,0 +1,165 @@
+package mfa
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service *Service
+}
+
+// @Summary Two-factor status
+// @Tags mfa
+// @Security JWT
+// @Success 200 {object} StatusResponse
+// @Router /api/v1/users/me/mfa [get]
+func (c *Controller) status(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	enabledAt, remaining, err := c.service.Status(ctx, subject.UserID)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	resp := StatusResponse{Enabled: enabledAt != nil, RecoveryCodesRemaining: remaining}
+	if enabledAt != nil {
+		resp.EnabledAt = enabledAt.Format(time.RFC3339)
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary Start TOTP enrolment
+// @Description Generates a TOTP secret to add to an authenticator app. It is not used until
+// @Description confirmed with a code; starting again replaces a pending secret.
+// @Tags mfa
+// @Security JWT
+// @Success 201 {object} EnrolmentResponse
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/mfa/totp [post]
+func (c *Controller) enroll(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	enrolment, err := c.service.Enroll(ctx, subject.UserID)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, EnrolmentResponse{
+		Secret:          enrolment.Secret,
+		ProvisioningURI: enrolment.ProvisioningURI,
+	})
+}
+
+// @Summary Confirm TOTP enrolment
+// @Description Enables TOTP with a code from the authenticator app and returns recovery codes. They are shown only once.
+// @Tags mfa
+// @Security JWT
+// @Param request body CodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/mfa/totp/confirm [post]
+func (c *Controller) confirm(ctx *gin.Context) {
+	var req CodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	codes, err := c.service.Confirm(ctx, subject.UserID, req.Code)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable TOTP
+// @Description Turns two-factor authentication off. Needs a current TOTP code or a recovery code.
+// @Tags mfa
+// @Security JWT
+// @Param request body CodeRequest true "TOTP or recovery code"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/mfa/totp/disable [post]
+func (c *Controller) disable(ctx *gin.Context) {
+	var req CodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if err := c.service.Disable(ctx, subject.UserID, req.Code); err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes. Needs a current TOTP code.
+// @Tags mfa
+// @Security JWT
+// @Param request body CodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/users/me/mfa/recovery-codes [post]
+func (c *Controller) regenerateRecoveryCodes(ctx *gin.Context) {
+	var req CodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	codes, err := c.service.RegenerateRecoveryCodes(ctx, subject.UserID, req.Code)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// mfaErrorStatus maps service errors to HTTP status codes
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidCode), errors.Is(err, ErrCodeReused):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrAlreadyEnabled), errors.Is(err, ErrNotEnabled), errors.Is(err, ErrNoPendingEnrolment):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
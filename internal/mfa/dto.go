@@ -0,0 +1,31 @@
+package mfa
+
+// CodeRequest carries a code from the authenticator app, or a recovery code where allowed.
+type CodeRequest struct {
+	// Six digit TOTP code, or a recovery code such as abcde-fghij
+	// required: true
+	Code string `json:"code" binding:"required"`
+}
+
+// EnrolmentResponse holds a pending TOTP secret.
+type EnrolmentResponse struct {
+	// Base32 secret for manual entry into the authenticator app
+	Secret string `json:"secret"`
+	// otpauth:// URI, usually rendered as a QR code
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse holds newly generated recovery codes. They are shown once.
+type RecoveryCodesResponse struct {
+	// Single-use codes that replace a TOTP code at login
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// StatusResponse describes the two-factor setup of the caller.
+type StatusResponse struct {
+	Enabled bool `json:"enabled"`
+	// When TOTP was enabled
+	EnabledAt string `json:"enabled_at,omitempty"`
+	// Number of unused recovery codes
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
@@ -0,0 +1,89 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{DB: db.DB}
+}
+
+func (r *Repository) getUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := r.DB.WithContext(ctx).Where("id = ?", userID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// withLockedUser runs fn in a transaction holding the user's row lock, so that concurrent
+// verifications cannot both accept the same code
+func (r *Repository) withLockedUser(ctx context.Context, userID uuid.UUID, fn func(tx *gorm.DB, user *models.User) error) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return fn(tx, &user)
+	})
+}
+
+// updateUser writes the given TOTP columns of a user
+func updateUser(tx *gorm.DB, userID uuid.UUID, columns map[string]interface{}) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).Updates(columns).Error
+}
+
+// replaceRecoveryCodes drops every recovery code of a user and stores the given hashes
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	codes := make([]models.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
+
+// useRecoveryCode marks an unused recovery code as used, reporting whether one matched
+func useRecoveryCode(tx *gorm.DB, userID uuid.UUID, hash string) (bool, error) {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// countUnusedRecoveryCodes returns how many recovery codes a user has left
+func (r *Repository) countUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
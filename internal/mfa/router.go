@@ -0,0 +1,21 @@
+package mfa
+
+import (
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the caller's own two-factor settings
+func RegisterRoutes(routerGroup *gin.RouterGroup) {
+	service := InitService()
+	controller := NewController(service)
+
+	routerGroup.Use(auth.UserMiddleware())
+
+	routerGroup.GET("", controller.status)
+	routerGroup.POST("/totp", audit.Action("mfa.totp.enroll", "user"), controller.enroll)
+	routerGroup.POST("/totp/confirm", audit.Action("mfa.totp.confirm", "user"), controller.confirm)
+	routerGroup.POST("/totp/disable", audit.Action("mfa.totp.disable", "user"), controller.disable)
+	routerGroup.POST("/recovery-codes", audit.Action("mfa.recovery_codes.regenerate", "user"), controller.regenerateRecoveryCodes)
+}
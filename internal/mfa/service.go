@@ -0,0 +1,247 @@
+// Package mfa manages TOTP two-factor enrolment (see auth.ValidateTOTP) and single-use
+// recovery codes. The user package asks for a code at login and the transfer package asks
+// for a fresh one before large transfers.
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Issuer shown by authenticator apps next to the account name
+	Issuer = "Banking App"
+	// Number of recovery codes handed out when TOTP is enabled
+	RecoveryCodeCount = 10
+
+	recoveryCodeLength = 10
+	// 32 symbols, so every random byte maps onto it without bias
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+// Errors
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrNotEnabled         = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingEnrolment = errors.New("no two-factor enrolment in progress; start one first")
+	ErrInvalidCode        = errors.New("invalid two-factor code")
+	ErrCodeReused         = errors.New("two-factor code was already used; wait for the next one")
+)
+
+type Service struct {
+	repo *Repository
+	now  func() time.Time
+}
+
+func NewService(repository *Repository) *Service {
+	return &Service{
+		repo: repository,
+		now:  time.Now,
+	}
+}
+
+func InitService() *Service {
+	return NewService(InitRepository())
+}
+
+// Enrolment is a TOTP secret waiting to be confirmed with a code from the authenticator app
+type Enrolment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// Enabled reports whether user has confirmed a TOTP enrolment
+func Enabled(user *models.User) bool {
+	return user.TOTPEnabledAt != nil
+}
+
+// Enroll generates a new pending TOTP secret for a user. Starting again replaces a pending
+// secret; an enabled one has to be disabled first.
+func (s *Service) Enroll(ctx context.Context, userID uuid.UUID) (*Enrolment, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	var enrolment *Enrolment
+	err = s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if Enabled(user) {
+			return ErrAlreadyEnabled
+		}
+		if err := updateUser(tx, user.ID, map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}); err != nil {
+			return err
+		}
+		enrolment = &Enrolment{
+			Secret:          secret,
+			ProvisioningURI: auth.TOTPProvisioningURI(Issuer, user.Username, secret),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return enrolment, nil
+}
+
+// Confirm enables a pending enrolment once the user proves the authenticator works, and
+// returns a fresh set of recovery codes. They are only ever shown here.
+func (s *Service) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if Enabled(user) {
+			return ErrAlreadyEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrNoPendingEnrolment
+		}
+		step, ok := auth.ValidateTOTP(user.TOTPSecret, code, s.now())
+		if !ok {
+			return ErrInvalidCode
+		}
+		err := updateUser(tx, user.ID, map[string]interface{}{"totp_enabled_at": s.now(), "totp_last_step": step})
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.ID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns TOTP off after checking a current TOTP or recovery code
+func (s *Service) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	return s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if err := s.verify(tx, user, code, true); err != nil {
+			return err
+		}
+		err := updateUser(tx, user.ID, map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0})
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.ID, nil)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of a user after checking a current
+// TOTP code
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if err := s.verify(tx, user, code, false); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.ID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Status returns when TOTP was enabled for a user, nil if it is not, and how many unused
+// recovery codes are left
+func (s *Service) Status(ctx context.Context, userID uuid.UUID) (*time.Time, int64, error) {
+	user, err := s.repo.getUser(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	remaining, err := s.repo.countUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return user.TOTPEnabledAt, remaining, nil
+}
+
+// Verify checks a second-factor code at login. Both TOTP codes and recovery codes are
+// accepted, and each works only once.
+func (s *Service) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	return s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		return s.verify(tx, user, code, true)
+	})
+}
+
+// VerifyStepUp checks a fresh TOTP code before a sensitive operation. Recovery codes are not
+// accepted here: they exist to regain access, not to authorise payments.
+func (s *Service) VerifyStepUp(ctx context.Context, userID uuid.UUID, code string) error {
+	return s.repo.withLockedUser(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		return s.verify(tx, user, code, false)
+	})
+}
+
+// verify checks code against the locked user. A TOTP code is only accepted for a time step
+// after the last accepted one, so an observed code cannot be replayed.
+func (s *Service) verify(tx *gorm.DB, user *models.User, code string, allowRecovery bool) error {
+	if !Enabled(user) {
+		return ErrNotEnabled
+	}
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, s.now()); ok {
+		if step <= user.TOTPLastStep {
+			return ErrCodeReused
+		}
+		return updateUser(tx, user.ID, map[string]interface{}{"totp_last_step": step})
+	}
+	if !allowRecovery {
+		return ErrInvalidCode
+	}
+	used, err := useRecoveryCode(tx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns RecoveryCodeCount random codes formatted as xxxxx-xxxxx, and
+// their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	buf := make([]byte, recoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == recoveryCodeLength/2 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+		codes[i] = sb.String()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes as typed by the user
+func hashRecoveryCode(code string) string {
+	normalised := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,160 @@
+package mfa
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestService(t *testing.T) *Service {
+	repo := InitRepository()
+	t.Cleanup(func() {
+		repo.DB.Exec("DELETE FROM recovery_codes")
+		repo.DB.Exec("DELETE FROM users")
+	})
+	service := NewService(repo)
+	// A fixed clock, so that a test never straddles two TOTP periods
+	now := time.Now()
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	dsn := os.Getenv("DB_SOURCE_TEST")
+	if err := db.Open(dsn); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+
+	if err := db.AddUUIDExtension(); err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+
+	// Run migrations
+	if err := db.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+
+	// Run tests
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createTestUser(t *testing.T, service *Service) *models.User {
+	user := &models.User{
+		ID:       uuid.New(),
+		Username: "mfauser_" + uuid.New().String()[:8],
+		Password: "hashed",
+		FullName: "MFA User",
+		Email:    "mfa_" + uuid.New().String()[:8] + "@example.com",
+	}
+	assert.NoError(t, service.repo.DB.Create(user).Error)
+	return user
+}
+
+// enable enrols and confirms TOTP for user, returning the secret and recovery codes
+func enable(t *testing.T, service *Service, user *models.User) (string, []string) {
+	enrolment, err := service.Enroll(context.Background(), user.ID)
+	assert.NoError(t, err)
+	code, err := auth.TOTPCode(enrolment.Secret, service.now())
+	assert.NoError(t, err)
+	codes, err := service.Confirm(context.Background(), user.ID, code)
+	assert.NoError(t, err)
+	return enrolment.Secret, codes
+}
+
+// advance moves the service clock to the next TOTP period
+func advance(service *Service) {
+	now := service.now().Add(30 * time.Second)
+	service.now = func() time.Time { return now }
+}
+
+func TestEnrollAndConfirm(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+
+	_, err := service.Confirm(context.Background(), user.ID, "123456")
+	assert.ErrorIs(t, err, ErrNoPendingEnrolment)
+
+	enrolment, err := service.Enroll(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Contains(t, enrolment.ProvisioningURI, "otpauth://totp/")
+
+	_, err = service.Confirm(context.Background(), user.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	code, err := auth.TOTPCode(enrolment.Secret, service.now())
+	assert.NoError(t, err)
+	codes, err := service.Confirm(context.Background(), user.ID, code)
+	assert.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+
+	enabledAt, remaining, err := service.Status(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, enabledAt)
+	assert.Equal(t, int64(RecoveryCodeCount), remaining)
+
+	_, err = service.Enroll(context.Background(), user.ID)
+	assert.ErrorIs(t, err, ErrAlreadyEnabled)
+}
+
+func TestVerify_CodesAreSingleUse(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	secret, _ := enable(t, service, user)
+
+	// The code used to confirm cannot be used again
+	code, _ := auth.TOTPCode(secret, service.now())
+	assert.ErrorIs(t, service.Verify(context.Background(), user.ID, code), ErrCodeReused)
+
+	advance(service)
+	code, _ = auth.TOTPCode(secret, service.now())
+	assert.NoError(t, service.VerifyStepUp(context.Background(), user.ID, code))
+	assert.ErrorIs(t, service.VerifyStepUp(context.Background(), user.ID, code), ErrCodeReused)
+}
+
+func TestVerify_RecoveryCodes(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	_, codes := enable(t, service, user)
+
+	// Recovery codes do not authorise a step-up
+	assert.ErrorIs(t, service.VerifyStepUp(context.Background(), user.ID, codes[0]), ErrInvalidCode)
+
+	// They are accepted in any case and with or without the dash, once
+	assert.NoError(t, service.Verify(context.Background(), user.ID, " "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.ErrorIs(t, service.Verify(context.Background(), user.ID, codes[0]), ErrInvalidCode)
+
+	_, remaining, err := service.Status(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(RecoveryCodeCount-1), remaining)
+}
+
+func TestDisable(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t, service)
+	_, codes := enable(t, service, user)
+
+	assert.ErrorIs(t, service.Disable(context.Background(), user.ID, "000000"), ErrInvalidCode)
+	assert.NoError(t, service.Disable(context.Background(), user.ID, codes[1]))
+
+	enabledAt, remaining, err := service.Status(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, enabledAt)
+	assert.Zero(t, remaining)
+	assert.ErrorIs(t, service.Verify(context.Background(), user.ID, codes[2]), ErrNotEnabled)
+}
@@ -0,0 +1,185 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+	ErrOverflow            = errors.New("amount overflows")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrTooManyDecimals     = errors.New("amount has too many decimal places for currency")
+)
+
+// exponents holds the ISO 4217 minor unit exponent of each supported currency.
+var exponents = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"EGP": 2,
+	"CAD": 2,
+	"AUD": 2,
+}
+
+// Money is an amount in the minor units of its currency, e.g. {1234, "USD"} is 12.34 USD
+// and {1234, "JPY"} is 1234 JPY.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// Exponent returns the number of decimal places of currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	return exp, nil
+}
+
+// New returns an amount of minor units in currency.
+func New(amount int64, currency string) (Money, error) {
+	if _, err := Exponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse reads a decimal string such as "12.34" or "-5" as an amount of currency.
+func Parse(value, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if len(fraction) > exp {
+		return Money{}, fmt.Errorf("%w: %s allows %d", ErrTooManyDecimals, currency, exp)
+	}
+	digits := whole + fraction + strings.Repeat("0", exp-len(fraction))
+	if negative {
+		digits = "-" + digits
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) && errors.Is(numErr.Err, strconv.ErrRange) {
+			return Money{}, ErrOverflow
+		}
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount in major units, e.g. "12.34".
+func (m Money) Decimal() string {
+	exp, ok := exponents[m.Currency]
+	if !ok || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+	abs := strconv.FormatUint(absUint(m.Amount), 10)
+	if len(abs) <= exp {
+		abs = strings.Repeat("0", exp-len(abs)+1) + abs
+	}
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	return sign + abs[:len(abs)-exp] + "." + abs[len(abs)-exp:]
+}
+
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Add returns m + other, failing on a currency mismatch or int64 overflow.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other, failing on a currency mismatch or int64 overflow.
+func (m Money) Sub(other Money) (Money, error) {
+	neg, err := other.Neg()
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Add(neg)
+}
+
+// Neg returns -m.
+func (m Money) Neg() (Money, error) {
+	if m.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: -m.Amount, Currency: m.Currency}, nil
+}
+
+// jsonMoney is the wire format: {"amount": "12.34", "currency": "USD"}
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	amount, err := json.Marshal(m.Decimal())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonMoney{Amount: amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts the amount either as a decimal string or as a JSON number in major units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw jsonMoney
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	currency := strings.ToUpper(raw.Currency)
+	amount := strings.Trim(string(raw.Amount), `"`)
+	parsed, err := Parse(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
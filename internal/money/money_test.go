@@ -0,0 +1,85 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse("12.34", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: 1234, Currency: "USD"}, m)
+
+	m, err = Parse("12.3", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1230), m.Amount)
+
+	m, err = Parse("-5", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-500), m.Amount)
+
+	m, err = Parse("1500", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), m.Amount)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse("12.345", "USD")
+	assert.ErrorIs(t, err, ErrTooManyDecimals)
+
+	_, err = Parse("12.5", "JPY")
+	assert.ErrorIs(t, err, ErrTooManyDecimals)
+
+	_, err = Parse("1e3", "USD")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = Parse("12.", "USD")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = Parse("1", "XXX")
+	assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+
+	_, err = Parse("92233720368547758.08", "USD")
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "12.34", Money{Amount: 1234, Currency: "USD"}.Decimal())
+	assert.Equal(t, "0.05", Money{Amount: 5, Currency: "USD"}.Decimal())
+	assert.Equal(t, "-0.05", Money{Amount: -5, Currency: "USD"}.Decimal())
+	assert.Equal(t, "1234", Money{Amount: 1234, Currency: "JPY"}.Decimal())
+	assert.Equal(t, "-92233720368547758.08", Money{Amount: math.MinInt64, Currency: "USD"}.Decimal())
+}
+
+func TestAdd(t *testing.T) {
+	sum, err := Money{Amount: 100, Currency: "USD"}.Add(Money{Amount: 50, Currency: "USD"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), sum.Amount)
+
+	_, err = Money{Amount: 100, Currency: "USD"}.Add(Money{Amount: 50, Currency: "EUR"})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = Money{Amount: math.MaxInt64, Currency: "USD"}.Add(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = Money{Amount: math.MinInt64, Currency: "USD"}.Sub(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(Money{Amount: 1234, Currency: "USD"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"12.34","currency":"USD"}`, string(data))
+
+	var m Money
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":"12.34","currency":"USD"}`), &m))
+	assert.Equal(t, Money{Amount: 1234, Currency: "USD"}, m)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":7,"currency":"jpy"}`), &m))
+	assert.Equal(t, Money{Amount: 7, Currency: "JPY"}, m)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"1.001","currency":"USD"}`), &m))
+}
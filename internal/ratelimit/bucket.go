@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit is a token bucket: Burst requests at once, refilled at Requests per Period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	// Burst is the size of the bucket; zero means Requests
+	Burst int
+}
+
+// PerMinute returns a limit of n requests a minute with a burst of n
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+// capacity returns the size of the bucket
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit reads a limit written as requests/period[:burst], where period is s, m, h or a
+// Go duration, e.g. "30/m", "5/s:20" or "100/10m"
+func ParseLimit(spec string) (Limit, error) {
+	rateSpec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+	requestsSpec, periodSpec, ok := strings.Cut(rateSpec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, spec)
+	}
+	requests, err := strconv.Atoi(requestsSpec)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, spec)
+	}
+	var period time.Duration
+	switch periodSpec {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		period, err = time.ParseDuration(periodSpec)
+		if err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, spec)
+		}
+	}
+	limit := Limit{Requests: requests, Period: period}
+	if hasBurst {
+		limit.Burst, err = strconv.Atoi(burstSpec)
+		if err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, spec)
+		}
+	}
+	return limit, nil
+}
+
+// Bucket is the state of one token bucket
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is how long until a token is available; zero when Allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Take refills bucket b up to now and takes one token from it if there is one. A zero Bucket
+// is a full one.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, Result) {
+	capacity, rate := l.capacity(), l.rate()
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed*rate)
+	}
+	b.UpdatedAt = now
+
+	result := Result{Limit: int(capacity)}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(b.Tokens))
+	result.ResetAfter = seconds((capacity - b.Tokens) / rate)
+	return b, result
+}
+
+// expiresAt returns when bucket b is full again, after which a store may forget it
+func (l Limit) expiresAt(b Bucket) time.Time {
+	return b.UpdatedAt.Add(seconds((l.capacity() - b.Tokens) / l.rate()))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
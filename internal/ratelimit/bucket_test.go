@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]Limit{
+		"30/m":    {Requests: 30, Period: time.Minute},
+		"5/s:20":  {Requests: 5, Period: time.Second, Burst: 20},
+		"100/10m": {Requests: 100, Period: 10 * time.Minute},
+		" 1/h ":   {Requests: 1, Period: time.Hour},
+	}
+	for spec, want := range cases {
+		got, err := ParseLimit(spec)
+		assert.NoError(t, err, spec)
+		assert.Equal(t, want, got, spec)
+	}
+	for _, spec := range []string{"", "30", "0/m", "-1/m", "30/x", "30/m:0", "30/m:x", "30/-1m"} {
+		_, err := ParseLimit(spec)
+		assert.ErrorIs(t, err, ErrInvalidLimit, spec)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("transfers=10/m, signup=5/h:2,api=off,")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Period: time.Minute}, limits["transfers"])
+	assert.Equal(t, Limit{Requests: 5, Period: time.Hour, Burst: 2}, limits["signup"])
+	assert.Equal(t, Limit{}, limits["api"])
+
+	_, err = ParseLimits("transfers")
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+	_, err = ParseLimits("transfers=fast")
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Requests: 1, Period: time.Second, Burst: 3}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var b Bucket
+	var r Result
+
+	// A new bucket is full
+	for i := 2; i >= 0; i-- {
+		b, r = limit.Take(b, now)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 3, r.Limit)
+		assert.Equal(t, i, r.Remaining)
+	}
+	b, r = limit.Take(b, now)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Second, r.RetryAfter)
+	assert.Equal(t, 3*time.Second, r.ResetAfter)
+
+	// Tokens come back at the refill rate, never beyond the burst
+	b, r = limit.Take(b, now.Add(1500*time.Millisecond))
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+	b, r = limit.Take(b, now.Add(time.Hour))
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 2, r.Remaining)
+	assert.Equal(t, now.Add(time.Hour+time.Second), limit.expiresAt(b))
+}
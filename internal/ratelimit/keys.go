@@ -0,0 +1,17 @@
+package ratelimit
+
+import "net"
+
+// LoginUsernameKey is the key of the failed login counter of a username
+func LoginUsernameKey(username string) string {
+	return "login:username:" + username
+}
+
+// LoginIPKey is the key of the failed login counter of a client IP. Addresses are
+// canonicalised, so that an IPv6 address written differently maps to the same key.
+func LoginIPKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	return "login:ip:" + ip
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many writes pass between sweeps of expired counters
+const sweepEvery = 1024
+
+type memoryEntry struct {
+	counter   Counter
+	expiresAt time.Time
+}
+
+type memoryBucket struct {
+	bucket    Bucket
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters and buckets in process memory. They are lost on restart and
+// are not shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	buckets map[string]memoryBucket
+	writes  int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		buckets: make(map[string]memoryBucket),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key].counter, nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, policy Policy, now time.Time) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := policy.Next(s.entries[key].counter, now)
+	s.entries[key] = memoryEntry{counter: counter, expiresAt: counter.expiresAt(policy)}
+	s.wrote(now)
+	return counter, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, result := limit.Take(s.buckets[key].bucket, now)
+	s.buckets[key] = memoryBucket{bucket: bucket, expiresAt: limit.expiresAt(bucket)}
+	s.wrote(now)
+	return result, nil
+}
+
+// wrote counts a write and sweeps every sweepEvery writes
+func (s *MemoryStore) wrote(now time.Time) {
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+}
+
+// sweep drops expired counters and full buckets, so that keys sprayed by an attacker do
+// not pile up
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	for key, entry := range s.buckets {
+		if !now.Before(entry.expiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
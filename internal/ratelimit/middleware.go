@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/gin-gonic/gin"
+)
+
+// Route groups with a limit of their own
+const (
+	// GroupAPI covers every API request, per client IP
+	GroupAPI = "api"
+	// GroupAuth covers login, token refresh and the password and email token endpoints
+	GroupAuth = "auth"
+	// GroupSignup covers account sign-up
+	GroupSignup = "signup"
+	// GroupTransfers covers executing transfers, per user
+	GroupTransfers = "transfers"
+)
+
+// defaultLimits apply unless RATE_LIMITS overrides them
+var defaultLimits = map[string]Limit{
+	GroupAPI:       {Requests: 600, Period: time.Minute, Burst: 100},
+	GroupAuth:      {Requests: 20, Period: time.Minute},
+	GroupSignup:    {Requests: 10, Period: time.Hour, Burst: 3},
+	GroupTransfers: {Requests: 30, Period: time.Minute, Burst: 10},
+}
+
+// Response headers
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+)
+
+var ErrTooManyRequests = errors.New("too many requests; slow down")
+
+// ParseLimits reads a comma-separated list of group=limit pairs, such as
+// "transfers=10/m,signup=5/h:2". A limit of "off" disables the group.
+func ParseLimits(spec string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, limitSpec, ok := strings.Cut(pair, "=")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLimit, pair)
+		}
+		if limitSpec == "off" {
+			limits[group] = Limit{}
+			continue
+		}
+		limit, err := ParseLimit(limitSpec)
+		if err != nil {
+			return nil, err
+		}
+		limits[group] = limit
+	}
+	return limits, nil
+}
+
+var (
+	limits     map[string]Limit
+	limitsErr  error
+	limitsOnce sync.Once
+)
+
+// LimitFor returns the limit of a route group: RATE_LIMITS if it names the group, the
+// built-in default otherwise. A zero Limit means the group is not limited.
+func LimitFor(group string) (Limit, error) {
+	limitsOnce.Do(func() {
+		limits, limitsErr = ParseLimits(os.Getenv(common.RateLimits))
+	})
+	if limitsErr != nil {
+		return Limit{}, limitsErr
+	}
+	if limit, ok := limits[group]; ok {
+		return limit, nil
+	}
+	if limit, ok := defaultLimits[group]; ok {
+		return limit, nil
+	}
+	return Limit{}, fmt.Errorf("%w: no limit for group %q", ErrInvalidLimit, group)
+}
+
+// Middleware returns a Gin middleware that limits the requests of group with the limit from
+// LimitFor and the DefaultStore. Requests are counted per user once auth.UserMiddleware has
+// run, and per client IP before that or on anonymous routes.
+func Middleware(group string) gin.HandlerFunc {
+	limit, err := LimitFor(group)
+	if err != nil {
+		log.Fatalf("Error loading rate limit: %v", err)
+	}
+	store, err := DefaultStore()
+	if err != nil {
+		log.Fatalf("Error creating rate limit store: %v", err)
+	}
+	return NewMiddleware(store, group, limit)
+}
+
+// NewMiddleware returns a Gin middleware that limits the requests of group to limit, keeping
+// its buckets in store. Over the limit it answers 429 with a Retry-After header.
+func NewMiddleware(store Store, group string, limit Limit) gin.HandlerFunc {
+	if limit.Requests == 0 {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+	return func(ctx *gin.Context) {
+		now := time.Now()
+		result, err := store.Take(ctx, requestKey(ctx, group), limit, now)
+		if err != nil {
+			// Failing open: an unavailable store must not take the API down with it
+			log.Printf("ratelimit: failed to take token for %s: %v", group, err)
+			ctx.Next()
+			return
+		}
+		ctx.Header(HeaderLimit, strconv.Itoa(result.Limit))
+		ctx.Header(HeaderRemaining, strconv.Itoa(result.Remaining))
+		ctx.Header(HeaderReset, strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": ErrTooManyRequests.Error()})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// requestKey returns the bucket key of a request: its user when authenticated, its client
+// IP otherwise
+func requestKey(ctx *gin.Context, group string) string {
+	if userID := ctx.GetString("user_id"); userID != "" {
+		return "rate:" + group + ":user:" + userID
+	}
+	return "rate:" + group + ":ip:" + ctx.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
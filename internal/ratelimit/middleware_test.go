@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryStore()
+	router := gin.New()
+	router.GET("/", func(ctx *gin.Context) {
+		if userID := ctx.GetHeader("X-Test-User"); userID != "" {
+			ctx.Set("user_id", userID)
+		}
+		ctx.Next()
+	}, NewMiddleware(store, "test", Limit{Requests: 2, Period: time.Minute}), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(user, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set("X-Test-User", user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(HeaderLimit))
+	assert.Equal(t, "1", w.Header().Get(HeaderRemaining))
+	assert.Equal(t, "30", w.Header().Get(HeaderReset))
+	assert.Equal(t, http.StatusOK, request("", "10.0.0.1").Code)
+
+	w = request("", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get(HeaderRemaining))
+
+	// Other addresses and authenticated users have buckets of their own
+	assert.Equal(t, http.StatusOK, request("", "10.0.0.2").Code)
+	assert.Equal(t, http.StatusOK, request("user-1", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, request("user-1", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("user-1", "10.0.0.2").Code)
+}
+
+func TestMiddleware_Off(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", NewMiddleware(NewMemoryStore(), "test", Limit{}), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(HeaderLimit))
+	}
+}
+
+func TestMiddleware_ForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(trusted string) *gin.Engine {
+		router := gin.New()
+		assert.NoError(t, TrustProxies(router, trusted))
+		router.GET("/", NewMiddleware(NewMemoryStore(), "test", Limit{Requests: 1, Period: time.Minute}), func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+		return router
+	}
+	request := func(router *gin.Engine, remote, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote + ":1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without trusted proxies a spoofed X-Forwarded-For shares the remote address's bucket
+	router := newRouter("")
+	assert.Equal(t, http.StatusOK, request(router, "203.0.113.5", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "203.0.113.5", "198.51.100.2"))
+
+	// Behind a trusted proxy each forwarded client has a bucket of its own
+	router = newRouter("10.0.0.0/8")
+	assert.Equal(t, http.StatusOK, request(router, "10.0.0.1", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, request(router, "10.0.0.1", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "10.0.0.1", "198.51.100.2"))
+	// and a client that is not the proxy cannot claim another address
+	assert.Equal(t, http.StatusOK, request(router, "203.0.113.5", "198.51.100.3"))
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "203.0.113.5", "198.51.100.4"))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("")
+	assert.NoError(t, err)
+	assert.Nil(t, proxies)
+	proxies, err = ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.7 ,::1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.7", "::1"}, proxies)
+	_, err = ParseTrustedProxies("10.0.0.0/8,proxy.internal")
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps counters and buckets in the rate_limit_counters and rate_limit_buckets
+// tables, shared by every instance
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+func InitPostgresStore() *PostgresStore {
+	return &PostgresStore{DB: db.DB}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Counter, error) {
+	var row models.RateLimitCounter
+	err := s.DB.WithContext(ctx).Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Counter{}, nil
+	}
+	if err != nil {
+		return Counter{}, err
+	}
+	return counterFromRow(&row), nil
+}
+
+// RecordFailure locks the row of key, so concurrent failures are all counted
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, policy Policy, now time.Time) (Counter, error) {
+	var counter Counter
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RateLimitCounter{Key: key, LastFailureAt: now, ExpiresAt: now}).Error
+		if err != nil {
+			return err
+		}
+		var row models.RateLimitCounter
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error
+		if err != nil {
+			return err
+		}
+		counter = policy.Next(counterFromRow(&row), now)
+		var blockedUntil *time.Time
+		if !counter.BlockedUntil.IsZero() {
+			blockedUntil = &counter.BlockedUntil
+		}
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"failures":        counter.Failures,
+			"last_failure_at": counter.LastFailureAt,
+			"blocked_until":   blockedUntil,
+			"locked":          counter.Locked,
+			"expires_at":      counter.expiresAt(policy),
+		}).Error
+	})
+	if err != nil {
+		return Counter{}, err
+	}
+	return counter, nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.DB.WithContext(ctx).Where("key = ?", key).Delete(&models.RateLimitCounter{}).Error
+}
+
+// Take locks the row of key, so concurrent requests cannot take the same token
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	var result Result
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// A new bucket starts full
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RateLimitBucket{Key: key, Tokens: limit.capacity(), UpdatedAt: now, ExpiresAt: now}).Error
+		if err != nil {
+			return err
+		}
+		var row models.RateLimitBucket
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error
+		if err != nil {
+			return err
+		}
+		var bucket Bucket
+		bucket, result = limit.Take(Bucket{Tokens: row.Tokens, UpdatedAt: row.UpdatedAt}, now)
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"tokens":     bucket.Tokens,
+			"updated_at": bucket.UpdatedAt,
+			"expires_at": limit.expiresAt(bucket),
+		}).Error
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// DeleteExpired removes counters that no longer block anything and buckets that are full
+func (s *PostgresStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at <= ?", now).Delete(&models.RateLimitCounter{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("expires_at <= ?", now).Delete(&models.RateLimitBucket{}).Error
+	})
+}
+
+func counterFromRow(row *models.RateLimitCounter) Counter {
+	counter := Counter{
+		Failures:      row.Failures,
+		LastFailureAt: row.LastFailureAt,
+		Locked:        row.Locked,
+	}
+	if row.BlockedUntil != nil {
+		counter.BlockedUntil = *row.BlockedUntil
+	}
+	return counter
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseTrustedProxies reads a comma-separated list of proxy addresses and CIDR ranges, such
+// as "10.0.0.0/8,192.168.1.7". An empty list trusts no proxy.
+func ParseTrustedProxies(spec string) ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(spec, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// TrustProxies makes engine take the client IP from X-Forwarded-For only on requests from
+// the proxies in spec, see ParseTrustedProxies. Gin trusts every proxy by default, which
+// lets any client pick the address its per-IP limits and login counters are kept under.
+func TrustProxies(engine *gin.Engine, spec string) error {
+	proxies, err := ParseTrustedProxies(spec)
+	if err != nil {
+		return err
+	}
+	return engine.SetTrustedProxies(proxies)
+}
@@ -0,0 +1,156 @@
+// Package ratelimit slows down abusive clients, with failure counters that back off and
+// lock out repeated failures and token buckets that cap request rates. Both live in a
+// Store, in memory for a single instance or in Postgres when several instances must share
+// them.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+)
+
+// Store backends selectable with RATE_LIMIT_STORE
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+var ErrUnknownStore = errors.New("unknown rate limit store")
+
+// Store keeps failure counters and token buckets by key
+type Store interface {
+	// Get returns the counter of key, the zero Counter if there is none
+	Get(ctx context.Context, key string) (Counter, error)
+	// RecordFailure counts a failure of key at now under policy and returns the new counter
+	RecordFailure(ctx context.Context, key string, policy Policy, now time.Time) (Counter, error)
+	// Reset forgets every failure of key, lifting any backoff or lockout
+	Reset(ctx context.Context, key string) error
+	// Take takes a token from the bucket of key under limit at now
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Policy decides how failures turn into backoff and lockout
+type Policy struct {
+	// Failures tolerated before any backoff
+	FreeFailures int
+	// Backoff after the first failure beyond FreeFailures; it doubles with every further one
+	BaseDelay time.Duration
+	// Upper bound of the backoff
+	MaxDelay time.Duration
+	// Failures that lock the key for LockoutDuration; zero never locks
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// A key without failures for this long starts over
+	Window time.Duration
+}
+
+// Counter is the failure state of one key
+type Counter struct {
+	Failures      int
+	LastFailureAt time.Time
+	// BlockedUntil is the end of the current backoff or lockout
+	BlockedUntil time.Time
+	// Locked is set when the block is a lockout rather than a backoff
+	Locked bool
+}
+
+// Blocked reports whether the key may not be tried at now
+func (c Counter) Blocked(now time.Time) bool {
+	return now.Before(c.BlockedUntil)
+}
+
+// RetryAfter returns how long the key stays blocked after now
+func (c Counter) RetryAfter(now time.Time) time.Duration {
+	if !c.Blocked(now) {
+		return 0
+	}
+	return c.BlockedUntil.Sub(now)
+}
+
+// stale reports whether the counter should start over at now. Lockouts end automatically.
+func (c Counter) stale(policy Policy, now time.Time) bool {
+	if c.Failures == 0 {
+		return true
+	}
+	if c.Locked {
+		return !c.Blocked(now)
+	}
+	return policy.Window > 0 && now.Sub(c.LastFailureAt) >= policy.Window
+}
+
+// expiresAt returns when the counter can be dropped by the store
+func (c Counter) expiresAt(policy Policy) time.Time {
+	expires := c.LastFailureAt.Add(policy.Window)
+	if c.BlockedUntil.After(expires) {
+		expires = c.BlockedUntil
+	}
+	return expires
+}
+
+// Next returns counter c after one more failure at now
+func (p Policy) Next(c Counter, now time.Time) Counter {
+	if c.stale(p, now) {
+		c = Counter{}
+	}
+	c.Failures++
+	c.LastFailureAt = now
+	c.BlockedUntil = time.Time{}
+	c.Locked = false
+	switch {
+	case p.LockoutAfter > 0 && c.Failures >= p.LockoutAfter:
+		c.Locked = true
+		c.BlockedUntil = now.Add(p.LockoutDuration)
+	case c.Failures > p.FreeFailures:
+		c.BlockedUntil = now.Add(p.delay(c.Failures - p.FreeFailures))
+	}
+	return c
+}
+
+// delay returns the backoff after the nth failure beyond the free ones
+func (p Policy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+var (
+	defaultStore     Store
+	defaultStoreErr  error
+	defaultStoreOnce sync.Once
+)
+
+// DefaultStore returns the store selected by RATE_LIMIT_STORE, memory by default. It is
+// shared by everything in the process, so that an admin unlock reaches the login counters.
+func DefaultStore() (Store, error) {
+	defaultStoreOnce.Do(func() {
+		defaultStore, defaultStoreErr = NewStoreFromEnv()
+	})
+	return defaultStore, defaultStoreErr
+}
+
+// NewStoreFromEnv returns a new store of the type selected by RATE_LIMIT_STORE
+func NewStoreFromEnv() (Store, error) {
+	switch kind := strings.ToLower(os.Getenv(common.RateLimitStore)); kind {
+	case "", StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return InitPostgresStore(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, kind)
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = Policy{
+	FreeFailures:    2,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAfter:    8,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var c Counter
+	wantDelays := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range wantDelays {
+		c = testPolicy.Next(c, now)
+		assert.Equal(t, i+1, c.Failures)
+		assert.Equal(t, want, c.RetryAfter(now), "failure %d", i+1)
+		assert.False(t, c.Locked)
+	}
+
+	c = testPolicy.Next(c, now)
+	assert.True(t, c.Locked)
+	assert.True(t, c.Blocked(now.Add(59*time.Minute)))
+
+	// Lockouts end on their own and the count starts over
+	assert.False(t, c.Blocked(now.Add(time.Hour)))
+	c = testPolicy.Next(c, now.Add(time.Hour))
+	assert.Equal(t, 1, c.Failures)
+	assert.False(t, c.Locked)
+}
+
+func TestPolicy_Window(t *testing.T) {
+	now := time.Now()
+	c := testPolicy.Next(Counter{}, now)
+	c = testPolicy.Next(c, now)
+	c = testPolicy.Next(c, now.Add(testPolicy.Window))
+	assert.Equal(t, 1, c.Failures)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	c, err := store.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Zero(t, c.Failures)
+
+	for i := 0; i < 3; i++ {
+		c, err = store.RecordFailure(ctx, "k", testPolicy, now)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, c.Failures)
+	assert.True(t, c.Blocked(now))
+
+	got, err := store.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	assert.NoError(t, store.Reset(ctx, "k"))
+	got, err = store.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Zero(t, got.Failures)
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	_, _ = store.RecordFailure(context.Background(), "old", testPolicy, now.Add(-2*time.Hour))
+	_, _ = store.RecordFailure(context.Background(), "new", testPolicy, now)
+	store.sweep(now)
+	assert.Len(t, store.entries, 1)
+}
+
+func TestLoginIPKey(t *testing.T) {
+	assert.Equal(t, LoginIPKey("2001:db8::1"), LoginIPKey("2001:0db8:0000::0001"))
+	assert.Equal(t, "login:ip:10.0.0.1", LoginIPKey("10.0.0.1"))
+}
@@ -0,0 +1,222 @@
+package scheduled
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service *Service
+}
+
+// @Summary Create a scheduled transfer
+// @Description Sets up a standing order, paid once at run_at or repeatedly on a cron schedule in the given time zone.
+// @Description Orders that reach the STEP_UP_THRESHOLDS amount need a TOTP code in the X-TOTP-Code header when created.
+// @Tags scheduled-transfer
+// @Security JWT
+// @Accept json
+// @Produce json
+// @Param request body CreateScheduledTransferRequest true "Standing order"
+// @Param X-TOTP-Code header string false "TOTP code, required above the step-up threshold"
+// @Success 201 {object} ScheduledTransferResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/transfers/scheduled [post]
+func (c *Controller) create(ctx *gin.Context) {
+	var req CreateScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	st, err := c.service.Create(ctx, subject.UserID, req, ctx.GetHeader(transfer.StepUpHeader))
+	if err != nil {
+		ctx.JSON(scheduledErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"data": toResponse(st)})
+}
+
+// @Summary List scheduled transfers
+// @Description Returns the caller's standing orders, newest first.
+// @Tags scheduled-transfer
+// @Security JWT
+// @Success 200 {array} ScheduledTransferResponse
+// @Router /api/v1/transfers/scheduled [get]
+func (c *Controller) list(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	list, err := c.service.List(ctx, subject.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	data := make([]ScheduledTransferResponse, 0, len(list))
+	for i := range list {
+		data = append(data, toResponse(&list[i]))
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// @Summary Get a scheduled transfer
+// @Description Only its owner and staff can see a standing order; anyone else gets a 404.
+// @Tags scheduled-transfer
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Success 200 {object} ScheduledTransferResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/transfers/scheduled/{id} [get]
+func (c *Controller) get(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	st, err := c.service.Get(ctx, item.ID, subject)
+	if err != nil {
+		ctx.JSON(scheduledErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": toResponse(st)})
+}
+
+// @Summary List the runs of a scheduled transfer
+// @Description Returns every payment attempt of a standing order with its outcome, newest first.
+// @Tags scheduled-transfer
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Success 200 {array} RunResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/transfers/scheduled/{id}/runs [get]
+func (c *Controller) runs(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	runs, err := c.service.Runs(ctx, item.ID, subject)
+	if err != nil {
+		ctx.JSON(scheduledErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	data := make([]RunResponse, 0, len(runs))
+	for _, run := range runs {
+		data = append(data, toRunResponse(run))
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// @Summary Update a scheduled transfer
+// @Description Changes the amount, schedule, time zone, end date or status (active or paused) of a standing order.
+// @Description A new amount that reaches the step-up threshold needs a TOTP code in the X-TOTP-Code header.
+// @Tags scheduled-transfer
+// @Security JWT
+// @Accept json
+// @Produce json
+// @param id path string true "uuid of item"
+// @Param request body UpdateScheduledTransferRequest true "Fields to change"
+// @Param X-TOTP-Code header string false "TOTP code, required above the step-up threshold"
+// @Success 200 {object} ScheduledTransferResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/transfers/scheduled/{id} [patch]
+func (c *Controller) update(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var req UpdateScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	st, err := c.service.Update(ctx, item.ID, subject.UserID, req, ctx.GetHeader(transfer.StepUpHeader))
+	if err != nil {
+		ctx.JSON(scheduledErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": toResponse(st)})
+}
+
+// @Summary Cancel a scheduled transfer
+// @Description Stops a standing order. It is kept, with its runs, as cancelled.
+// @Tags scheduled-transfer
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/transfers/scheduled/{id} [delete]
+func (c *Controller) cancel(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if err := c.service.Cancel(ctx, item.ID, subject.UserID); err != nil {
+		ctx.JSON(scheduledErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// scheduledErrorStatus maps service errors to HTTP status codes
+func scheduledErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, transfer.ErrStepUpRequired), errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrCodeReused):
+		return http.StatusUnauthorized
+	case errors.Is(err, transfer.ErrNotAccountOwner), errors.Is(err, transfer.ErrStepUpUnavailable):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound), errors.Is(err, transfer.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrFinished), errors.Is(err, transfer.ErrCurrencyMismatch):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
@@ -0,0 +1,176 @@
+package scheduled
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Embedded zone data, so that schedules in any time zone work without system tzdata
+	_ "time/tzdata"
+)
+
+// Errors
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrInvalidTimezone = errors.New("invalid timezone")
+)
+
+// maxSearch bounds the search for the next run; a schedule such as "0 0 30 2 *" never runs
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule is a five-field cron expression: minute hour day-of-month month day-of-week.
+// Fields take *, numbers, ranges (1-5), lists (1,15) and steps (*/2, 1-11/2). Month and
+// weekday names are not supported; Sunday is 0 or 7. When both day fields are restricted a
+// day matching either runs, as in cron. The minute must be a single value, so a standing
+// order runs at most once an hour.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a * day field, which defers to the other day field
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+// macros are shorthands for common schedules
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+}
+
+// ParseSchedule parses a cron expression evaluated in the named IANA time zone
+func ParseSchedule(expr, timezone string) (*Schedule, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || strings.EqualFold(timezone, "local") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, timezone)
+	}
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: want 5 fields, got %d", ErrInvalidSchedule, len(fields))
+	}
+	if _, err := strconv.Atoi(fields[0]); err != nil {
+		return nil, fmt.Errorf("%w: the minute must be a single number", ErrInvalidSchedule)
+	}
+
+	s := &Schedule{loc: loc}
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		bits, err := parseField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, err
+		}
+		*b.field = bits
+	}
+	// Sunday may be written as 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+// parseField parses one comma-separated cron field into a bit set
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: bad step in %q", ErrInvalidSchedule, part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rangeSpec != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if lo, err = strconv.Atoi(loSpec); err != nil {
+				return 0, fmt.Errorf("%w: bad value in %q", ErrInvalidSchedule, part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiSpec); err != nil {
+					return 0, fmt.Errorf("%w: bad value in %q", ErrInvalidSchedule, part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%w: %q is outside %d-%d", ErrInvalidSchedule, part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Location returns the time zone the schedule is evaluated in
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// Next returns the first run strictly after t, or the zero time if there is none within
+// five years. The search walks the wall clock with no zone attached, so that DST changes
+// cannot loop it; a run inside a DST gap happens at the same offset after the gap.
+func (s *Schedule) Next(t time.Time) time.Time {
+	local := t.In(s.loc)
+	c := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), 0, 0, time.UTC).
+		Add(time.Minute)
+	limit := c.Add(maxSearch)
+	for c.Before(limit) {
+		switch {
+		case s.month&(1<<int(c.Month())) == 0:
+			c = time.Date(c.Year(), c.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(c):
+			c = time.Date(c.Year(), c.Month(), c.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<c.Hour()) == 0:
+			c = c.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<c.Minute()) == 0:
+			c = c.Add(time.Minute)
+		default:
+			// A wall time repeated when clocks go back maps to its first occurrence, which
+			// may already be behind t
+			run := time.Date(c.Year(), c.Month(), c.Day(), c.Hour(), c.Minute(), 0, 0, s.loc)
+			if run.Hour() != c.Hour() || run.Minute() != c.Minute() {
+				// c falls in a DST gap, which time.Date resolves to an instant before it;
+				// keep the offset from before the gap instead
+				_, offset := run.Zone()
+				run = c.Add(-time.Duration(offset) * time.Second).In(s.loc)
+			}
+			if run.After(t) {
+				return run
+			}
+			c = c.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,93 @@
+package scheduled
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	cases := []struct{ expr, timezone string }{
+		{"0 9 1 *", "UTC"},
+		{"* 9 1 * *", "UTC"},
+		{"*/5 9 1 * *", "UTC"},
+		{"0 24 * * *", "UTC"},
+		{"0 9 0 * *", "UTC"},
+		{"0 9 1 13 *", "UTC"},
+		{"0 9 * * 8", "UTC"},
+		{"0 9 5-1 * *", "UTC"},
+		{"0 9 */0 * *", "UTC"},
+		{"0 9 1 jan *", "UTC"},
+	}
+	for _, tc := range cases {
+		_, err := ParseSchedule(tc.expr, tc.timezone)
+		assert.ErrorIs(t, err, ErrInvalidSchedule, tc.expr)
+	}
+	_, err := ParseSchedule("0 9 1 * *", "Mars/Olympus")
+	assert.ErrorIs(t, err, ErrInvalidTimezone)
+	_, err = ParseSchedule("0 9 1 * *", "")
+	assert.ErrorIs(t, err, ErrInvalidTimezone)
+}
+
+func TestSchedule_Next(t *testing.T) {
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		assert.NoError(t, err)
+		return v
+	}
+	cases := []struct {
+		expr, from, want string
+	}{
+		// 1st of every month at 09:00
+		{"0 9 1 * *", "2024-01-15 10:00", "2024-02-01 09:00"},
+		{"0 9 1 * *", "2024-02-01 08:59", "2024-02-01 09:00"},
+		{"0 9 1 * *", "2024-02-01 09:00", "2024-03-01 09:00"},
+		{"0 9 1 * *", "2024-12-31 23:59", "2025-01-01 09:00"},
+		// 31st only exists in some months
+		{"30 12 31 * *", "2024-04-01 00:00", "2024-05-31 12:30"},
+		// leap day
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// every Monday and Friday at 08:15; Sunday as 7
+		{"15 8 * * 1,5", "2024-01-03 00:00", "2024-01-05 08:15"},
+		{"0 6 * * 7", "2024-01-01 00:00", "2024-01-07 06:00"},
+		// both day fields restricted: either matches
+		{"0 0 13 * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+		// steps and ranges
+		{"0 */6 * * *", "2024-01-01 07:00", "2024-01-01 12:00"},
+		{"0 9-17/4 * * 1-5", "2024-01-06 00:00", "2024-01-08 09:00"},
+		{"@monthly", "2024-01-15 10:00", "2024-02-01 00:00"},
+		{"@weekly", "2024-01-01 00:00", "2024-01-07 00:00"},
+	}
+	for _, tc := range cases {
+		s, err := ParseSchedule(tc.expr, "UTC")
+		assert.NoError(t, err, tc.expr)
+		assert.Equal(t, utc(tc.want), s.Next(utc(tc.from)).UTC(), "%s after %s", tc.expr, tc.from)
+	}
+
+	never, err := ParseSchedule("0 0 30 2 *", "UTC")
+	assert.NoError(t, err)
+	assert.True(t, never.Next(utc("2024-01-01 00:00")).IsZero())
+}
+
+func TestSchedule_Timezone(t *testing.T) {
+	s, err := ParseSchedule("0 9 1 * *", "Africa/Cairo")
+	assert.NoError(t, err)
+	next := s.Next(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC), next.UTC())
+
+	// A run inside a DST gap moves to the first valid time after it
+	ny, err := ParseSchedule("30 2 * * *", "America/New_York")
+	assert.NoError(t, err)
+	loc := ny.Location()
+	next = ny.Next(time.Date(2024, 3, 10, 0, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2024, 3, 10, 3, 30, 0, 0, loc), next)
+
+	// A wall time repeated when clocks go back runs once
+	nightly, err := ParseSchedule("30 1 * * *", "America/New_York")
+	assert.NoError(t, err)
+	first := nightly.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), first.UTC())
+	second := nightly.Next(first)
+	assert.Equal(t, time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC), second.UTC())
+}
@@ -0,0 +1,70 @@
+package scheduled
+
+import (
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+)
+
+// CreateScheduledTransferRequest sets up a standing order. Give either a schedule or run_at.
+type CreateScheduledTransferRequest struct {
+	FromAccountID string `json:"from_account_id" binding:"required"`
+	ToAccountID   string `json:"to_account_id" binding:"required"`
+	// Amount to debit at every payment, in the source account's currency
+	Amount money.Money `json:"amount" binding:"required"`
+	// Cron expression: minute hour day-of-month month day-of-week, e.g. "0 9 1 * *" for
+	// 09:00 on the 1st of every month, or @daily, @weekly, @monthly, @yearly
+	Schedule string `json:"schedule,omitempty"`
+	// IANA time zone the schedule is evaluated in, e.g. Africa/Cairo; defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Time of a one-off transfer
+	RunAt *time.Time `json:"run_at,omitempty"`
+	// No payment is made after this time
+	EndAt *time.Time `json:"end_at,omitempty"`
+}
+
+// UpdateScheduledTransferRequest changes a standing order. Omitted fields stay as they are.
+type UpdateScheduledTransferRequest struct {
+	Amount   *money.Money `json:"amount,omitempty"`
+	Schedule *string      `json:"schedule,omitempty"`
+	Timezone *string      `json:"timezone,omitempty"`
+	EndAt    *time.Time   `json:"end_at,omitempty"`
+	// active or paused
+	Status *string `json:"status,omitempty"`
+}
+
+// ScheduledTransferResponse describes a standing order.
+type ScheduledTransferResponse struct {
+	ID            string      `json:"id"`
+	FromAccountID string      `json:"from_account_id"`
+	ToAccountID   string      `json:"to_account_id"`
+	Amount        money.Money `json:"amount"`
+	// Empty for a one-off transfer
+	Schedule string `json:"schedule,omitempty"`
+	Timezone string `json:"timezone"`
+	// active, paused, completed, failed or cancelled
+	Status string `json:"status"`
+	// Scheduled time of the next payment
+	NextOccurrenceAt string `json:"next_occurrence_at,omitempty"`
+	// When the next payment is attempted; later than next_occurrence_at while retrying
+	NextRunAt string `json:"next_run_at,omitempty"`
+	EndAt     string `json:"end_at,omitempty"`
+	// Failed attempts at the next payment
+	Attempts  int    `json:"attempts"`
+	LastRunAt string `json:"last_run_at,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// RunResponse describes one attempt at a payment.
+type RunResponse struct {
+	ID string `json:"id"`
+	// Scheduled time of the payment
+	OccurrenceAt string `json:"occurrence_at"`
+	Attempt      int    `json:"attempt"`
+	// succeeded, failed, or skipped when the payment was given up after the last retry
+	Status     string `json:"status"`
+	TransferID string `json:"transfer_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
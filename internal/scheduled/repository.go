@@ -0,0 +1,106 @@
+package scheduled
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{DB: db.DB}
+}
+
+func (r *Repository) create(ctx context.Context, st *models.ScheduledTransfer) error {
+	return r.DB.WithContext(ctx).Create(st).Error
+}
+
+func (r *Repository) get(ctx context.Context, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	var st models.ScheduledTransfer
+	err := r.DB.WithContext(ctx).Where("id = ?", id).First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// listByUser returns the scheduled transfers of a user, newest first
+func (r *Repository) listByUser(ctx context.Context, userID uuid.UUID) ([]models.ScheduledTransfer, error) {
+	var list []models.ScheduledTransfer
+	err := r.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+// listRuns returns the runs of a scheduled transfer, newest first
+func (r *Repository) listRuns(ctx context.Context, id uuid.UUID) ([]models.ScheduledTransferRun, error) {
+	var runs []models.ScheduledTransferRun
+	err := r.DB.WithContext(ctx).
+		Where("scheduled_transfer_id = ?", id).
+		Order("created_at DESC").
+		Find(&runs).Error
+	return runs, err
+}
+
+// withLocked runs fn in a transaction holding the row lock of a scheduled transfer. The
+// worker skips locked rows, so a transfer is never run while it is being changed.
+func (r *Repository) withLocked(ctx context.Context, id uuid.UUID, fn func(tx *gorm.DB, st *models.ScheduledTransfer) error) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var st models.ScheduledTransfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&st).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return fn(tx, &st)
+	})
+}
+
+// claimDue locks the active scheduled transfer that has been due the longest, skipping rows
+// that another worker holds, so that replicas never run the same transfer twice. It returns
+// nil when nothing is due.
+func claimDue(tx *gorm.DB, now time.Time) (*models.ScheduledTransfer, error) {
+	var st models.ScheduledTransfer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_run_at <= ?", models.ScheduledTransferStatusActive, now).
+		Order("next_run_at").
+		First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// saveRun records a run and the new state of its scheduled transfer
+func saveRun(tx *gorm.DB, st *models.ScheduledTransfer, run *models.ScheduledTransferRun) error {
+	if err := tx.Create(run).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.ScheduledTransfer{}).Where("id = ?", st.ID).Updates(map[string]interface{}{
+		"status":             st.Status,
+		"next_occurrence_at": st.NextOccurrenceAt,
+		"next_run_at":        st.NextRunAt,
+		"attempts":           st.Attempts,
+		"last_run_at":        st.LastRunAt,
+		"last_error":         st.LastError,
+	}).Error
+}
@@ -0,0 +1,22 @@
+package scheduled
+
+import (
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the caller's standing orders
+func RegisterRoutes(routerGroup *gin.RouterGroup) {
+	service := InitService()
+	controller := NewController(service)
+
+	routerGroup.Use(auth.UserMiddleware())
+
+	routerGroup.GET("", controller.list)
+	routerGroup.POST("", idempotency.Middleware(), controller.create)
+	routerGroup.GET("/:id", controller.get)
+	routerGroup.GET("/:id/runs", controller.runs)
+	routerGroup.PATCH("/:id", controller.update)
+	routerGroup.DELETE("/:id", controller.cancel)
+}
@@ -0,0 +1,320 @@
+// Package scheduled manages standing orders: transfers paid once at a given time or
+// repeatedly on a cron schedule. A Worker pays them when due through transfer.Repository.
+package scheduled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errors
+var (
+	ErrNotFound        = errors.New("scheduled transfer not found")
+	ErrScheduleOrRunAt = errors.New("give either a schedule or run_at")
+	ErrRunAtInPast     = errors.New("run_at must be in the future")
+	ErrEndBeforeStart  = errors.New("end_at is before the first payment")
+	ErrInvalidStatus   = errors.New("status must be active or paused")
+	ErrFinished        = errors.New("scheduled transfer has finished and cannot be changed")
+)
+
+type Service struct {
+	repo      *Repository
+	transfers *transfer.Service
+	now       func() time.Time
+}
+
+func NewService(repository *Repository, transfers *transfer.Service) *Service {
+	return &Service{
+		repo:      repository,
+		transfers: transfers,
+		now:       time.Now,
+	}
+}
+
+func InitService() *Service {
+	return NewService(InitRepository(), transfer.InitService())
+}
+
+// Create sets up a standing order for userID. Orders that reach the step-up threshold need
+// a TOTP code now, since nobody is around to give one when they run.
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, req CreateScheduledTransferRequest, stepUpCode string) (*models.ScheduledTransfer, error) {
+	fromID, err := uuid.Parse(req.FromAccountID)
+	if err != nil {
+		return nil, errors.New("invalid from_account_id")
+	}
+	toID, err := uuid.Parse(req.ToAccountID)
+	if err != nil {
+		return nil, errors.New("invalid to_account_id")
+	}
+	if fromID == toID {
+		return nil, transfer.ErrSameAccount
+	}
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("amount must be positive")
+	}
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	schedule := strings.TrimSpace(req.Schedule)
+	first, err := firstOccurrence(schedule, timezone, req.RunAt, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if req.EndAt != nil && req.EndAt.Before(first) {
+		return nil, ErrEndBeforeStart
+	}
+	if err := s.checkAccounts(ctx, userID, fromID, toID, req.Amount.Currency); err != nil {
+		return nil, err
+	}
+	if err := s.transfers.CheckStepUp(ctx, userID.String(), req.Amount, stepUpCode); err != nil {
+		return nil, err
+	}
+
+	st := &models.ScheduledTransfer{
+		UserID:           userID,
+		FromAccountID:    fromID,
+		ToAccountID:      toID,
+		Amount:           req.Amount.Amount,
+		Currency:         req.Amount.Currency,
+		Schedule:         schedule,
+		Timezone:         timezone,
+		Status:           models.ScheduledTransferStatusActive,
+		NextOccurrenceAt: &first,
+		NextRunAt:        &first,
+		EndAt:            req.EndAt,
+	}
+	if err := s.repo.create(ctx, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// List returns the standing orders of userID
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]models.ScheduledTransfer, error) {
+	return s.repo.listByUser(ctx, userID)
+}
+
+// Get loads a standing order that subject may view. Hidden ones are reported as not found.
+func (s *Service) Get(ctx context.Context, scheduledID string, subject authz.Subject) (*models.ScheduledTransfer, error) {
+	id, err := uuid.Parse(scheduledID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	st, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !authz.CanView(subject, st) {
+		return nil, ErrNotFound
+	}
+	return st, nil
+}
+
+// Runs returns the payment attempts of a standing order that subject may view
+func (s *Service) Runs(ctx context.Context, scheduledID string, subject authz.Subject) ([]models.ScheduledTransferRun, error) {
+	st, err := s.Get(ctx, scheduledID, subject)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.listRuns(ctx, st.ID)
+}
+
+// Update changes the amount, schedule, end date or status of an active or paused standing
+// order of userID. A new schedule, or resuming a recurring order, starts from the next time
+// the schedule matches; payments missed while paused are not made.
+func (s *Service) Update(ctx context.Context, scheduledID string, userID uuid.UUID, req UpdateScheduledTransferRequest, stepUpCode string) (*models.ScheduledTransfer, error) {
+	id, err := uuid.Parse(scheduledID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	if req.Status != nil && *req.Status != models.ScheduledTransferStatusActive && *req.Status != models.ScheduledTransferStatusPaused {
+		return nil, ErrInvalidStatus
+	}
+	if req.Amount != nil {
+		if !req.Amount.IsPositive() {
+			return nil, errors.New("amount must be positive")
+		}
+		if err := s.transfers.CheckStepUp(ctx, userID.String(), *req.Amount, stepUpCode); err != nil {
+			return nil, err
+		}
+	}
+
+	var updated *models.ScheduledTransfer
+	err = s.repo.withLocked(ctx, id, func(tx *gorm.DB, st *models.ScheduledTransfer) error {
+		if st.UserID != userID {
+			return ErrNotFound
+		}
+		if !changeable(st) {
+			return ErrFinished
+		}
+		reschedule := false
+		if req.Amount != nil {
+			if req.Amount.Currency != st.Currency {
+				return transfer.ErrCurrencyMismatch
+			}
+			st.Amount = req.Amount.Amount
+		}
+		if req.Schedule != nil {
+			st.Schedule = strings.TrimSpace(*req.Schedule)
+			if st.Schedule == "" {
+				return fmt.Errorf("%w: schedule cannot be empty", ErrInvalidSchedule)
+			}
+			reschedule = true
+		}
+		if req.Timezone != nil {
+			st.Timezone = *req.Timezone
+			reschedule = reschedule || st.Schedule != ""
+		}
+		if req.Status != nil {
+			resumed := st.Status == models.ScheduledTransferStatusPaused && *req.Status == models.ScheduledTransferStatusActive
+			reschedule = reschedule || (resumed && st.Schedule != "")
+			st.Status = *req.Status
+		}
+		if req.EndAt != nil {
+			st.EndAt = req.EndAt
+		}
+		if reschedule {
+			next, err := firstOccurrence(st.Schedule, st.Timezone, nil, s.now())
+			if err != nil {
+				return err
+			}
+			st.NextOccurrenceAt = &next
+			st.NextRunAt = &next
+			st.Attempts = 0
+		}
+		if st.EndAt != nil && st.NextOccurrenceAt != nil && st.EndAt.Before(*st.NextOccurrenceAt) {
+			return ErrEndBeforeStart
+		}
+		updated = st
+		return tx.Save(st).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Cancel stops an active or paused standing order of userID. A payment that is running
+// finishes first. The order and its runs are kept.
+func (s *Service) Cancel(ctx context.Context, scheduledID string, userID uuid.UUID) error {
+	id, err := uuid.Parse(scheduledID)
+	if err != nil {
+		return ErrNotFound
+	}
+	return s.repo.withLocked(ctx, id, func(tx *gorm.DB, st *models.ScheduledTransfer) error {
+		if st.UserID != userID {
+			return ErrNotFound
+		}
+		if !changeable(st) {
+			return ErrFinished
+		}
+		return tx.Model(st).Updates(map[string]interface{}{
+			"status":      models.ScheduledTransferStatusCancelled,
+			"next_run_at": nil,
+		}).Error
+	})
+}
+
+// changeable reports whether a standing order may still be updated or cancelled
+func changeable(st *models.ScheduledTransfer) bool {
+	return st.Status == models.ScheduledTransferStatusActive || st.Status == models.ScheduledTransferStatusPaused
+}
+
+// checkAccounts rejects standing orders that could never be paid. The worker checks the
+// accounts again at every payment.
+func (s *Service) checkAccounts(ctx context.Context, userID, fromID, toID uuid.UUID, currency string) error {
+	var from, to models.Account
+	err := s.repo.DB.WithContext(ctx).Where("id = ?", fromID).First(&from).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return transfer.ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if from.UserID != userID {
+		return transfer.ErrNotAccountOwner
+	}
+	if from.Currency != currency {
+		return transfer.ErrCurrencyMismatch
+	}
+	err = s.repo.DB.WithContext(ctx).Where("id = ?", toID).First(&to).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && to.IsSystem) {
+		return transfer.ErrAccountNotFound
+	}
+	return err
+}
+
+// firstOccurrence returns when a standing order is first paid: at runAt for a one-off
+// transfer, otherwise the first time after now that its schedule matches
+func firstOccurrence(schedule, timezone string, runAt *time.Time, now time.Time) (time.Time, error) {
+	if (schedule == "") == (runAt == nil) {
+		return time.Time{}, ErrScheduleOrRunAt
+	}
+	if runAt != nil {
+		if !runAt.After(now) {
+			return time.Time{}, ErrRunAtInPast
+		}
+		return *runAt, nil
+	}
+	sched, err := ParseSchedule(schedule, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := sched.Next(now)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: %q never runs", ErrInvalidSchedule, schedule)
+	}
+	return next, nil
+}
+
+func toResponse(st *models.ScheduledTransfer) ScheduledTransferResponse {
+	return ScheduledTransferResponse{
+		ID:               st.ID.String(),
+		FromAccountID:    st.FromAccountID.String(),
+		ToAccountID:      st.ToAccountID.String(),
+		Amount:           money.Money{Amount: st.Amount, Currency: st.Currency},
+		Schedule:         st.Schedule,
+		Timezone:         st.Timezone,
+		Status:           st.Status,
+		NextOccurrenceAt: formatTime(st.NextOccurrenceAt),
+		NextRunAt:        formatTime(st.NextRunAt),
+		EndAt:            formatTime(st.EndAt),
+		Attempts:         st.Attempts,
+		LastRunAt:        formatTime(st.LastRunAt),
+		LastError:        st.LastError,
+		CreatedAt:        st.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toRunResponse(run models.ScheduledTransferRun) RunResponse {
+	resp := RunResponse{
+		ID:           run.ID.String(),
+		OccurrenceAt: run.OccurrenceAt.Format(time.RFC3339),
+		Attempt:      run.Attempt,
+		Status:       run.Status,
+		Error:        run.Error,
+		CreatedAt:    run.CreatedAt.Format(time.RFC3339),
+	}
+	if run.TransferID != nil {
+		resp.TransferID = run.TransferID.String()
+	}
+	return resp
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,255 @@
+package scheduled
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	if err := db.Open(os.Getenv("DB_SOURCE_TEST")); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+	if err := db.AddUUIDExtension(); err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+	if err := db.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{}, &models.Account{}, &models.Journal{}, &models.Entry{},
+		&models.Transfer{}, &models.FxQuote{}, &models.ScheduledTransfer{}, &models.ScheduledTransferRun{}, &models.AuditLog{}, &models.OutboxEvent{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+	os.Exit(m.Run())
+}
+
+func setupTestService(t *testing.T) *Service {
+	repo := InitRepository()
+	t.Cleanup(func() {
+		repo.DB.Exec("DELETE FROM scheduled_transfer_runs")
+		repo.DB.Exec("DELETE FROM scheduled_transfers")
+		repo.DB.Exec("DELETE FROM transfers")
+		repo.DB.Exec("DELETE FROM entries")
+		repo.DB.Exec("DELETE FROM journals")
+		repo.DB.Exec("DELETE FROM accounts")
+		repo.DB.Exec("DELETE FROM recovery_codes")
+		repo.DB.Exec("DELETE FROM users")
+	})
+	return NewService(repo, transfer.NewService(transfer.InitRepository()))
+}
+
+func createTestUser(t *testing.T) *models.User {
+	hashed, err := auth.HashPassword("password123")
+	assert.NoError(t, err)
+	user := &models.User{
+		ID:       uuid.New(),
+		Username: "testuser_" + uuid.New().String()[:8],
+		Password: hashed,
+		FullName: "Test User",
+		Email:    "test_" + uuid.New().String()[:8] + "@example.com",
+	}
+	assert.NoError(t, db.DB.Create(user).Error)
+	return user
+}
+
+func createTestAccount(t *testing.T, user *models.User, balance int64, currency string) *models.Account {
+	acc := &models.Account{
+		ID:       uuid.New(),
+		UserID:   user.ID,
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: currency,
+	}
+	assert.NoError(t, db.DB.Create(acc).Error)
+	return acc
+}
+
+func monthlyRequest(from, to *models.Account, amount int64) CreateScheduledTransferRequest {
+	return CreateScheduledTransferRequest{
+		FromAccountID: from.ID.String(),
+		ToAccountID:   to.ID.String(),
+		Amount:        money.Money{Amount: amount, Currency: from.Currency},
+		Schedule:      "0 9 1 * *",
+		Timezone:      "Africa/Cairo",
+	}
+}
+
+func TestCreate_Recurring(t *testing.T) {
+	service := setupTestService(t)
+	service.now = func() time.Time { return time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC) }
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+
+	st, err := service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 50000), "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusActive, st.Status)
+	// 09:00 in Cairo is 07:00 UTC
+	want := time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC)
+	assert.True(t, want.Equal(*st.NextOccurrenceAt))
+	assert.True(t, want.Equal(*st.NextRunAt))
+
+	list, err := service.List(context.Background(), alice.ID)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = service.List(context.Background(), bob.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestCreate_Invalid(t *testing.T) {
+	service := setupTestService(t)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	bobs := createTestAccount(t, bob, 100000, "EGP")
+	usd := createTestAccount(t, alice, 100000, "USD")
+	ctx := context.Background()
+
+	req := monthlyRequest(from, to, 500)
+	req.Schedule = "every month"
+	_, err := service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+
+	req = monthlyRequest(from, to, 500)
+	req.Timezone = "Nowhere/Special"
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, ErrInvalidTimezone)
+
+	req = monthlyRequest(from, to, 500)
+	req.Schedule = ""
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, ErrScheduleOrRunAt)
+
+	past := now.Add(-time.Hour)
+	req.RunAt = &past
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, ErrRunAtInPast)
+
+	req = monthlyRequest(from, to, 500)
+	endAt := time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)
+	req.EndAt = &endAt
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, ErrEndBeforeStart)
+
+	_, err = service.Create(ctx, alice.ID, monthlyRequest(bobs, to, 500), "")
+	assert.ErrorIs(t, err, transfer.ErrNotAccountOwner)
+
+	req = monthlyRequest(usd, to, 500)
+	req.Amount.Currency = "EGP"
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, transfer.ErrCurrencyMismatch)
+
+	req = monthlyRequest(from, to, 500)
+	req.ToAccountID = uuid.NewString()
+	_, err = service.Create(ctx, alice.ID, req, "")
+	assert.ErrorIs(t, err, transfer.ErrAccountNotFound)
+}
+
+func TestCreate_StepUp(t *testing.T) {
+	service := setupTestService(t)
+	t.Setenv(common.StepUpThresholds, "EGP:1000")
+	service.transfers = transfer.InitService()
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 1000000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+
+	_, err := service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 50000), "")
+	assert.NoError(t, err)
+	_, err = service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 100000), "")
+	assert.ErrorIs(t, err, transfer.ErrStepUpUnavailable)
+}
+
+func TestGet_Visibility(t *testing.T) {
+	service := setupTestService(t)
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	st, err := service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 500), "")
+	assert.NoError(t, err)
+
+	_, err = service.Get(context.Background(), st.ID.String(), authz.Subject{UserID: alice.ID, Role: models.RoleCustomer})
+	assert.NoError(t, err)
+	_, err = service.Get(context.Background(), st.ID.String(), authz.Subject{UserID: bob.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = service.Get(context.Background(), st.ID.String(), authz.Subject{UserID: bob.ID, Role: models.RoleTeller})
+	assert.NoError(t, err)
+	_, err = service.Get(context.Background(), "not-a-uuid", authz.Subject{UserID: alice.ID})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUpdate(t *testing.T) {
+	service := setupTestService(t)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	st, err := service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 500), "")
+	assert.NoError(t, err)
+	id := st.ID.String()
+
+	schedule := "@weekly"
+	amount := money.Money{Amount: 700, Currency: "EGP"}
+	st, err = service.Update(context.Background(), id, alice.ID, UpdateScheduledTransferRequest{Schedule: &schedule, Amount: &amount}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(700), st.Amount)
+	// Sunday 21 January 00:00 in Cairo
+	assert.True(t, time.Date(2024, 1, 20, 22, 0, 0, 0, time.UTC).Equal(*st.NextRunAt))
+
+	wrongCurrency := money.Money{Amount: 700, Currency: "USD"}
+	_, err = service.Update(context.Background(), id, alice.ID, UpdateScheduledTransferRequest{Amount: &wrongCurrency}, "")
+	assert.ErrorIs(t, err, transfer.ErrCurrencyMismatch)
+
+	_, err = service.Update(context.Background(), id, bob.ID, UpdateScheduledTransferRequest{Schedule: &schedule}, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	bogus := "stopped"
+	_, err = service.Update(context.Background(), id, alice.ID, UpdateScheduledTransferRequest{Status: &bogus}, "")
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+
+	// Resuming after a pause starts from the next occurrence after now
+	paused, active := models.ScheduledTransferStatusPaused, models.ScheduledTransferStatusActive
+	_, err = service.Update(context.Background(), id, alice.ID, UpdateScheduledTransferRequest{Status: &paused}, "")
+	assert.NoError(t, err)
+	now = time.Date(2024, 2, 10, 10, 0, 0, 0, time.UTC)
+	st, err = service.Update(context.Background(), id, alice.ID, UpdateScheduledTransferRequest{Status: &active}, "")
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2024, 2, 10, 22, 0, 0, 0, time.UTC).Equal(*st.NextRunAt))
+}
+
+func TestCancel(t *testing.T) {
+	service := setupTestService(t)
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	st, err := service.Create(context.Background(), alice.ID, monthlyRequest(from, to, 500), "")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, service.Cancel(context.Background(), st.ID.String(), bob.ID), ErrNotFound)
+	assert.NoError(t, service.Cancel(context.Background(), st.ID.String(), alice.ID))
+	assert.ErrorIs(t, service.Cancel(context.Background(), st.ID.String(), alice.ID), ErrFinished)
+
+	subject := authz.Subject{UserID: alice.ID, Role: models.RoleCustomer}
+	st, err = service.Get(context.Background(), st.ID.String(), subject)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusCancelled, st.Status)
+	assert.Nil(t, st.NextRunAt)
+}
@@ -0,0 +1,235 @@
+package scheduled
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// retryBackoff is the wait before each retry of a failed payment. A payment that still fails
+// after the last retry, or whose retry would reach the next occurrence, is skipped.
+var retryBackoff = []time.Duration{5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour}
+
+// Worker pays due standing orders. Each payment commits in one transaction with the claim
+// of its row and the record of its run, so a crash leaves the order due rather than paid
+// twice. Rows are claimed with SKIP LOCKED, so any number of replicas can run a worker.
+type Worker struct {
+	repo      *Repository
+	transfers *transfer.Repository
+	audit     *audit.Repository
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func NewWorker(repository *Repository, transfers *transfer.Repository, interval time.Duration) *Worker {
+	return &Worker{
+		repo:      repository,
+		transfers: transfers,
+		audit:     audit.InitRepository(),
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// InitWorker returns a worker that polls every SCHEDULED_TRANSFERS_INTERVAL (a minute by
+// default), or nil when it is set to off
+func InitWorker() *Worker {
+	interval, err := intervalFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading scheduled transfer interval: %v", err)
+	}
+	if interval == 0 {
+		return nil
+	}
+	return NewWorker(InitRepository(), transfer.InitRepository(), interval)
+}
+
+// intervalFromEnv reads SCHEDULED_TRANSFERS_INTERVAL, a Go duration such as 30s or "off"
+func intervalFromEnv() (time.Duration, error) {
+	spec := strings.TrimSpace(os.Getenv(common.ScheduledTransfersInterval))
+	switch spec {
+	case "":
+		return time.Minute, nil
+	case "off":
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(spec)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration or off, got %q", common.ScheduledTransfersInterval, spec)
+	}
+	return interval, nil
+}
+
+// Run pays due standing orders every interval until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("scheduled: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue pays every standing order that is due and returns how many runs it recorded
+func (w *Worker) RunDue(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		ran, err := w.runNext(ctx)
+		if err != nil || !ran {
+			return count, err
+		}
+		count++
+	}
+}
+
+// runNext claims one due standing order and pays it, reporting whether one was due
+func (w *Worker) runNext(ctx context.Context) (bool, error) {
+	var st *models.ScheduledTransfer
+	var run *models.ScheduledTransferRun
+	ctx, committed := events.Live.AfterCommit(ctx)
+	err := w.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := w.now()
+		var err error
+		st, err = claimDue(tx, now)
+		if err != nil || st == nil {
+			return err
+		}
+		// TransferTx runs in a savepoint, so a failed payment still lets us record the run
+		result, payErr := w.transfers.WithTx(tx).TransferTx(ctx, transfer.TransferTxParams{
+			UserID:        st.UserID.String(),
+			FromAccountID: st.FromAccountID.String(),
+			ToAccountID:   st.ToAccountID.String(),
+			Amount:        money.Money{Amount: st.Amount, Currency: st.Currency},
+		})
+		var transferID *uuid.UUID
+		if payErr == nil {
+			transferID = &result.Transfer.ID
+		}
+		run = settle(st, now, transferID, payErr)
+		return saveRun(tx, st, run)
+	})
+	if err != nil || run == nil {
+		return false, err
+	}
+	committed()
+	w.recordRun(ctx, st, run)
+	return true, nil
+}
+
+// recordRun adds a committed run to the audit log on behalf of the order's owner
+func (w *Worker) recordRun(ctx context.Context, st *models.ScheduledTransfer, run *models.ScheduledTransferRun) {
+	after, _ := json.Marshal(run)
+	err := w.audit.Record(ctx, &models.AuditLog{
+		ActorID:      &st.UserID,
+		Action:       "scheduled.transfer.run",
+		ResourceType: "scheduled_transfer",
+		ResourceID:   st.ID.String(),
+		After:        string(after),
+	})
+	if err != nil {
+		log.Printf("scheduled: failed to audit run of %s: %v", st.ID, err)
+	}
+}
+
+// settle moves st past a payment attempted at now that ended with payErr, and returns the
+// run to record. Occurrences missed while the worker was down are paid once, not each.
+func settle(st *models.ScheduledTransfer, now time.Time, transferID *uuid.UUID, payErr error) *models.ScheduledTransferRun {
+	st.Attempts++
+	st.LastRunAt = &now
+	st.LastError = ""
+	run := &models.ScheduledTransferRun{
+		ScheduledTransferID: st.ID,
+		OccurrenceAt:        *st.NextOccurrenceAt,
+		Attempt:             st.Attempts,
+		Status:              models.ScheduledRunSucceeded,
+		TransferID:          transferID,
+	}
+	next, schedErr := nextOccurrence(st, now)
+	if payErr == nil {
+		advance(st, next, schedErr)
+		return run
+	}
+
+	run.Status = models.ScheduledRunFailed
+	run.Error = payErr.Error()
+	st.LastError = payErr.Error()
+	if permanent(payErr) {
+		advance(st, time.Time{}, payErr)
+		return run
+	}
+	if st.Attempts <= len(retryBackoff) {
+		retryAt := now.Add(retryBackoff[st.Attempts-1])
+		if next.IsZero() || retryAt.Before(next) {
+			st.NextRunAt = &retryAt
+			return run
+		}
+	}
+	run.Status = models.ScheduledRunSkipped
+	advance(st, next, schedErr)
+	return run
+}
+
+// nextOccurrence returns the first occurrence of st after now, or the zero time if there is
+// none before its end date
+func nextOccurrence(st *models.ScheduledTransfer, now time.Time) (time.Time, error) {
+	if st.Schedule == "" {
+		return time.Time{}, nil
+	}
+	sched, err := ParseSchedule(st.Schedule, st.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := sched.Next(now)
+	if st.EndAt != nil && next.After(*st.EndAt) {
+		return time.Time{}, nil
+	}
+	return next, nil
+}
+
+// advance schedules st for next. Without a next occurrence the order is completed, or
+// failed if err says why it cannot go on.
+func advance(st *models.ScheduledTransfer, next time.Time, err error) {
+	st.Attempts = 0
+	switch {
+	case err != nil:
+		st.Status = models.ScheduledTransferStatusFailed
+		st.LastError = err.Error()
+	case next.IsZero():
+		st.Status = models.ScheduledTransferStatusCompleted
+	default:
+		st.NextOccurrenceAt = &next
+		st.NextRunAt = &next
+		return
+	}
+	st.NextOccurrenceAt = nil
+	st.NextRunAt = nil
+}
+
+// permanent reports whether a payment failed in a way that retrying cannot fix
+func permanent(err error) bool {
+	return errors.Is(err, transfer.ErrAccountNotFound) ||
+		errors.Is(err, transfer.ErrNotAccountOwner) ||
+		errors.Is(err, transfer.ErrCurrencyMismatch) ||
+		errors.Is(err, transfer.ErrSameAccount) ||
+		errors.Is(err, transfer.ErrAccountClosed)
+}
@@ -0,0 +1,198 @@
+package scheduled
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/transfer"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettle_RetriesWithBackoff(t *testing.T) {
+	occurrence := time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC)
+	st := &models.ScheduledTransfer{
+		Schedule:         "0 9 1 * *",
+		Timezone:         "Africa/Cairo",
+		Status:           models.ScheduledTransferStatusActive,
+		NextOccurrenceAt: &occurrence,
+		NextRunAt:        &occurrence,
+	}
+	now := occurrence
+	for i, backoff := range retryBackoff {
+		run := settle(st, now, nil, transfer.ErrInsufficientFunds)
+		assert.Equal(t, models.ScheduledRunFailed, run.Status)
+		assert.Equal(t, i+1, run.Attempt)
+		assert.Equal(t, occurrence, run.OccurrenceAt)
+		assert.Equal(t, now.Add(backoff), *st.NextRunAt)
+		assert.Equal(t, occurrence, *st.NextOccurrenceAt)
+		now = *st.NextRunAt
+	}
+
+	// The last retry gives up on this occurrence and moves on to the next one
+	run := settle(st, now, nil, transfer.ErrInsufficientFunds)
+	assert.Equal(t, models.ScheduledRunSkipped, run.Status)
+	next := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, next, st.NextOccurrenceAt.UTC())
+	assert.Equal(t, next, st.NextRunAt.UTC())
+	assert.Equal(t, 0, st.Attempts)
+	assert.Equal(t, transfer.ErrInsufficientFunds.Error(), st.LastError)
+	assert.Equal(t, models.ScheduledTransferStatusActive, st.Status)
+}
+
+func TestSettle_RetryDoesNotPassNextOccurrence(t *testing.T) {
+	occurrence := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := &models.ScheduledTransfer{
+		Schedule:         "0 * * * *",
+		Timezone:         "UTC",
+		Status:           models.ScheduledTransferStatusActive,
+		NextOccurrenceAt: &occurrence,
+		NextRunAt:        &occurrence,
+	}
+	run := settle(st, occurrence, nil, transfer.ErrAccountFrozen)
+	assert.Equal(t, models.ScheduledRunFailed, run.Status)
+	run = settle(st, *st.NextRunAt, nil, transfer.ErrAccountFrozen)
+	assert.Equal(t, models.ScheduledRunFailed, run.Status)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 35, 0, 0, time.UTC), *st.NextRunAt)
+	// A two hour wait would pass 01:00, so the occurrence is skipped
+	run = settle(st, *st.NextRunAt, nil, transfer.ErrAccountFrozen)
+	assert.Equal(t, models.ScheduledRunSkipped, run.Status)
+	assert.Equal(t, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), *st.NextRunAt)
+}
+
+func TestSettle_Success(t *testing.T) {
+	occurrence := time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC)
+	endAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	st := &models.ScheduledTransfer{
+		Schedule:         "0 9 1 * *",
+		Timezone:         "Africa/Cairo",
+		Status:           models.ScheduledTransferStatusActive,
+		NextOccurrenceAt: &occurrence,
+		NextRunAt:        &occurrence,
+		EndAt:            &endAt,
+	}
+	transferID := uuid.New()
+	// The worker was down for a month; the missed payment is made once
+	now := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	run := settle(st, now, &transferID, nil)
+	assert.Equal(t, models.ScheduledRunSucceeded, run.Status)
+	assert.Equal(t, &transferID, run.TransferID)
+	assert.Equal(t, occurrence, run.OccurrenceAt)
+	// The next occurrence, 1 April 09:00 in Cairo, is after the end date
+	assert.Equal(t, models.ScheduledTransferStatusCompleted, st.Status)
+	assert.Nil(t, st.NextRunAt)
+	assert.Nil(t, st.NextOccurrenceAt)
+}
+
+func TestSettle_PermanentFailure(t *testing.T) {
+	occurrence := time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC)
+	st := &models.ScheduledTransfer{
+		Schedule:         "0 9 1 * *",
+		Timezone:         "Africa/Cairo",
+		Status:           models.ScheduledTransferStatusActive,
+		NextOccurrenceAt: &occurrence,
+		NextRunAt:        &occurrence,
+	}
+	run := settle(st, occurrence, nil, transfer.ErrAccountNotFound)
+	assert.Equal(t, models.ScheduledRunFailed, run.Status)
+	assert.Equal(t, models.ScheduledTransferStatusFailed, st.Status)
+	assert.Nil(t, st.NextRunAt)
+}
+
+func TestWorker_RunDue(t *testing.T) {
+	service := setupTestService(t)
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 1000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	ctx := context.Background()
+
+	// The monthly order is first due within a month, before the one-off
+	runAt := time.Now().Add(40 * 24 * time.Hour)
+	req := monthlyRequest(from, to, 400)
+	req.Schedule = ""
+	req.RunAt = &runAt
+	oneOff, err := service.Create(ctx, alice.ID, req, "")
+	assert.NoError(t, err)
+	recurring, err := service.Create(ctx, alice.ID, monthlyRequest(from, to, 800), "")
+	assert.NoError(t, err)
+
+	worker := NewWorker(service.repo, transfer.InitRepository(), time.Minute)
+	count, err := worker.RunDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Both are due; the monthly order is paid, and the one-off finds too little money left
+	now := runAt.Add(time.Minute)
+	worker.now = func() time.Time { return now }
+	count, err = worker.RunDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	var balance int64
+	db.DB.Model(&models.Account{}).Where("id = ?", to.ID).Select("balance").Scan(&balance)
+	assert.Equal(t, int64(800), balance)
+
+	recurring, err = service.repo.get(ctx, recurring.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusActive, recurring.Status)
+	assert.True(t, recurring.NextRunAt.After(now))
+	assert.Equal(t, 0, recurring.Attempts)
+
+	oneOff, err = service.repo.get(ctx, oneOff.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, oneOff.Attempts)
+	assert.Equal(t, transfer.ErrInsufficientFunds.Error(), oneOff.LastError)
+	assert.True(t, now.Add(retryBackoff[0]).Equal(*oneOff.NextRunAt))
+
+	runs, err := service.repo.listRuns(ctx, oneOff.ID)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, models.ScheduledRunFailed, runs[0].Status)
+	assert.Nil(t, runs[0].TransferID)
+
+	// Nothing else is due until the retry
+	count, err = worker.RunDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestWorker_ConcurrentWorkersPayOnce(t *testing.T) {
+	service := setupTestService(t)
+	alice, bob := createTestUser(t), createTestUser(t)
+	from := createTestAccount(t, alice, 100000, "EGP")
+	to := createTestAccount(t, bob, 0, "EGP")
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		runAt := time.Now().Add(time.Hour)
+		req := monthlyRequest(from, to, 100)
+		req.Schedule = ""
+		req.RunAt = &runAt
+		_, err := service.Create(ctx, alice.ID, req, "")
+		assert.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, 3)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			worker := NewWorker(service.repo, transfer.InitRepository(), time.Minute)
+			worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			count, err := worker.RunDue(ctx)
+			assert.NoError(t, err)
+			counts[i] = count
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, counts[0]+counts[1]+counts[2])
+	var balance int64
+	db.DB.Model(&models.Account{}).Where("id = ?", to.ID).Select("balance").Scan(&balance)
+	assert.Equal(t, int64(500), balance)
+}
@@ -1,11 +1,15 @@
 package transfer
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 
-	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,123 +21,115 @@ type Controller struct {
 // @Tags     transfer
 // @Security JWT
 // @Summary Get all transfers for an account
-// @Description Retrieves all transfers (both incoming and outgoing) for a specific account. The account must belong to the authenticated user. You can use the 'direction' query parameter to filter the results:
+// @Description Retrieves all transfers (both incoming and outgoing) for a specific account. The account must belong to the authenticated user, unless the caller is staff; other accounts are reported as not found. You can use the 'direction' query parameter to filter the results:
 //   - direction=all (default): returns both incoming and outgoing transfers for the account.
 //   - direction=incoming: returns only transfers where the account is the recipient (deposits).
 //   - direction=outgoing: returns only transfers where the account is the sender (withdrawals).
 //
-// This endpoint supports additional filtering, sorting, and pagination options.
-// @param    s       query  string    false  "{'and': [ {'title': { 'cont':'cul' } } ]}"
-// @param    fields  query  string    false  "fields to select eg: name,age"
+// Results can be sorted and paginated; the generic s, filter, join and fields parameters are refused.
 // @param    page    query  int       false  "page of pagination"
-// @param    limit   query  int       false  "limit of pagination"
-// @param    join    query  string    false  "join relations eg: category, parent"
-// @param    filter  query  []string  false  "filters eg: name||eq||ad price||gte||200"
-// @param    sort    query  []string  false  "filters eg: created_at,desc title,asc"
+// @param    limit   query  int       false  "limit of pagination (at most 100, 20 by default)"
+// @param    sort    query  string    false  "created_at, amount or status, then asc or desc, eg: created_at,desc"
 // @param    account_id  query  string  true  "ID of the account to filter transfers by"
 // @param    direction  query  string  false  "Direction of transfer: incoming, outgoing, or all (default is all)"
 // @Router   /api/v1/transfer [get]
 func (c *Controller) findAll(ctx *gin.Context) {
-	var api crud.GetAllRequest
-	if api.Limit == 0 {
-		api.Limit = 20
+	query := ctx.Request.URL.Query()
+	for _, param := range []string{"s", "filter", "join", "fields"} {
+		if query.Has(param) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": ErrUnsupportedQuery.Error()})
+			return
+		}
 	}
-	if err := ctx.ShouldBindQuery(&api); err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
+	var req ListTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-
-	accountID := ctx.Query("account_id")
-	if accountID == "" {
-		ctx.JSON(400, gin.H{"message": "account_id query parameter is required"})
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
 		return
 	}
-	// validate the account id is belonging to the authenticated user
-	authUser, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(401, gin.H{"message": "unauthorized"})
+
+	result, totalRows, err := c.service.findAllVisible(ctx, req, subject)
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
-	}
-	authUserID, ok := authUser.(string)
-	if !ok {
-		ctx.JSON(401, gin.H{"message": "unauthorized"})
+	case errors.Is(err, ErrInvalidSort):
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
-	}
-	if !c.service.isAccountBelongsToUser(ctx, accountID, authUserID) {
-		ctx.JSON(403, gin.H{"message": "forbidden: account does not belong to user"})
-		return
-	}
-
-	switch ctx.Query("direction") {
-	case "incoming":
-		api.Filter = append(api.Filter, fmt.Sprintf("to_account_id||eq||%s", accountID))
-	case "outgoing":
-		api.Filter = append(api.Filter, fmt.Sprintf("from_account_id||eq||%s", accountID))
-	default:
-		api.Filter = append(api.Filter, fmt.Sprintf("from_account_id||eq||%s|to_account_id||eq||%s", accountID, accountID))
-	}
-
-	var result []model
-	var totalRows int64
-	err := c.service.Find(api, &result, &totalRows)
-	if err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 
 	var data interface{}
-	if api.Page > 0 {
+	if req.Page > 0 {
+		limit := req.Limit
+		if limit == 0 {
+			limit = defaultListLimit
+		}
 		data = map[string]interface{}{
 			"data":       result,
 			"total":      totalRows,
-			"totalPages": int((totalRows + int64(api.Limit) - 1) / int64(api.Limit)),
+			"totalPages": int((totalRows + int64(limit) - 1) / int64(limit)),
 		}
 	} else {
 		data = result
 	}
-	ctx.JSON(200, data)
+	ctx.JSON(http.StatusOK, data)
 }
 
 // @Success  200  {object}  model
 // @Tags     transfer
 // @Security JWT
 // @Summary Get a transfer by ID
-// @Description Retrieves a single transfer by its UUID
+// @Description Retrieves a single transfer by its UUID. Only the owners of either account and staff can see it; anyone else gets a 404.
+// @Failure  404  {object}  map[string]string
 // @param    id    path  string  true  "uuid of item"
 // @Router   /api/v1/transfer/{id} [get]
 func (c *Controller) findOne(ctx *gin.Context) {
-	var api crud.GetAllRequest
 	var item common.ById
-	if err := ctx.ShouldBindQuery(&api); err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
-		return
-	}
 	if err := ctx.ShouldBindUri(&item); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
 
-	api.Filter = append(api.Filter, fmt.Sprintf("id||eq||%s", item.ID))
-
-	var result model
-
-	err := c.service.FindOne(api, &result)
+	result, err := c.service.findVisible(ctx, item.ID, subject)
 	if err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
 	ctx.JSON(200, result)
 }
 
 // @Summary Execute a money transfer between accounts
-// @Description Transfers money from one account to another using a transaction
+// @Description Transfers money from one account to another using a transaction.
+// @Description Cross-currency transfers are converted at the live rate, or at the rate of the referenced quote_id.
+// @Description Transfers that reach the STEP_UP_THRESHOLDS amount of their currency need a fresh TOTP code
+// @Description in the X-TOTP-Code header; users without two-factor authentication cannot make them.
+// @Description With mode=authorize no money moves: the amount is held in the source account until the hold is
+// @Description captured or voided, or expires after seven days, and a hold is returned instead of a transfer.
 // @Tags transfer
 // @Security JWT
 // @Accept json
 // @Produce json
 // @Param request body CreateTransferRequest true "Transfer payload"
+// @Param X-TOTP-Code header string false "TOTP code, required above the step-up threshold"
 // @Success 201 {object} CreateTransferResponse
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Router /api/v1/transfer/execute [post]
 func (c *Controller) executeTransfer(ctx *gin.Context) {
 	var req CreateTransferRequest
@@ -141,14 +137,210 @@ func (c *Controller) executeTransfer(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	resp, err := c.service.Transfer(ctx, req)
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id not found in context"})
+		return
+	}
+	userIDStr, ok := userID.(string)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "user_id in context is not a string"})
+		return
+	}
+	if err := c.service.CheckStepUp(ctx, userIDStr, req.Amount, ctx.GetHeader(StepUpHeader)); err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	if req.Mode == ModeAuthorize {
+		audit.SetDetails(ctx, gin.H{"mode": ModeAuthorize})
+		hold, err := c.service.Authorize(ctx, req, userIDStr)
+		if err != nil {
+			ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+			return
+		}
+		audit.SetResourceID(ctx, hold.ID)
+		audit.SetChanges(ctx, nil, hold)
+		ctx.JSON(http.StatusCreated, gin.H{"data": hold})
+		return
+	}
+	resp, err := c.service.Transfer(ctx, req, userIDStr)
 	if err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetResourceID(ctx, resp.ID)
+	audit.SetChanges(ctx, nil, resp)
+	ctx.JSON(http.StatusCreated, gin.H{"data": resp})
+}
+
+// @Summary Get a hold
+// @Description Retrieves a hold placed by the caller with mode=authorize.
+// @Tags transfer
+// @Security JWT
+// @Produce json
+// @param id path string true "uuid of the hold"
+// @Success 200 {object} HoldResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/transfers/holds/{id} [get]
+func (c *Controller) findHold(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	resp, err := c.service.FindHold(ctx, item.ID, subject.UserID.String())
+	if err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": resp})
+}
+
+// @Summary Capture a hold
+// @Description Transfers all or part of an active hold to its destination account and releases the rest.
+// @Description A hold is captured once; the capture is checked like a new transfer, except for the held amount.
+// @Tags transfer
+// @Security JWT
+// @Accept json
+// @Produce json
+// @param id path string true "uuid of the hold"
+// @Param request body CaptureHoldRequest false "Amount to capture, the whole hold when omitted"
+// @Success 201 {object} CaptureHoldResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /api/v1/transfers/holds/{id}/capture [post]
+func (c *Controller) captureHold(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var req CaptureHoldRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	resp, err := c.service.Capture(ctx, item.ID, req, subject.UserID.String())
+	if err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetChanges(ctx, nil, resp)
+	ctx.JSON(http.StatusCreated, gin.H{"data": resp})
+}
+
+// @Summary Void a hold
+// @Description Releases an active hold without moving money.
+// @Tags transfer
+// @Security JWT
+// @Produce json
+// @param id path string true "uuid of the hold"
+// @Success 200 {object} HoldResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/transfers/holds/{id}/void [post]
+func (c *Controller) voidHold(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	resp, err := c.service.Void(ctx, item.ID, subject.UserID.String())
+	if err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetChanges(ctx, nil, resp)
+	ctx.JSON(http.StatusOK, gin.H{"data": resp})
+}
+
+// @Summary Reverse a transfer
+// @Description Returns all or part of a transfer to its sender with a linked reversal transfer that posts the opposite entries.
+// @Description Only the recipient and admins can reverse a transfer. Partial refunds add up to at most the amount received;
+// @Description cross-currency transfers are reversed at their original rate. Reversals themselves cannot be reversed.
+// @Tags transfer
+// @Security JWT
+// @Accept json
+// @Produce json
+// @param id path string true "uuid of the transfer"
+// @Param request body ReverseTransferRequest false "Amount to return, all of it when omitted"
+// @Success 201 {object} ReverseTransferResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /api/v1/transfers/{id}/reverse [post]
+func (c *Controller) reverseTransfer(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var req ReverseTransferRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	resp, err := c.service.Reverse(ctx, item.ID, req, subject)
+	if err != nil {
+		ctx.JSON(transferErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetChanges(ctx, nil, resp)
 	ctx.JSON(http.StatusCreated, gin.H{"data": resp})
 }
 
+// transferErrorStatus maps TransferTx errors to HTTP status codes
+func transferErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrStepUpRequired), errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrCodeReused):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrNotAccountOwner), errors.Is(err, ErrStepUpUnavailable), errors.Is(err, ErrReverseForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrTransferNotFound), errors.Is(err, fx.ErrQuoteNotFound),
+		errors.Is(err, ErrHoldNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCurrencyMismatch), errors.Is(err, ErrQuoteAmountMismatch), errors.Is(err, ErrAccountFrozen),
+		errors.Is(err, ErrAccountClosed),
+		errors.Is(err, fx.ErrQuoteExpired), errors.Is(err, fx.ErrQuoteUsed),
+		errors.Is(err, ErrAlreadyReversed), errors.Is(err, ErrReversalOfReversal),
+		errors.Is(err, ErrHoldNotActive), errors.Is(err, ErrHoldExpired):
+		return http.StatusConflict
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, money.ErrOverflow), errors.Is(err, ErrRefundExceedsRemaining),
+		errors.Is(err, ErrCaptureExceedsHold):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 func NewController(service *Service) *Controller {
 	return &Controller{
 		service: service,
@@ -1,10 +1,17 @@
 package transfer
 
+import "github.com/ahmedkhaeld/banking-app/internal/money"
+
 // DTO for create a transfer
 type CreateTransferRequest struct {
 	FromAccountID string `json:"from_account_id" binding:"required"`
 	ToAccountID   string `json:"to_account_id" binding:"required"`
-	Amount        int64  `json:"amount" binding:"required"`
+	// Amount to debit, in the source account's currency, e.g. {"amount": "12.34", "currency": "USD"}
+	Amount money.Money `json:"amount" binding:"required"`
+	// QuoteID of an fx quote from GET /fx/quote; fixes the rate of a cross-currency transfer
+	QuoteID string `json:"quote_id,omitempty"`
+	// Mode is immediate (the default), or authorize to place a hold that is captured or voided later
+	Mode string `json:"mode,omitempty" binding:"omitempty,oneof=immediate authorize"`
 }
 
 // CreateTransferResponse represents the response for creating a transfer.
@@ -12,6 +19,75 @@ type CreateTransferResponse struct {
 	ID            string `json:"id"`
 	FromAccountID string `json:"from_account_id"`
 	ToAccountID   string `json:"to_account_id"`
-	Amount        int64  `json:"amount"`
-	CreatedAt     string `json:"created_at"`
+	// Amount debited from the source account
+	Amount money.Money `json:"amount"`
+	// ToAmount credited to the destination account
+	ToAmount     money.Money `json:"to_amount"`
+	ExchangeRate string      `json:"exchange_rate"`
+	QuoteID      string      `json:"quote_id,omitempty"`
+	// Status is completed, partially_reversed or reversed
+	Status string `json:"status"`
+	// RefundedAmount returned to the sender by reversals so far, in the destination currency
+	RefundedAmount money.Money `json:"refunded_amount"`
+	// OriginalTransferID is set on a reversal and names the transfer it reverses
+	OriginalTransferID string `json:"original_transfer_id,omitempty"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// ListTransfersRequest selects a page of the transfers of an account. Only these parameters
+// are accepted; the generic s, filter, join and fields parameters are refused.
+type ListTransfersRequest struct {
+	AccountID string `form:"account_id" binding:"required"`
+	// Direction is all (the default), incoming or outgoing
+	Direction string `form:"direction" binding:"omitempty,oneof=all incoming outgoing"`
+	// Page of the listing, starting at 1; without it the first Limit transfers are returned
+	Page int `form:"page" binding:"omitempty,min=1"`
+	// Limit of transfers per page, 20 by default
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+	// Sort is a column and direction, e.g. created_at,desc (the default), amount,asc or status,asc
+	Sort string `form:"sort"`
+}
+
+// ReverseTransferRequest returns all or part of a transfer to its sender.
+type ReverseTransferRequest struct {
+	// Amount to return, in the currency the recipient received, e.g. {"amount": "5.00", "currency": "EUR"}.
+	// Omit it to return everything not yet reversed.
+	Amount *money.Money `json:"amount,omitempty"`
+	// Reason recorded with the reversal
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReverseTransferResponse holds the new reversal and the original transfer it returned money from.
+type ReverseTransferResponse struct {
+	Reversal CreateTransferResponse `json:"reversal"`
+	Original CreateTransferResponse `json:"original"`
+}
+
+// HoldResponse represents an authorized transfer waiting to be captured or voided.
+type HoldResponse struct {
+	ID            string `json:"id"`
+	FromAccountID string `json:"from_account_id"`
+	ToAccountID   string `json:"to_account_id"`
+	// Amount reserved in the source account
+	Amount money.Money `json:"amount"`
+	// CapturedAmount transferred by the capture; the rest of the hold was released
+	CapturedAmount money.Money `json:"captured_amount"`
+	// Status is active, captured, voided or expired
+	Status string `json:"status"`
+	// TransferID of the transfer made by the capture
+	TransferID string `json:"transfer_id,omitempty"`
+	ExpiresAt  string `json:"expires_at"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// CaptureHoldRequest transfers all or part of a hold.
+type CaptureHoldRequest struct {
+	// Amount to transfer, in the source account's currency; omit it to capture the whole hold
+	Amount *money.Money `json:"amount,omitempty"`
+}
+
+// CaptureHoldResponse holds the captured hold and the transfer it made.
+type CaptureHoldResponse struct {
+	Hold     HoldResponse           `json:"hold"`
+	Transfer CreateTransferResponse `json:"transfer"`
 }
@@ -0,0 +1,207 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTransferTx_RecordsEventsInOutbox(t *testing.T) {
+	repo := setupTestRepository(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 0, "USD")
+
+	result, err := repo.TransferTx(context.Background(), TransferTxParams{
+		UserID:        user1.ID.String(),
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 300, Currency: "USD"},
+	})
+	assert.NoError(t, err)
+
+	var completed []models.OutboxEvent
+	assert.NoError(t, db.DB.Where("type = ? AND aggregate_id = ?", events.TransferCompleted, result.Transfer.ID).Find(&completed).Error)
+	assert.Len(t, completed, 1)
+
+	var changed []models.OutboxEvent
+	assert.NoError(t, db.DB.Where("type = ? AND aggregate_id IN ?", events.BalanceChanged, []interface{}{acc1.ID, acc2.ID}).
+		Order("seq").Find(&changed).Error)
+	assert.Len(t, changed, 2)
+	for _, row := range changed {
+		var data events.BalanceChangedData
+		assert.NoError(t, json.Unmarshal([]byte(row.Payload), &data))
+		assert.Equal(t, result.Transfer.ID, *data.TransferID)
+		if data.AccountID == acc1.ID {
+			assert.Equal(t, int64(-300), data.Amount.Amount)
+			assert.Equal(t, int64(700), data.Balance.Amount)
+		} else {
+			assert.Equal(t, int64(300), data.Amount.Amount)
+			assert.Equal(t, user2.ID, data.UserID)
+		}
+	}
+}
+
+func TestTransferTx_FailedTransferRecordsNoEvents(t *testing.T) {
+	repo := setupTestRepository(t)
+	user1 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 100, "USD")
+	acc2 := createTestAccount(t, user1.ID, user1.Username, 0, "USD")
+
+	_, err := repo.TransferTx(context.Background(), TransferTxParams{
+		UserID:        user1.ID.String(),
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 500, Currency: "USD"},
+	})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	var count int64
+	assert.NoError(t, db.DB.Model(&models.OutboxEvent{}).Where("aggregate_id IN ?", []interface{}{acc1.ID, acc2.ID}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// testSubscriber returns a subscriber of its own name, whose deliveries are removed after the test
+func testSubscriber(t *testing.T, publisher events.Publisher) events.Subscriber {
+	name := "test-" + uuid.NewString()[:8]
+	t.Cleanup(func() {
+		db.DB.Where("subscriber = ?", name).Delete(&models.OutboxDelivery{})
+	})
+	return events.Subscriber{Name: name, Publisher: publisher}
+}
+
+// drainOutbox queues what earlier tests left in the outbox, so that a relay made after it
+// only sees the events of this test
+func drainOutbox(t *testing.T) {
+	relay := events.NewRelay(db.DB, []events.Subscriber{testSubscriber(t, events.NewMemoryPublisher())}, 0)
+	_, err := relay.RelayPending(context.Background(), time.Now())
+	assert.NoError(t, err)
+}
+
+// aggregateIDs returns the aggregate IDs of the published events of eventType
+func aggregateIDs(publisher *events.MemoryPublisher, eventType string) []string {
+	var ids []string
+	for _, e := range publisher.OfType(eventType) {
+		ids = append(ids, e.AggregateID.String())
+	}
+	return ids
+}
+
+// pendingDelivery returns the delivery to subscriber of the transfer.completed event of transferID
+func pendingDelivery(subscriber events.Subscriber, transferID uuid.UUID) (models.OutboxDelivery, error) {
+	var delivery models.OutboxDelivery
+	err := db.DB.Joins("JOIN outbox ON outbox.id = outbox_deliveries.event_id").
+		Where("outbox_deliveries.subscriber = ? AND outbox.type = ? AND outbox.aggregate_id = ?", subscriber.Name, events.TransferCompleted, transferID).
+		First(&delivery).Error
+	return delivery, err
+}
+
+func TestRelay_PublishesOnceAndRetriesFailures(t *testing.T) {
+	repo := setupTestRepository(t)
+	user1 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user1.ID, user1.Username, 0, "USD")
+	drainOutbox(t)
+	result, err := repo.TransferTx(context.Background(), TransferTxParams{
+		UserID:        user1.ID.String(),
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	})
+	assert.NoError(t, err)
+
+	publisher := events.NewMemoryPublisher()
+	publisher.Err = assert.AnError
+	relay := events.NewRelay(db.DB, []events.Subscriber{testSubscriber(t, publisher)}, 0)
+	now := time.Now()
+	_, err = relay.RelayPending(context.Background(), now)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	// Failed deliveries are retried once their delay has passed
+	publisher.Err = nil
+	_, err = relay.RelayPending(context.Background(), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Contains(t, aggregateIDs(publisher, events.TransferCompleted), result.Transfer.ID.String())
+
+	// Published events are not published again
+	before := len(publisher.Events())
+	n, err := relay.RelayPending(context.Background(), now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, publisher.Events(), before)
+}
+
+// pickyPublisher reports the transfer.completed event of one transfer undeliverable
+type pickyPublisher struct {
+	*events.MemoryPublisher
+	refuse string
+}
+
+func (p pickyPublisher) Publish(ctx context.Context, event events.Event) error {
+	if event.Type == events.TransferCompleted && event.AggregateID.String() == p.refuse {
+		return events.Undeliverable(assert.AnError)
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+func TestRelay_SubscribersRetryApart(t *testing.T) {
+	repo := setupTestRepository(t)
+	user1 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user1.ID, user1.Username, 0, "USD")
+	drainOutbox(t)
+	result, err := repo.TransferTx(context.Background(), TransferTxParams{
+		UserID:        user1.ID.String(),
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	})
+	assert.NoError(t, err)
+	transferID := result.Transfer.ID
+
+	downPublisher := events.NewMemoryPublisher()
+	downPublisher.Err = assert.AnError
+	upPublisher := events.NewMemoryPublisher()
+	picky := pickyPublisher{MemoryPublisher: events.NewMemoryPublisher(), refuse: transferID.String()}
+	down := testSubscriber(t, downPublisher)
+	up := testSubscriber(t, upPublisher)
+	pickySubscriber := testSubscriber(t, picky)
+	relay := events.NewRelay(db.DB, []events.Subscriber{down, up, pickySubscriber}, 0)
+
+	// A subscriber that is down holds back no other
+	now := time.Now()
+	_, err = relay.RelayPending(context.Background(), now)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, aggregateIDs(upPublisher, events.TransferCompleted), transferID.String())
+	delivery, err := pendingDelivery(down, transferID)
+	assert.NoError(t, err)
+	assert.Nil(t, delivery.ParkedAt)
+
+	// An event the subscriber can never take is parked rather than retried
+	parked, err := pendingDelivery(pickySubscriber, transferID)
+	assert.NoError(t, err)
+	assert.NotNil(t, parked.ParkedAt)
+	assert.Equal(t, 1, parked.Attempts)
+	assert.Contains(t, parked.LastError, assert.AnError.Error())
+
+	// However long it was down, the subscriber gets every event once it is back
+	downPublisher.Err = nil
+	_, err = relay.RelayPending(context.Background(), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Contains(t, aggregateIDs(downPublisher, events.TransferCompleted), transferID.String())
+	_, err = pendingDelivery(down, transferID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	parked, err = pendingDelivery(pickySubscriber, transferID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, parked.Attempts)
+}
@@ -0,0 +1,395 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transfer modes. An authorized transfer places a hold that is captured or voided later.
+const (
+	ModeImmediate = "immediate"
+	ModeAuthorize = "authorize"
+)
+
+// HoldExpiry is how long an authorized amount stays held before it is released
+const HoldExpiry = 7 * 24 * time.Hour
+
+// expireBatchSize bounds the holds released by one transaction of ExpireHolds
+const expireBatchSize = 100
+
+// Errors
+var (
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldNotActive      = errors.New("hold has already been captured, voided or expired")
+	ErrHoldExpired        = errors.New("hold has expired")
+	ErrCaptureExceedsHold = errors.New("capture exceeds the held amount")
+)
+
+// AuthorizeTx reserves args.Amount of the source account for a later capture into the
+// destination account. No money moves, but the held amount can no longer be spent.
+func (r *Repository) AuthorizeTx(ctx context.Context, args TransferTxParams) (models.Hold, error) {
+	var hold models.Hold
+	userID, err := uuid.Parse(args.UserID)
+	if err != nil {
+		return hold, errors.New("invalid user_id")
+	}
+	fromID, err := uuid.Parse(args.FromAccountID)
+	if err != nil {
+		return hold, errors.New("invalid from_account_id")
+	}
+	toID, err := uuid.Parse(args.ToAccountID)
+	if err != nil {
+		return hold, errors.New("invalid to_account_id")
+	}
+	if fromID == toID {
+		return hold, ErrSameAccount
+	}
+	if !args.Amount.IsPositive() {
+		return hold, errors.New("amount must be positive")
+	}
+	if args.QuoteID != "" {
+		return hold, errors.New("quote_id cannot be used when authorizing; the rate is set at capture")
+	}
+	err = r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var fromAccount, toAccount models.Account
+		if err := LockAccounts(tx, fromID, toID, &fromAccount, &toAccount); err != nil {
+			return err
+		}
+		if err := checkTransfer(&fromAccount, &toAccount, userID, args.Amount); err != nil {
+			return err
+		}
+		hold = models.Hold{
+			UserID:      userID,
+			AccountID:   fromID,
+			ToAccountID: toID,
+			Amount:      args.Amount.Amount,
+			Currency:    args.Amount.Currency,
+			Status:      models.HoldStatusActive,
+			ExpiresAt:   time.Now().Add(HoldExpiry),
+		}
+		if err := tx.Create(&hold).Error; err != nil {
+			return err
+		}
+		return adjustHeldBalance(tx, fromID, hold.Amount)
+	})
+	return hold, err
+}
+
+// CaptureTxParams holds the parameters for capturing a hold
+type CaptureTxParams struct {
+	HoldID string
+	// UserID must be the user who authorized the hold
+	UserID string
+	// Amount to transfer, at most the held amount; nil captures all of it
+	Amount *money.Money
+}
+
+// CaptureTxResult holds the captured hold and the transfer it made
+type CaptureTxResult struct {
+	Hold     models.Hold
+	Transfer TransferTxResult
+}
+
+// CaptureTx finishes a hold with a transfer of all or part of its amount. The rest of the
+// hold is released; a hold is captured once.
+func (r *Repository) CaptureTx(ctx context.Context, args CaptureTxParams) (CaptureTxResult, error) {
+	var result CaptureTxResult
+	ctx, committed := events.Live.AfterCommit(ctx)
+	err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hold, err := lockActiveHold(tx, args.HoldID, args.UserID)
+		if err != nil {
+			return err
+		}
+		amount := money.Money{Amount: hold.Amount, Currency: hold.Currency}
+		if args.Amount != nil {
+			if args.Amount.Currency != hold.Currency {
+				return ErrCurrencyMismatch
+			}
+			if !args.Amount.IsPositive() {
+				return errors.New("amount must be positive")
+			}
+			if args.Amount.Amount > hold.Amount {
+				return ErrCaptureExceedsHold
+			}
+			amount = *args.Amount
+		}
+		// Lock both accounts in ID order before touching either, as the transfer below does,
+		// so that a capture cannot deadlock against a transfer between the same accounts
+		var fromAccount, toAccount models.Account
+		if err := LockAccounts(tx, hold.AccountID, hold.ToAccountID, &fromAccount, &toAccount); err != nil {
+			return err
+		}
+		// Release the hold first so that the transfer can spend the money it reserved
+		if err := adjustHeldBalance(tx, hold.AccountID, -hold.Amount); err != nil {
+			return err
+		}
+		transfer, err := r.WithTx(tx).TransferTx(ctx, TransferTxParams{
+			UserID:        args.UserID,
+			FromAccountID: hold.AccountID.String(),
+			ToAccountID:   hold.ToAccountID.String(),
+			Amount:        amount,
+		})
+		if err != nil {
+			return err
+		}
+		hold.Status = models.HoldStatusCaptured
+		hold.CapturedAmount = amount.Amount
+		hold.TransferID = &transfer.Transfer.ID
+		if err := tx.Save(hold).Error; err != nil {
+			return err
+		}
+		result.Hold = *hold
+		result.Transfer = transfer
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	committed()
+	return result, nil
+}
+
+// VoidTx releases a hold without moving money
+func (r *Repository) VoidTx(ctx context.Context, holdID, userID string) (models.Hold, error) {
+	var result models.Hold
+	err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hold, err := lockActiveHold(tx, holdID, userID)
+		if err != nil {
+			return err
+		}
+		if err := releaseHold(tx, hold, models.HoldStatusVoided); err != nil {
+			return err
+		}
+		result = *hold
+		return nil
+	})
+	return result, err
+}
+
+// FindHold returns a hold authorized by userID
+func (r *Repository) FindHold(ctx context.Context, holdID, userID string) (*models.Hold, error) {
+	id, err := uuid.Parse(holdID)
+	if err != nil {
+		return nil, ErrHoldNotFound
+	}
+	var hold models.Hold
+	err = r.Repository.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ExpireHolds releases the active holds that expired by now and returns how many it
+// released. Holds are claimed with SKIP LOCKED, so several instances can run it at once.
+func (r *Repository) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		released := 0
+		err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var holds []models.Hold
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND expires_at <= ?", models.HoldStatusActive, now).
+				Order("expires_at").
+				Limit(expireBatchSize).
+				Find(&holds).Error
+			if err != nil {
+				return err
+			}
+			if err := lockHoldAccounts(tx, holds); err != nil {
+				return err
+			}
+			for i := range holds {
+				if err := releaseHold(tx, &holds[i], models.HoldStatusExpired); err != nil {
+					return err
+				}
+			}
+			released = len(holds)
+			return nil
+		})
+		total += released
+		if err != nil || released < expireBatchSize {
+			return total, err
+		}
+	}
+}
+
+// HoldExpiryInterval returns how often expired holds are released, HOLD_EXPIRY_INTERVAL
+// (a minute by default), or zero when it is set to off
+func HoldExpiryInterval() time.Duration {
+	interval, err := holdExpiryIntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading hold expiry interval: %v", err)
+	}
+	return interval
+}
+
+// holdExpiryIntervalFromEnv reads HOLD_EXPIRY_INTERVAL, a Go duration such as 30s or "off"
+func holdExpiryIntervalFromEnv() (time.Duration, error) {
+	spec := strings.TrimSpace(os.Getenv(common.HoldExpiryInterval))
+	switch spec {
+	case "":
+		return time.Minute, nil
+	case "off":
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(spec)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration or off, got %q", common.HoldExpiryInterval, spec)
+	}
+	return interval, nil
+}
+
+// RunHoldExpiry releases expired holds every interval until ctx is done
+func (r *Repository) RunHoldExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.ExpireHolds(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("transfer: expiring holds: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockActiveHold locks a hold of userID that can still be captured or voided
+func lockActiveHold(tx *gorm.DB, holdID, userID string) (*models.Hold, error) {
+	id, err := uuid.Parse(holdID)
+	if err != nil {
+		return nil, ErrHoldNotFound
+	}
+	var hold models.Hold
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", id, userID).First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != models.HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+	if !time.Now().Before(hold.ExpiresAt) {
+		return nil, ErrHoldExpired
+	}
+	return &hold, nil
+}
+
+// lockHoldAccounts locks the accounts of a batch of holds in ID order, the order LockAccounts
+// uses, so that releasing the batch cannot deadlock against a transfer or a capture
+func lockHoldAccounts(tx *gorm.DB, holds []models.Hold) error {
+	seen := make(map[uuid.UUID]bool, len(holds))
+	ids := make([]uuid.UUID, 0, len(holds))
+	for _, hold := range holds {
+		if !seen[hold.AccountID] {
+			seen[hold.AccountID] = true
+			ids = append(ids, hold.AccountID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	for _, id := range ids {
+		var account models.Account
+		if err := lockAccount(tx, id, &account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseHold returns the amount of an active hold to the available balance
+func releaseHold(tx *gorm.DB, hold *models.Hold, status string) error {
+	if err := adjustHeldBalance(tx, hold.AccountID, -hold.Amount); err != nil {
+		return err
+	}
+	hold.Status = status
+	return tx.Model(hold).Update("status", status).Error
+}
+
+// adjustHeldBalance adds delta to the held balance of an account
+func adjustHeldBalance(tx *gorm.DB, accountID uuid.UUID, delta int64) error {
+	return tx.Model(&models.Account{}).Where("id = ?", accountID).
+		UpdateColumn("held_balance", gorm.Expr("held_balance + ?", delta)).Error
+}
+
+// Authorize places a hold for a transfer that is captured later
+func (s *Service) Authorize(ctx context.Context, req CreateTransferRequest, userID string) (*HoldResponse, error) {
+	hold, err := s.repo.AuthorizeTx(ctx, TransferTxParams{
+		UserID:        userID,
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		QuoteID:       req.QuoteID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toHoldResponse(&hold), nil
+}
+
+// Capture transfers all or part of a hold of userID
+func (s *Service) Capture(ctx context.Context, holdID string, req CaptureHoldRequest, userID string) (*CaptureHoldResponse, error) {
+	result, err := s.repo.CaptureTx(ctx, CaptureTxParams{HoldID: holdID, UserID: userID, Amount: req.Amount})
+	if err != nil {
+		return nil, err
+	}
+	return &CaptureHoldResponse{
+		Hold:     *toHoldResponse(&result.Hold),
+		Transfer: *toTransferResponse(result.Transfer.Transfer),
+	}, nil
+}
+
+// Void releases a hold of userID
+func (s *Service) Void(ctx context.Context, holdID, userID string) (*HoldResponse, error) {
+	hold, err := s.repo.VoidTx(ctx, holdID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toHoldResponse(&hold), nil
+}
+
+// FindHold returns a hold of userID
+func (s *Service) FindHold(ctx context.Context, holdID, userID string) (*HoldResponse, error) {
+	hold, err := s.repo.FindHold(ctx, holdID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toHoldResponse(hold), nil
+}
+
+func toHoldResponse(h *models.Hold) *HoldResponse {
+	resp := &HoldResponse{
+		ID:             h.ID.String(),
+		FromAccountID:  h.AccountID.String(),
+		ToAccountID:    h.ToAccountID.String(),
+		Amount:         money.Money{Amount: h.Amount, Currency: h.Currency},
+		CapturedAmount: money.Money{Amount: h.CapturedAmount, Currency: h.Currency},
+		Status:         h.Status,
+		ExpiresAt:      h.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:      h.CreatedAt.Format(time.RFC3339),
+	}
+	if h.TransferID != nil {
+		resp.TransferID = h.TransferID.String()
+	}
+	return resp
+}
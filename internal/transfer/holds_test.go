@@ -0,0 +1,136 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func heldBalanceOf(t *testing.T, accountID uuid.UUID) int64 {
+	var acc models.Account
+	err := db.DB.First(&acc, "id = ?", accountID).Error
+	assert.NoError(t, err)
+	return acc.HeldBalance
+}
+
+func authorize(t *testing.T, service *Service, from, to *models.Account, userID uuid.UUID, amount int64) *HoldResponse {
+	hold, err := service.Authorize(context.Background(), CreateTransferRequest{
+		FromAccountID: from.ID.String(),
+		ToAccountID:   to.ID.String(),
+		Amount:        money.Money{Amount: amount, Currency: from.Currency},
+		Mode:          ModeAuthorize,
+	}, userID.String())
+	assert.NoError(t, err)
+	return hold
+}
+
+func TestHold_AuthorizeReservesAvailableBalance(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+
+	hold := authorize(t, service, acc1, acc2, sender.ID, 700)
+	assert.Equal(t, models.HoldStatusActive, hold.Status)
+	assert.Equal(t, int64(1000), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(700), heldBalanceOf(t, acc1.ID))
+
+	// Only 300 is left to spend, by transfers and by further holds alike
+	_, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 301, Currency: "USD"},
+	}, sender.ID.String())
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = service.Authorize(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 301, Currency: "USD"},
+	}, sender.ID.String())
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 300, Currency: "USD"},
+	}, sender.ID.String())
+	assert.NoError(t, err)
+}
+
+func TestHold_PartialCapture(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+	hold := authorize(t, service, acc1, acc2, sender.ID, 500)
+
+	tooMuch := money.Money{Amount: 501, Currency: "USD"}
+	_, err := service.Capture(context.Background(), hold.ID, CaptureHoldRequest{Amount: &tooMuch}, sender.ID.String())
+	assert.ErrorIs(t, err, ErrCaptureExceedsHold)
+	_, err = service.Capture(context.Background(), hold.ID, CaptureHoldRequest{}, recipient.ID.String())
+	assert.ErrorIs(t, err, ErrHoldNotFound)
+
+	part := money.Money{Amount: 200, Currency: "USD"}
+	resp, err := service.Capture(context.Background(), hold.ID, CaptureHoldRequest{Amount: &part}, sender.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusCaptured, resp.Hold.Status)
+	assert.Equal(t, part, resp.Hold.CapturedAmount)
+	assert.Equal(t, resp.Transfer.ID, resp.Hold.TransferID)
+	assert.Equal(t, part, resp.Transfer.Amount)
+	// The rest of the hold is released
+	assert.Equal(t, int64(800), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(0), heldBalanceOf(t, acc1.ID))
+	assert.Equal(t, int64(200), balanceOf(t, acc2.ID))
+
+	_, err = service.Capture(context.Background(), hold.ID, CaptureHoldRequest{}, sender.ID.String())
+	assert.ErrorIs(t, err, ErrHoldNotActive)
+	_, err = service.Void(context.Background(), hold.ID, sender.ID.String())
+	assert.ErrorIs(t, err, ErrHoldNotActive)
+}
+
+func TestHold_Void(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+	hold := authorize(t, service, acc1, acc2, sender.ID, 500)
+
+	resp, err := service.Void(context.Background(), hold.ID, sender.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusVoided, resp.Status)
+	assert.Equal(t, int64(1000), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(0), heldBalanceOf(t, acc1.ID))
+	assert.Equal(t, int64(0), balanceOf(t, acc2.ID))
+}
+
+func TestHold_Expire(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+	stale := authorize(t, service, acc1, acc2, sender.ID, 300)
+	fresh := authorize(t, service, acc1, acc2, sender.ID, 200)
+
+	err := service.repo.Repository.DB.Model(&models.Hold{}).Where("id = ?", stale.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error
+	assert.NoError(t, err)
+	_, err = service.Capture(context.Background(), stale.ID, CaptureHoldRequest{}, sender.ID.String())
+	assert.ErrorIs(t, err, ErrHoldExpired)
+
+	released, err := service.repo.ExpireHolds(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, int64(200), heldBalanceOf(t, acc1.ID))
+
+	resp, err := service.FindHold(context.Background(), stale.ID, sender.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusExpired, resp.Status)
+	resp, err = service.FindHold(context.Background(), fresh.ID, sender.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusActive, resp.Status)
+}
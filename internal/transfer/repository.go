@@ -3,35 +3,62 @@ package transfer
 import (
 	"context"
 	"errors"
+	"log"
+	"math/big"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type model = models.Transfer
 
 type Repository struct {
 	crud.Repository[model]
+	// Rates prices cross-currency transfers that do not reference a quote
+	Rates fx.RateProvider
 }
 
 func InitRepository() *Repository {
+	rates, err := fx.InitProvider()
+	if err != nil {
+		log.Fatalf("Error loading fx rates: %v", err)
+	}
 	return &Repository{
 		Repository: crud.Repository[model]{
 			DB:    db.DB,
 			Model: model{},
 		},
+		Rates: rates,
 	}
 }
 
+// WithTx returns a copy of the repository that runs on tx. TransferTx then runs in a
+// savepoint of tx, so that the caller can commit a transfer together with its own writes.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	scoped := *r
+	scoped.Repository.DB = tx
+	return &scoped
+}
+
 // TransferTxParams holds the parameters for a transfer transaction
 // (useful for service and controller layers)
 type TransferTxParams struct {
+	// UserID is the authenticated user initiating the transfer; it must own FromAccountID.
+	UserID        string
 	FromAccountID string
 	ToAccountID   string
-	Amount        int64
+	// Amount is debited from the source account and must be in its currency
+	Amount money.Money
+	// QuoteID optionally references an fx quote that fixes the rate of a cross-currency transfer
+	QuoteID string
 }
 
 // TransferTxResult holds the result of a transfer transaction
@@ -45,6 +72,10 @@ type TransferTxResult struct {
 
 func (r *Repository) TransferTx(ctx context.Context, args TransferTxParams) (TransferTxResult, error) {
 	var result TransferTxResult
+	userID, err := uuid.Parse(args.UserID)
+	if err != nil {
+		return result, errors.New("invalid user_id")
+	}
 	fromID, err := uuid.Parse(args.FromAccountID)
 	if err != nil {
 		return result, errors.New("invalid from_account_id")
@@ -53,85 +84,246 @@ func (r *Repository) TransferTx(ctx context.Context, args TransferTxParams) (Tra
 	if err != nil {
 		return result, errors.New("invalid to_account_id")
 	}
-	if args.Amount <= 0 {
+	if fromID == toID {
+		return result, ErrSameAccount
+	}
+	if !args.Amount.IsPositive() {
 		return result, errors.New("amount must be positive")
 	}
+	var quoteID *uuid.UUID
+	if args.QuoteID != "" {
+		id, err := uuid.Parse(args.QuoteID)
+		if err != nil {
+			return result, errors.New("invalid quote_id")
+		}
+		quoteID = &id
+	}
+	ctx, committed := events.Live.AfterCommit(ctx)
 	err = r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Step 1: Create Transfer
-		transfer := models.Transfer{
-			FromAccountID: fromID,
-			ToAccountID:   toID,
-			Amount:        args.Amount,
+		// Step 1: Lock both accounts and validate the transfer
+		var fromAccount, toAccount models.Account
+		if err := LockAccounts(tx, fromID, toID, &fromAccount, &toAccount); err != nil {
+			return err
 		}
-		if err := tx.Create(&transfer).Error; err != nil {
+		if err := checkTransfer(&fromAccount, &toAccount, userID, args.Amount); err != nil {
 			return err
 		}
-		result.Transfer = transfer
-
-		// Step 2: Create Entries
-		fromEntry := models.Entry{
-			AccountID: fromID,
-			Amount:    -args.Amount,
+		rate, err := r.resolveRate(ctx, tx, quoteID, userID, args.Amount, &fromAccount, &toAccount)
+		if err != nil {
+			return err
 		}
-		if err := tx.Create(&fromEntry).Error; err != nil {
+		toAmount, err := fx.Convert(args.Amount, toAccount.Currency, rate)
+		if err != nil {
 			return err
 		}
-		result.FromEntry = fromEntry
+		if !toAmount.IsPositive() {
+			return errors.New("amount is too small to convert")
+		}
 
-		toEntry := models.Entry{
-			AccountID: toID,
-			Amount:    args.Amount,
+		// Step 2: Create Transfer
+		transfer := models.Transfer{
+			FromAccountID: fromID,
+			ToAccountID:   toID,
+			Amount:        args.Amount.Amount,
+			FromCurrency:  fromAccount.Currency,
+			ToAmount:      toAmount.Amount,
+			ToCurrency:    toAccount.Currency,
+			ExchangeRate:  fx.FormatRate(rate),
+			QuoteID:       quoteID,
+			Status:        models.TransferStatusCompleted,
 		}
-		if err := tx.Create(&toEntry).Error; err != nil {
+		if err := tx.Create(&transfer).Error; err != nil {
 			return err
 		}
-		result.ToEntry = toEntry
+		result.Transfer = transfer
 
-		// Step 3: Update balances (avoid deadlock by ordering by ID)
-		var fromAccount, toAccount models.Account
-		if fromID.String() < toID.String() {
-			if err := updateBalance(tx, fromID, -args.Amount, &fromAccount); err != nil {
-				return err
-			}
-			if err := updateBalance(tx, toID, args.Amount, &toAccount); err != nil {
+		// Step 3: Post the journal; it writes the entries and updates both balances.
+		// A cross-currency transfer goes through the fx clearing account of each currency.
+		debit, err := args.Amount.Neg()
+		if err != nil {
+			return err
+		}
+		postings := []ledger.Posting{{AccountID: fromID, Amount: debit}}
+		if fromAccount.Currency != toAccount.Currency {
+			fxFrom, err := ledger.SystemAccount(tx, ledger.SystemFX, fromAccount.Currency)
+			if err != nil {
 				return err
 			}
-		} else {
-			if err := updateBalance(tx, toID, args.Amount, &toAccount); err != nil {
+			fxTo, err := ledger.SystemAccount(tx, ledger.SystemFX, toAccount.Currency)
+			if err != nil {
 				return err
 			}
-			if err := updateBalance(tx, fromID, -args.Amount, &fromAccount); err != nil {
+			fxDebit, err := toAmount.Neg()
+			if err != nil {
 				return err
 			}
+			postings = append(postings,
+				ledger.Posting{AccountID: fxFrom, Amount: args.Amount},
+				ledger.Posting{AccountID: fxTo, Amount: fxDebit},
+			)
+		}
+		postings = append(postings, ledger.Posting{AccountID: toID, Amount: toAmount})
+		journal, err := ledger.Post(tx, ledger.JournalParams{
+			Kind:       ledger.KindTransfer,
+			TransferID: &transfer.ID,
+			Postings:   postings,
+		})
+		if err != nil {
+			return err
+		}
+		if err := events.Record(tx, events.TransferCompleted, events.AggregateTransfer, transfer.ID, transfer); err != nil {
+			return err
+		}
+		result.FromEntry = journal.Entries[0]
+		result.ToEntry = journal.Entries[len(journal.Entries)-1]
+
+		if err := tx.Where("id = ?", fromID).First(&fromAccount).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", toID).First(&toAccount).Error; err != nil {
+			return err
 		}
 		result.FromAccount = fromAccount
 		result.ToAccount = toAccount
 		return nil
 	})
-	return result, err
+	if err != nil {
+		return result, err
+	}
+	// Wake live account streams only once the events they read have committed, which inside
+	// a caller's transaction is when that one commits
+	committed(fromID, toID)
+	return result, nil
+}
+
+// resolveRate returns the rate to apply between the two accounts. A referenced quote must
+// match both currencies and the amount; without one, cross-currency transfers use the live rate.
+func (r *Repository) resolveRate(ctx context.Context, tx *gorm.DB, quoteID *uuid.UUID, userID uuid.UUID, amount money.Money, from, to *models.Account) (*big.Rat, error) {
+	if quoteID != nil {
+		quote, err := fx.ClaimQuote(tx, *quoteID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if quote.FromCurrency != from.Currency || quote.ToCurrency != to.Currency {
+			return nil, ErrCurrencyMismatch
+		}
+		if quote.SourceAmount != amount.Amount {
+			return nil, ErrQuoteAmountMismatch
+		}
+		return fx.ParseRate(quote.Rate)
+	}
+	if from.Currency == to.Currency {
+		return big.NewRat(1, 1), nil
+	}
+	return r.Rates.Rate(ctx, from.Currency, to.Currency)
 }
 
-// updateBalance updates the balance of an account and returns the updated account
-func updateBalance(tx *gorm.DB, accountID uuid.UUID, amount int64, account *models.Account) error {
-	if err := tx.Model(&models.Account{}).Where("id = ?", accountID).UpdateColumn("balance", gorm.Expr("balance + ?", amount)).Error; err != nil {
+// LockAccounts locks both accounts of a transfer, in ID order to avoid deadlocks. Code that
+// locks either account before a transfer in the same transaction must lock both through it.
+func LockAccounts(tx *gorm.DB, fromID, toID uuid.UUID, fromAccount, toAccount *models.Account) error {
+	if fromID.String() < toID.String() {
+		if err := lockAccount(tx, fromID, fromAccount); err != nil {
+			return err
+		}
+		return lockAccount(tx, toID, toAccount)
+	}
+	if err := lockAccount(tx, toID, toAccount); err != nil {
 		return err
 	}
-	return tx.Where("id = ?", accountID).First(account).Error
+	return lockAccount(tx, fromID, fromAccount)
+}
+
+// checkTransfer validates that userID may move amount between two locked accounts. Money
+// reserved by holds cannot be spent.
+func checkTransfer(fromAccount, toAccount *models.Account, userID uuid.UUID, amount money.Money) error {
+	if toAccount.IsSystem {
+		return ErrAccountNotFound
+	}
+	if fromAccount.UserID != userID {
+		return ErrNotAccountOwner
+	}
+	if fromAccount.Status == models.AccountStatusClosed || toAccount.Status == models.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+	if fromAccount.Status == models.AccountStatusFrozen || toAccount.Status == models.AccountStatusFrozen {
+		return ErrAccountFrozen
+	}
+	if amount.Currency != fromAccount.Currency {
+		return ErrCurrencyMismatch
+	}
+	available, err := money.New(fromAccount.AvailableBalance(), fromAccount.Currency)
+	if err != nil {
+		return err
+	}
+	available, err = available.Sub(amount)
+	if err != nil {
+		return err
+	}
+	if available.IsNegative() {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// lockAccount loads an account with SELECT ... FOR UPDATE so that concurrent transfers serialize on it.
+// Closed accounts are soft deleted; they are still found, so that callers report them as closed.
+func lockAccount(tx *gorm.DB, accountID uuid.UUID, account *models.Account) error {
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccountNotFound
+	}
+	return err
 }
 
 // FindAllByAccountID returns all transfers where the account is either the sender or receiver
 func (r *Repository) FindAllByAccountID(ctx context.Context, accountID string) ([]models.Transfer, error) {
-	var transfers []models.Transfer
 	id, err := uuid.Parse(accountID)
 	if err != nil {
 		return nil, errors.New("invalid account_id")
 	}
-	err = r.Repository.DB.WithContext(ctx).
-		Where("from_account_id = ? OR to_account_id = ?", id, id).
-		Order("created_at DESC").
-		Find(&transfers).Error
-	if err != nil {
-		return nil, err
+	transfers, _, err := r.FindPageByAccountID(ctx, AccountTransfersQuery{AccountID: id})
+	return transfers, err
+}
+
+// AccountTransfersQuery selects a page of the transfers of an account
+type AccountTransfersQuery struct {
+	AccountID uuid.UUID
+	// Direction is incoming, outgoing or, when empty, both
+	Direction string
+	// Order defaults to the newest transfers first
+	Order *clause.OrderByColumn
+	// Offset and Limit page the result; a zero Limit returns every transfer
+	Offset int
+	Limit  int
+}
+
+// FindPageByAccountID returns a page of the transfers of an account and how many there are
+// in all. Every condition is built here, so callers cannot widen the query past the account.
+func (r *Repository) FindPageByAccountID(ctx context.Context, q AccountTransfersQuery) ([]models.Transfer, int64, error) {
+	query := r.Repository.DB.WithContext(ctx).Model(&models.Transfer{})
+	switch q.Direction {
+	case "incoming":
+		query = query.Where("to_account_id = ?", q.AccountID)
+	case "outgoing":
+		query = query.Where("from_account_id = ?", q.AccountID)
+	default:
+		query = query.Where("from_account_id = ? OR to_account_id = ?", q.AccountID, q.AccountID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order := clause.OrderByColumn{Column: clause.Column{Name: "created_at"}, Desc: true}
+	if q.Order != nil {
+		order = *q.Order
+	}
+	query = query.Order(order).Order("id")
+	if q.Limit > 0 {
+		query = query.Offset(q.Offset).Limit(q.Limit)
+	}
+	var transfers []models.Transfer
+	if err := query.Find(&transfers).Error; err != nil {
+		return nil, 0, err
 	}
-	return transfers, nil
+	return transfers, total, nil
 }
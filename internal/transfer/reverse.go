@@ -0,0 +1,215 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/ledger"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors
+var (
+	ErrReverseForbidden       = errors.New("only the recipient or an admin can reverse a transfer")
+	ErrReversalOfReversal     = errors.New("a reversal cannot be reversed")
+	ErrAlreadyReversed        = errors.New("transfer has already been reversed in full")
+	ErrRefundExceedsRemaining = errors.New("refund exceeds the amount not yet reversed")
+)
+
+// ReverseTxParams holds the parameters for a reversal transaction
+type ReverseTxParams struct {
+	TransferID string
+	// Subject is the caller; it must be an admin or own the account that received the transfer
+	Subject authz.Subject
+	// Amount to return, in the currency the recipient received; nil returns everything not yet reversed
+	Amount *money.Money
+	// Reason is kept as the description of the reversal's journal
+	Reason string
+}
+
+// ReverseTxResult holds the reversal and the original transfer as updated by it
+type ReverseTxResult struct {
+	Reversal models.Transfer
+	Original models.Transfer
+}
+
+// ReverseTx returns all or part of a transfer to its sender with a linked transfer that
+// posts the opposite entries. Cross-currency transfers are reversed at their original rate.
+// The original keeps a running total of what has been returned, so it can be refunded in
+// parts but never beyond its amount.
+func (r *Repository) ReverseTx(ctx context.Context, args ReverseTxParams) (ReverseTxResult, error) {
+	var result ReverseTxResult
+	id, err := uuid.Parse(args.TransferID)
+	if err != nil {
+		return result, ErrTransferNotFound
+	}
+	err = r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the original serializes concurrent reversals of it
+		var original models.Transfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&original).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var fromAccount, toAccount models.Account
+		if err := LockAccounts(tx, original.FromAccountID, original.ToAccountID, &fromAccount, &toAccount); err != nil {
+			return err
+		}
+		original.FromAccount = &fromAccount
+		original.ToAccount = &toAccount
+		if !authz.CanView(args.Subject, &original) {
+			return ErrTransferNotFound
+		}
+		if !authz.CanReverse(args.Subject, &original) {
+			return ErrReverseForbidden
+		}
+		original.FromAccount = nil
+		original.ToAccount = nil
+		if original.OriginalTransferID != nil {
+			return ErrReversalOfReversal
+		}
+		if fromAccount.Status == models.AccountStatusClosed || toAccount.Status == models.AccountStatusClosed {
+			return ErrAccountClosed
+		}
+		// Admins may reverse into or out of a frozen account, e.g. to undo a fraudulent transfer
+		if args.Subject.Role != models.RoleAdmin &&
+			(fromAccount.Status == models.AccountStatusFrozen || toAccount.Status == models.AccountStatusFrozen) {
+			return ErrAccountFrozen
+		}
+
+		remaining := original.ToAmount - original.RefundedAmount
+		if remaining <= 0 {
+			return ErrAlreadyReversed
+		}
+		refund := remaining
+		if args.Amount != nil {
+			if args.Amount.Currency != original.ToCurrency {
+				return ErrCurrencyMismatch
+			}
+			if !args.Amount.IsPositive() {
+				return errors.New("amount must be positive")
+			}
+			if args.Amount.Amount > remaining {
+				return ErrRefundExceedsRemaining
+			}
+			refund = args.Amount.Amount
+		}
+		// The recipient returns money it can spend, not money reserved by its holds
+		if toAccount.AvailableBalance() < refund {
+			return ErrInsufficientFunds
+		}
+		refunded := original.RefundedAmount + refund
+		// Returned to the sender, as the same share of the original amount as refunded is of
+		// the received one; computing it from running totals makes the parts add up exactly
+		refundFrom := shareOf(original.Amount, refunded, original.ToAmount) -
+			shareOf(original.Amount, original.RefundedAmount, original.ToAmount)
+		if refundFrom <= 0 {
+			return errors.New("amount is too small to convert")
+		}
+		rate, err := fx.ParseRate(original.ExchangeRate)
+		if err != nil {
+			return err
+		}
+
+		reversal := models.Transfer{
+			FromAccountID:      original.ToAccountID,
+			ToAccountID:        original.FromAccountID,
+			Amount:             refund,
+			FromCurrency:       original.ToCurrency,
+			ToAmount:           refundFrom,
+			ToCurrency:         original.FromCurrency,
+			ExchangeRate:       fx.FormatRate(rate.Inv(rate)),
+			Status:             models.TransferStatusCompleted,
+			OriginalTransferID: &original.ID,
+		}
+		if err := tx.Create(&reversal).Error; err != nil {
+			return err
+		}
+
+		postings := []ledger.Posting{{AccountID: original.ToAccountID, Amount: money.Money{Amount: -refund, Currency: original.ToCurrency}}}
+		if original.FromCurrency != original.ToCurrency {
+			fxTo, err := ledger.SystemAccount(tx, ledger.SystemFX, original.ToCurrency)
+			if err != nil {
+				return err
+			}
+			fxFrom, err := ledger.SystemAccount(tx, ledger.SystemFX, original.FromCurrency)
+			if err != nil {
+				return err
+			}
+			postings = append(postings,
+				ledger.Posting{AccountID: fxTo, Amount: money.Money{Amount: refund, Currency: original.ToCurrency}},
+				ledger.Posting{AccountID: fxFrom, Amount: money.Money{Amount: -refundFrom, Currency: original.FromCurrency}},
+			)
+		}
+		postings = append(postings, ledger.Posting{AccountID: original.FromAccountID, Amount: money.Money{Amount: refundFrom, Currency: original.FromCurrency}})
+		_, err = ledger.Post(tx, ledger.JournalParams{
+			Kind:        ledger.KindReversal,
+			TransferID:  &reversal.ID,
+			Description: args.Reason,
+			Postings:    postings,
+		})
+		if errors.Is(err, ledger.ErrNegativeBalance) {
+			return ErrInsufficientFunds
+		}
+		if err != nil {
+			return err
+		}
+		if err := events.Record(tx, events.TransferCompleted, events.AggregateTransfer, reversal.ID, reversal); err != nil {
+			return err
+		}
+
+		original.RefundedAmount = refunded
+		original.Status = models.TransferStatusPartiallyReversed
+		if refunded == original.ToAmount {
+			original.Status = models.TransferStatusReversed
+		}
+		err = tx.Model(&models.Transfer{}).Where("id = ?", original.ID).Updates(map[string]interface{}{
+			"refunded_amount": original.RefundedAmount,
+			"status":          original.Status,
+		}).Error
+		if err != nil {
+			return err
+		}
+		result.Reversal = reversal
+		result.Original = original
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	events.Live.Notify(result.Reversal.FromAccountID, result.Reversal.ToAccountID)
+	return result, nil
+}
+
+// shareOf returns amount * part / whole, rounded down
+func shareOf(amount, part, whole int64) int64 {
+	n := new(big.Int).Mul(big.NewInt(amount), big.NewInt(part))
+	return n.Quo(n, big.NewInt(whole)).Int64()
+}
+
+// Reverse returns all or part of a transfer to its sender on behalf of subject
+func (s *Service) Reverse(ctx context.Context, transferID string, req ReverseTransferRequest, subject authz.Subject) (*ReverseTransferResponse, error) {
+	result, err := s.repo.ReverseTx(ctx, ReverseTxParams{
+		TransferID: transferID,
+		Subject:    subject,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ReverseTransferResponse{
+		Reversal: *toTransferResponse(result.Reversal),
+		Original: *toTransferResponse(result.Original),
+	}, nil
+}
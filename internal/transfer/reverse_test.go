@@ -0,0 +1,144 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func balanceOf(t *testing.T, accountID uuid.UUID) int64 {
+	var acc models.Account
+	err := db.DB.First(&acc, "id = ?", accountID).Error
+	assert.NoError(t, err)
+	return acc.Balance
+}
+
+func TestReverse_Full(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 100, "USD")
+	sent, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 300, Currency: "USD"},
+	}, sender.ID.String())
+	assert.NoError(t, err)
+
+	subject := authz.Subject{UserID: recipient.ID, Role: models.RoleCustomer}
+	resp, err := service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{Reason: "sent by mistake"}, subject)
+	assert.NoError(t, err)
+	assert.Equal(t, sent.ID, resp.Reversal.OriginalTransferID)
+	assert.Equal(t, acc2.ID.String(), resp.Reversal.FromAccountID)
+	assert.Equal(t, money.Money{Amount: 300, Currency: "USD"}, resp.Reversal.Amount)
+	assert.Equal(t, models.TransferStatusReversed, resp.Original.Status)
+	assert.Equal(t, money.Money{Amount: 300, Currency: "USD"}, resp.Original.RefundedAmount)
+	assert.Equal(t, int64(1000), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(100), balanceOf(t, acc2.ID))
+
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, subject)
+	assert.ErrorIs(t, err, ErrAlreadyReversed)
+	_, err = service.Reverse(context.Background(), resp.Reversal.ID, ReverseTransferRequest{}, authz.Subject{UserID: sender.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrReversalOfReversal)
+}
+
+func TestReverse_Partial(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+	sent, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 500, Currency: "USD"},
+	}, sender.ID.String())
+	assert.NoError(t, err)
+
+	subject := authz.Subject{UserID: recipient.ID, Role: models.RoleCustomer}
+	part := money.Money{Amount: 200, Currency: "USD"}
+	resp, err := service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{Amount: &part}, subject)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TransferStatusPartiallyReversed, resp.Original.Status)
+	assert.Equal(t, part, resp.Original.RefundedAmount)
+
+	tooMuch := money.Money{Amount: 301, Currency: "USD"}
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{Amount: &tooMuch}, subject)
+	assert.ErrorIs(t, err, ErrRefundExceedsRemaining)
+	wrongCurrency := money.Money{Amount: 100, Currency: "EUR"}
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{Amount: &wrongCurrency}, subject)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	// Without an amount the rest is returned
+	resp, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, subject)
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 300, Currency: "USD"}, resp.Reversal.Amount)
+	assert.Equal(t, models.TransferStatusReversed, resp.Original.Status)
+	assert.Equal(t, int64(1000), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(0), balanceOf(t, acc2.ID))
+}
+
+func TestReverse_CrossCurrencyPartsAddUp(t *testing.T) {
+	service := setupTestService(t)
+	rates, err := fx.NewStaticProvider("USD", map[string]string{"EUR": "0.5"})
+	assert.NoError(t, err)
+	service.repo.Rates = rates
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "EUR")
+	sent, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 301, Currency: "USD"},
+	}, sender.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), sent.ToAmount.Amount)
+
+	// Three refunds of 50 EUR cents return exactly the 301 USD cents sent
+	admin := authz.Subject{UserID: uuid.New(), Role: models.RoleAdmin}
+	part := money.Money{Amount: 50, Currency: "EUR"}
+	var returned int64
+	for i := 0; i < 3; i++ {
+		resp, err := service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{Amount: &part}, admin)
+		assert.NoError(t, err)
+		assert.Equal(t, "USD", resp.Reversal.ToAmount.Currency)
+		assert.Equal(t, "2.0000000000", resp.Reversal.ExchangeRate)
+		returned += resp.Reversal.ToAmount.Amount
+	}
+	assert.Equal(t, int64(301), returned)
+	assert.Equal(t, int64(1000), balanceOf(t, acc1.ID))
+	assert.Equal(t, int64(0), balanceOf(t, acc2.ID))
+}
+
+func TestReverse_Permissions(t *testing.T) {
+	service := setupTestService(t)
+	sender, recipient := createTestUser(t), createTestUser(t)
+	acc1 := createTestAccount(t, sender.ID, sender.Username, 1000, "USD")
+	acc2 := createTestAccount(t, recipient.ID, recipient.Username, 0, "USD")
+	sent, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	}, sender.ID.String())
+	assert.NoError(t, err)
+
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, authz.Subject{UserID: sender.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrReverseForbidden)
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, authz.Subject{UserID: uuid.New(), Role: models.RoleTeller})
+	assert.ErrorIs(t, err, ErrReverseForbidden)
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+
+	// The recipient has spent the money meanwhile
+	err = db.DB.Model(&models.Account{}).
+		Where("id = ?", acc2.ID).Update("balance", 40).Error
+	assert.NoError(t, err)
+	_, err = service.Reverse(context.Background(), sent.ID, ReverseTransferRequest{}, authz.Subject{UserID: recipient.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
@@ -1,7 +1,10 @@
 package transfer
 
 import (
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/idempotency"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,6 +14,9 @@ func RegisterRoutes(routerGroup *gin.RouterGroup) {
 
 	routerGroup.GET("", auth.UserMiddleware(), controller.findAll)
 	routerGroup.GET(":id", auth.UserMiddleware(), controller.findOne)
-	routerGroup.POST("", auth.UserMiddleware(), controller.executeTransfer)
-
+	routerGroup.POST("", auth.UserMiddleware(), ratelimit.Middleware(ratelimit.GroupTransfers), idempotency.Middleware(), audit.Action("transfer.create", "transfer"), controller.executeTransfer)
+	routerGroup.GET("holds/:id", auth.UserMiddleware(), controller.findHold)
+	routerGroup.POST("holds/:id/capture", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("transfer.hold.capture", "hold"), controller.captureHold)
+	routerGroup.POST("holds/:id/void", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("transfer.hold.void", "hold"), controller.voidHold)
+	routerGroup.POST(":id/reverse", auth.UserMiddleware(), idempotency.Middleware(), audit.Action("transfer.reverse", "transfer"), controller.reverseTransfer)
 }
@@ -2,46 +2,84 @@ package transfer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Errors
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrTransferNotFound    = errors.New("transfer not found")
+	ErrSameAccount         = errors.New("cannot transfer to the same account")
+	ErrNotAccountOwner     = errors.New("from account does not belong to user")
+	ErrCurrencyMismatch    = errors.New("currency does not match the account")
+	ErrQuoteAmountMismatch = errors.New("quote amount does not match the transfer amount")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrAccountFrozen       = errors.New("account is frozen")
+	ErrAccountClosed       = errors.New("account is closed")
+	ErrInvalidSort         = errors.New("transfers can only be sorted by created_at, amount or status, asc or desc")
+	ErrUnsupportedQuery    = errors.New("s, filter, join and fields are not supported; use direction, page, limit and sort")
+)
+
+// defaultListLimit is the page size of a transfer listing without a limit
+const defaultListLimit = 20
+
 type Service struct {
 	crud.Service[model]
 	repo *Repository
+	mfa  *mfa.Service
+	// stepUpThresholds are the amounts per currency from which a transfer needs a TOTP code
+	stepUpThresholds map[string]money.Money
 }
 
+// NewService returns a service without step-up thresholds
 func NewService(repository *Repository) *Service {
 	return &Service{
 		Service: *crud.NewService(repository),
 		repo:    repository,
+		mfa:     mfa.InitService(),
 	}
 }
 
 func InitService() *Service {
+	thresholds, err := stepUpThresholdsFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading step-up thresholds: %v", err)
+	}
 	return &Service{
-		repo:    InitRepository(),
-		Service: *crud.NewService(InitRepository()),
+		repo:             InitRepository(),
+		Service:          *crud.NewService(InitRepository()),
+		mfa:              mfa.InitService(),
+		stepUpThresholds: thresholds,
 	}
 }
 
-// Transfer performs a money transfer between accounts using a transaction
-func (s *Service) Transfer(ctx context.Context, req CreateTransferRequest) (*CreateTransferResponse, error) {
-	params := TransferTxParams(req)
+// Transfer performs a money transfer between accounts using a transaction.
+// The source account must be owned by userID.
+func (s *Service) Transfer(ctx context.Context, req CreateTransferRequest, userID string) (*CreateTransferResponse, error) {
+	params := TransferTxParams{
+		UserID:        userID,
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		QuoteID:       req.QuoteID,
+	}
 	result, err := s.repo.TransferTx(ctx, params)
 	if err != nil {
 		return nil, err
 	}
-	resp := &CreateTransferResponse{
-		ID:            result.Transfer.ID.String(),
-		FromAccountID: result.Transfer.FromAccountID.String(),
-		ToAccountID:   result.Transfer.ToAccountID.String(),
-		Amount:        result.Transfer.Amount,
-		CreatedAt:     result.Transfer.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-	}
-	return resp, nil
+	return toTransferResponse(result.Transfer), nil
 }
 
 // FindAllByAccountID returns all transfers for a given account as sender or receiver
@@ -52,29 +90,117 @@ func (s *Service) FindAllByAccountID(ctx context.Context, accountID string) ([]C
 	}
 	responses := make([]CreateTransferResponse, 0, len(transfers))
 	for _, t := range transfers {
-		responses = append(responses, CreateTransferResponse{
-			ID:            t.ID.String(),
-			FromAccountID: t.FromAccountID.String(),
-			ToAccountID:   t.ToAccountID.String(),
-			Amount:        t.Amount,
-			CreatedAt:     t.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		responses = append(responses, *toTransferResponse(t))
 	}
 	return responses, nil
 }
 
-// isAccountBelongsToUser checks if the account belongs to the user
-func (s *Service) isAccountBelongsToUser(ctx context.Context, accountID, userID string) bool {
-	db := s.repo.Repository.DB
-	var account models.Account
+func toTransferResponse(t models.Transfer) *CreateTransferResponse {
+	resp := &CreateTransferResponse{
+		ID:             t.ID.String(),
+		FromAccountID:  t.FromAccountID.String(),
+		ToAccountID:    t.ToAccountID.String(),
+		Amount:         money.Money{Amount: t.Amount, Currency: t.FromCurrency},
+		ToAmount:       money.Money{Amount: t.ToAmount, Currency: t.ToCurrency},
+		ExchangeRate:   t.ExchangeRate,
+		Status:         t.Status,
+		RefundedAmount: money.Money{Amount: t.RefundedAmount, Currency: t.ToCurrency},
+		CreatedAt:      t.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if t.QuoteID != nil {
+		resp.QuoteID = t.QuoteID.String()
+	}
+	if t.OriginalTransferID != nil {
+		resp.OriginalTransferID = t.OriginalTransferID.String()
+	}
+	return resp
+}
+
+// transferSortColumns are the columns a transfer listing can be sorted by
+var transferSortColumns = map[string]bool{"created_at": true, "amount": true, "status": true}
+
+// parseTransferSort reads a sort parameter such as created_at,desc
+func parseTransferSort(sort string) (*clause.OrderByColumn, error) {
+	if sort == "" {
+		return nil, nil
+	}
+	column, direction, _ := strings.Cut(sort, ",")
+	if !transferSortColumns[column] {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSort, column)
+	}
+	switch direction {
+	case "", "asc":
+		return &clause.OrderByColumn{Column: clause.Column{Name: column}}, nil
+	case "desc":
+		return &clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: true}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSort, direction)
+	}
+}
+
+// findAllVisible returns a page of the transfers of an account that subject may view, and how
+// many there are in all. Hidden accounts are reported as not found.
+func (s *Service) findAllVisible(ctx context.Context, req ListTransfersRequest, subject authz.Subject) ([]model, int64, error) {
+	if !s.canViewAccount(ctx, req.AccountID, subject) {
+		return nil, 0, ErrAccountNotFound
+	}
+	order, err := parseTransferSort(req.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	offset := 0
+	if req.Page > 0 {
+		offset = (req.Page - 1) * limit
+	}
+	return s.repo.FindPageByAccountID(ctx, AccountTransfersQuery{
+		AccountID: uuid.MustParse(req.AccountID),
+		Direction: req.Direction,
+		Order:     order,
+		Offset:    offset,
+		Limit:     limit,
+	})
+}
+
+// unscoped lets a preload find closed accounts, which are soft deleted
+func unscoped(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
+
+// canViewAccount reports whether subject may see the transfers of an account
+func (s *Service) canViewAccount(ctx context.Context, accountID string, subject authz.Subject) bool {
 	aid, err := uuid.Parse(accountID)
 	if err != nil {
 		return false
 	}
-	uid, err := uuid.Parse(userID)
-	if err != nil {
+	var account models.Account
+	if err := s.repo.Repository.DB.WithContext(ctx).Unscoped().Where("id = ?", aid).First(&account).Error; err != nil {
 		return false
 	}
-	err = db.WithContext(ctx).Where("id = ? AND user_id = ?", aid, uid).First(&account).Error
-	return err == nil
+	return authz.CanView(subject, &account)
+}
+
+// findVisible loads a transfer that subject may view, that is one where the subject owns
+// either account. Transfers hidden from the subject are reported as not found.
+func (s *Service) findVisible(ctx context.Context, transferID string, subject authz.Subject) (*models.Transfer, error) {
+	id, err := uuid.Parse(transferID)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	var transfer models.Transfer
+	err = s.repo.Repository.DB.WithContext(ctx).
+		Preload("FromAccount", unscoped).
+		Preload("ToAccount", unscoped).
+		Where("id = ?", id).
+		First(&transfer).Error
+	if err != nil || !authz.CanView(subject, &transfer) {
+		return nil, ErrTransferNotFound
+	}
+	// The accounts were only loaded for the check; the counterparty's account is not ours to show
+	transfer.FromAccount = nil
+	transfer.ToAccount = nil
+	return &transfer, nil
 }
@@ -2,16 +2,23 @@ package transfer
 
 import (
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"context"
 
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
-	"github.com/ahmedkhaeld/banking-app/internal/account"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
 	"github.com/ahmedkhaeld/banking-app/internal/user"
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -21,11 +28,15 @@ import (
 func setupTestRepository(t *testing.T) *Repository {
 	repo := InitRepository()
 	t.Cleanup(func() {
+		repo.Repository.DB.Exec("DELETE FROM holds")
 		repo.Repository.DB.Exec("DELETE FROM transfers")
+		repo.Repository.DB.Exec("DELETE FROM fx_quotes")
 		repo.Repository.DB.Exec("DELETE FROM entries")
+		repo.Repository.DB.Exec("DELETE FROM journals")
 		repo.Repository.DB.Exec("DELETE FROM accounts")
+		repo.Repository.DB.Exec("DELETE FROM recovery_codes")
 		repo.Repository.DB.Exec("DELETE FROM users")
-
+		repo.Repository.DB.Exec("DELETE FROM outbox")
 	})
 	return repo
 }
@@ -52,7 +63,7 @@ func TestMain(m *testing.M) {
 	}
 
 	// Run migrations
-	if err := db.DB.AutoMigrate(&models.Account{}, &models.Transfer{}, &models.Entry{}, &models.User{}); err != nil {
+	if err := db.DB.AutoMigrate(&models.Account{}, &models.Hold{}, &models.Transfer{}, &models.Journal{}, &models.Entry{}, &models.User{}, &models.FxQuote{}, &models.RecoveryCode{}, &models.OutboxEvent{}, &models.OutboxDelivery{}); err != nil {
 		panic("failed to run migrations: " + err.Error())
 	}
 
@@ -85,8 +96,7 @@ func createTestAccount(t *testing.T, userID uuid.UUID, username string, balance
 		Balance:  balance,
 		Currency: currency,
 	}
-	repo := account.InitRepository()
-	err := repo.Repository.DB.Create(acc).Error
+	err := db.DB.Create(acc).Error
 	assert.NoError(t, err)
 	return acc
 }
@@ -101,9 +111,9 @@ func TestTransfer_Success(t *testing.T) {
 	req := CreateTransferRequest{
 		FromAccountID: acc1.ID.String(),
 		ToAccountID:   acc2.ID.String(),
-		Amount:        200,
+		Amount:        money.Money{Amount: 200, Currency: "USD"},
 	}
-	resp, err := service.Transfer(context.Background(), req)
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, req.Amount, resp.Amount)
@@ -111,11 +121,10 @@ func TestTransfer_Success(t *testing.T) {
 	assert.Equal(t, req.ToAccountID, resp.ToAccountID)
 
 	// Check balances updated
-	repo := account.InitRepository()
 	var updatedAcc1, updatedAcc2 models.Account
-	err = repo.Repository.DB.First(&updatedAcc1, "id = ?", acc1.ID).Error
+	err = db.DB.First(&updatedAcc1, "id = ?", acc1.ID).Error
 	assert.NoError(t, err)
-	err = repo.Repository.DB.First(&updatedAcc2, "id = ?", acc2.ID).Error
+	err = db.DB.First(&updatedAcc2, "id = ?", acc2.ID).Error
 	assert.NoError(t, err)
 	assert.Equal(t, int64(800), updatedAcc1.Balance)
 	assert.Equal(t, int64(300), updatedAcc2.Balance)
@@ -128,9 +137,9 @@ func TestTransfer_InvalidFromAccount(t *testing.T) {
 	req := CreateTransferRequest{
 		FromAccountID: uuid.New().String(), // invalid (does not exist)
 		ToAccountID:   acc.ID.String(),
-		Amount:        50,
+		Amount:        money.Money{Amount: 50, Currency: "USD"},
 	}
-	resp, err := service.Transfer(context.Background(), req)
+	resp, err := service.Transfer(context.Background(), req, user.ID.String())
 	assert.Error(t, err)
 	assert.Nil(t, resp)
 }
@@ -142,9 +151,9 @@ func TestTransfer_InvalidToAccount(t *testing.T) {
 	req := CreateTransferRequest{
 		FromAccountID: acc.ID.String(),
 		ToAccountID:   uuid.New().String(), // invalid (does not exist)
-		Amount:        50,
+		Amount:        money.Money{Amount: 50, Currency: "USD"},
 	}
-	resp, err := service.Transfer(context.Background(), req)
+	resp, err := service.Transfer(context.Background(), req, user.ID.String())
 	assert.Error(t, err)
 	assert.Nil(t, resp)
 }
@@ -158,9 +167,9 @@ func TestTransfer_NegativeAmount(t *testing.T) {
 	req := CreateTransferRequest{
 		FromAccountID: acc1.ID.String(),
 		ToAccountID:   acc2.ID.String(),
-		Amount:        -100,
+		Amount:        money.Money{Amount: -100, Currency: "USD"},
 	}
-	resp, err := service.Transfer(context.Background(), req)
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
 	assert.Error(t, err)
 	assert.Nil(t, resp)
 }
@@ -174,9 +183,236 @@ func TestTransfer_ZeroAmount(t *testing.T) {
 	req := CreateTransferRequest{
 		FromAccountID: acc1.ID.String(),
 		ToAccountID:   acc2.ID.String(),
-		Amount:        0,
+		Amount:        money.Money{Amount: 0, Currency: "USD"},
 	}
-	resp, err := service.Transfer(context.Background(), req)
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
 	assert.Error(t, err)
 	assert.Nil(t, resp)
 }
+
+func TestTransfer_NotAccountOwner(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "USD")
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user2.ID.String())
+	assert.ErrorIs(t, err, ErrNotAccountOwner)
+	assert.Nil(t, resp)
+}
+
+func TestFindVisible_OnlyParties(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "USD")
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.NoError(t, err)
+
+	for _, userID := range []uuid.UUID{user1.ID, user2.ID} {
+		transfer, err := service.findVisible(context.Background(), resp.ID, authz.Subject{UserID: userID, Role: models.RoleCustomer})
+		assert.NoError(t, err)
+		assert.Nil(t, transfer.FromAccount)
+		assert.Nil(t, transfer.ToAccount)
+	}
+
+	stranger := createTestUser(t)
+	_, err = service.findVisible(context.Background(), resp.ID, authz.Subject{UserID: stranger.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+	assert.False(t, service.canViewAccount(context.Background(), acc1.ID.String(), authz.Subject{UserID: stranger.ID, Role: models.RoleCustomer}))
+
+	_, err = service.findVisible(context.Background(), resp.ID, authz.Subject{UserID: stranger.ID, Role: models.RoleAdmin})
+	assert.NoError(t, err)
+}
+
+func TestFindAllVisible_ScopedToAccount(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 1000, "USD")
+	acc3 := createTestAccount(t, user2.ID, user2.Username, 0, "USD")
+	for _, amount := range []int64{100, 300} {
+		_, err := service.Transfer(context.Background(), CreateTransferRequest{
+			FromAccountID: acc1.ID.String(),
+			ToAccountID:   acc2.ID.String(),
+			Amount:        money.Money{Amount: amount, Currency: "USD"},
+		}, user1.ID.String())
+		assert.NoError(t, err)
+	}
+	// A transfer between other accounts must never show up in the listing of acc1
+	_, err := service.Transfer(context.Background(), CreateTransferRequest{
+		FromAccountID: acc2.ID.String(),
+		ToAccountID:   acc3.ID.String(),
+		Amount:        money.Money{Amount: 50, Currency: "USD"},
+	}, user2.ID.String())
+	assert.NoError(t, err)
+
+	owner := authz.Subject{UserID: user1.ID, Role: models.RoleCustomer}
+	transfers, total, err := service.findAllVisible(context.Background(), ListTransfersRequest{AccountID: acc1.ID.String(), Sort: "amount,asc"}, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	if assert.Len(t, transfers, 2) {
+		assert.Equal(t, int64(100), transfers[0].Amount)
+		assert.Equal(t, int64(300), transfers[1].Amount)
+	}
+
+	transfers, total, err = service.findAllVisible(context.Background(), ListTransfersRequest{AccountID: acc1.ID.String(), Direction: "incoming"}, owner)
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, transfers)
+
+	transfers, _, err = service.findAllVisible(context.Background(), ListTransfersRequest{AccountID: acc1.ID.String(), Page: 2, Limit: 1}, owner)
+	assert.NoError(t, err)
+	if assert.Len(t, transfers, 1) {
+		assert.Equal(t, int64(100), transfers[0].Amount)
+	}
+
+	_, _, err = service.findAllVisible(context.Background(), ListTransfersRequest{AccountID: acc1.ID.String()}, authz.Subject{UserID: user2.ID, Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+	_, _, err = service.findAllVisible(context.Background(), ListTransfersRequest{AccountID: acc1.ID.String(), Sort: "id;drop table transfers,asc"}, owner)
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestFindAll_RejectsGenericQueries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/transfer", NewController(setupTestService(t)).findAll)
+	for _, query := range []string{
+		`s={"$or":[{"id":{"notnull":""}},{"id":{"notnull":""}}]}`,
+		"filter=amount||gte||0",
+		"join=from_account",
+		"fields=id",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/transfer?account_id="+uuid.NewString()+"&"+url.PathEscape(query), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestTransfer_FrozenAccount(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "USD")
+	err := db.DB.Model(&models.Account{}).
+		Where("id = ?", acc2.ID).Update("status", models.AccountStatusFrozen).Error
+	assert.NoError(t, err)
+
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.ErrorIs(t, err, ErrAccountFrozen)
+	assert.Nil(t, resp)
+}
+
+func TestTransfer_InsufficientFunds(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 100, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "USD")
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 101, Currency: "USD"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	assert.Nil(t, resp)
+
+	// Balance must be untouched
+	var updatedAcc1 models.Account
+	err = db.DB.First(&updatedAcc1, "id = ?", acc1.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), updatedAcc1.Balance)
+}
+
+func TestTransfer_CrossCurrency(t *testing.T) {
+	service := setupTestService(t)
+	rates, err := fx.NewStaticProvider("USD", map[string]string{"EUR": "0.5"})
+	assert.NoError(t, err)
+	service.repo.Rates = rates
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "EUR")
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 200, Currency: "USD"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 200, Currency: "USD"}, resp.Amount)
+	assert.Equal(t, money.Money{Amount: 100, Currency: "EUR"}, resp.ToAmount)
+	assert.Equal(t, "0.5000000000", resp.ExchangeRate)
+
+	var updatedAcc1, updatedAcc2 models.Account
+	err = db.DB.First(&updatedAcc1, "id = ?", acc1.ID).Error
+	assert.NoError(t, err)
+	err = db.DB.First(&updatedAcc2, "id = ?", acc2.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(800), updatedAcc1.Balance)
+	assert.Equal(t, int64(200), updatedAcc2.Balance)
+}
+
+func TestTransfer_QuoteCurrencyMismatch(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "EUR")
+	quote := &models.FxQuote{
+		UserID:            user1.ID,
+		FromCurrency:      "USD",
+		ToCurrency:        "GBP",
+		Rate:              "0.8",
+		SourceAmount:      100,
+		DestinationAmount: 80,
+		ExpiresAt:         time.Now().Add(time.Minute),
+	}
+	err := service.repo.Repository.DB.Create(quote).Error
+	assert.NoError(t, err)
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "USD"},
+		QuoteID:       quote.ID.String(),
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	assert.Nil(t, resp)
+}
+
+func TestTransfer_AmountCurrencyMismatch(t *testing.T) {
+	service := setupTestService(t)
+	user1 := createTestUser(t)
+	user2 := createTestUser(t)
+	acc1 := createTestAccount(t, user1.ID, user1.Username, 1000, "USD")
+	acc2 := createTestAccount(t, user2.ID, user2.Username, 100, "USD")
+	req := CreateTransferRequest{
+		FromAccountID: acc1.ID.String(),
+		ToAccountID:   acc2.ID.String(),
+		Amount:        money.Money{Amount: 100, Currency: "EUR"},
+	}
+	resp, err := service.Transfer(context.Background(), req, user1.ID.String())
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	assert.Nil(t, resp)
+}
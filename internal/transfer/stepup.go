@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/google/uuid"
+)
+
+// StepUpHeader carries the TOTP code that authorises a transfer above the step-up threshold
+const StepUpHeader = "X-TOTP-Code"
+
+// Errors
+var (
+	ErrStepUpRequired    = errors.New("a TOTP code in the " + StepUpHeader + " header is required for this transfer")
+	ErrStepUpUnavailable = errors.New("two-factor authentication must be enabled for transfers of this size")
+	ErrInvalidThreshold  = errors.New("invalid step-up threshold")
+)
+
+// ParseStepUpThresholds parses a comma-separated list of CURRENCY:AMOUNT pairs, such as
+// "USD:1000,EUR:1000,EGP:50000". Currencies that are not listed never need a step-up.
+func ParseStepUpThresholds(spec string) (map[string]money.Money, error) {
+	thresholds := make(map[string]money.Money)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		currency, amount, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidThreshold, pair)
+		}
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		threshold, err := money.Parse(amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidThreshold, pair, err)
+		}
+		if !threshold.IsPositive() {
+			return nil, fmt.Errorf("%w: %q must be positive", ErrInvalidThreshold, pair)
+		}
+		thresholds[currency] = threshold
+	}
+	return thresholds, nil
+}
+
+// stepUpThresholdsFromEnv reads STEP_UP_THRESHOLDS
+func stepUpThresholdsFromEnv() (map[string]money.Money, error) {
+	return ParseStepUpThresholds(os.Getenv(common.StepUpThresholds))
+}
+
+// requiresStepUp reports whether amount reaches the step-up threshold of its currency
+func (s *Service) requiresStepUp(amount money.Money) bool {
+	threshold, ok := s.stepUpThresholds[amount.Currency]
+	return ok && amount.Amount >= threshold.Amount
+}
+
+// CheckStepUp asks for a fresh TOTP code before a transfer, or a standing order, that
+// reaches the threshold. Users without TOTP cannot make such transfers until they enable it.
+func (s *Service) CheckStepUp(ctx context.Context, userID string, amount money.Money, code string) error {
+	if !s.requiresStepUp(amount) {
+		return nil
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return errors.New("invalid user_id format")
+	}
+	if code == "" {
+		// Say up front that no code can work, rather than asking for one
+		enabledAt, _, err := s.mfa.Status(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if enabledAt == nil {
+			return ErrStepUpUnavailable
+		}
+		return ErrStepUpRequired
+	}
+	err = s.mfa.VerifyStepUp(ctx, uid, code)
+	if errors.Is(err, mfa.ErrNotEnabled) {
+		return ErrStepUpUnavailable
+	}
+	return err
+}
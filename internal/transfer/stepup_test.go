@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStepUpThresholds(t *testing.T) {
+	thresholds, err := ParseStepUpThresholds("usd:1000, EUR:999.50,")
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money{Amount: 100000, Currency: "USD"}, thresholds["USD"])
+	assert.Equal(t, money.Money{Amount: 99950, Currency: "EUR"}, thresholds["EUR"])
+
+	thresholds, err = ParseStepUpThresholds("")
+	assert.NoError(t, err)
+	assert.Empty(t, thresholds)
+
+	for _, spec := range []string{"USD", "USD:abc", "XYZ:10", "USD:0", "USD:1.234"} {
+		_, err := ParseStepUpThresholds(spec)
+		assert.ErrorIs(t, err, ErrInvalidThreshold, spec)
+	}
+}
+
+func TestCheckStepUp(t *testing.T) {
+	service := setupTestService(t)
+	service.stepUpThresholds = map[string]money.Money{"USD": {Amount: 100000, Currency: "USD"}}
+	user := createTestUser(t)
+	small := money.Money{Amount: 99999, Currency: "USD"}
+	large := money.Money{Amount: 100000, Currency: "USD"}
+	unlisted := money.Money{Amount: 10000000, Currency: "EUR"}
+
+	assert.NoError(t, service.CheckStepUp(context.Background(), user.ID.String(), small, ""))
+	assert.NoError(t, service.CheckStepUp(context.Background(), user.ID.String(), unlisted, ""))
+	assert.ErrorIs(t, service.CheckStepUp(context.Background(), user.ID.String(), large, ""), ErrStepUpUnavailable)
+	assert.ErrorIs(t, service.CheckStepUp(context.Background(), user.ID.String(), large, "123456"), ErrStepUpUnavailable)
+
+	// Enrol, confirming with the code of the previous period so the current one is still fresh
+	enrolment, err := service.mfa.Enroll(context.Background(), user.ID)
+	assert.NoError(t, err)
+	previous, err := auth.TOTPCode(enrolment.Secret, time.Now().Add(-30*time.Second))
+	assert.NoError(t, err)
+	_, err = service.mfa.Confirm(context.Background(), user.ID, previous)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, service.CheckStepUp(context.Background(), user.ID.String(), large, ""), ErrStepUpRequired)
+	assert.ErrorIs(t, service.CheckStepUp(context.Background(), user.ID.String(), large, "000000"), mfa.ErrInvalidCode)
+
+	code, err := auth.TOTPCode(enrolment.Secret, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, service.CheckStepUp(context.Background(), user.ID.String(), large, code))
+	assert.ErrorIs(t, service.CheckStepUp(context.Background(), user.ID.String(), large, code), mfa.ErrCodeReused)
+}
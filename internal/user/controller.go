@@ -1,20 +1,25 @@
 package user
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
-	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 const (
-	//JWT Expire
-	JWTExpire = 24 * 60 * 60 * time.Second // 24 hours
+	// Access token expiry; clients renew it with their refresh token
+	AccessTokenExpire = 15 * time.Minute
+	// Refresh token expiry
+	RefreshTokenExpire = 7 * 24 * time.Hour
 )
 
 type Controller struct {
@@ -23,27 +28,26 @@ type Controller struct {
 
 // @Success  200  {object}  model
 // @Tags     user
+// @Security JWT
+// @Description Users can only read their own profile; staff can read any. Other users are reported as not found.
 // @param    id    path  string  true  "uuid of item"
+// @Failure  404  {object}  map[string]string
 // @Router   /api/v1/user/{id} [get]
 func (c *Controller) findOne(ctx *gin.Context) {
-	var api crud.GetAllRequest
 	var item common.ById
-	if err := ctx.ShouldBindQuery(&api); err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
-		return
-	}
 	if err := ctx.ShouldBindUri(&item); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
 
-	api.Filter = append(api.Filter, fmt.Sprintf("id||eq||%s", item.ID))
-
-	var result model
-
-	err := c.service.FindOne(api, &result)
+	result, err := c.service.findVisible(item.ID, subject)
 	if err != nil {
-		ctx.JSON(400, gin.H{"message": err.Error()})
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
 	ctx.JSON(200, result)
@@ -67,50 +71,71 @@ func (c *Controller) create(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, gin.H{"data": user})
 }
 
-// @Success  200  {string}  string  "ok"
+// @Success  200  {object}  model
 // @Tags     user
 // @Security JWT
-// @Description Update user information
-// @Description Update user information by ID
-// @param    id  path  string  true  "uuid of item"
-// @param    item  body  model   true  "update body"
+// @Description Update your own full name or email. Admins may update any user.
+// @Description Changing the email clears its verification status.
+// @param    id    path  string             true  "uuid of item"
+// @param    item  body  UpdateUserRequest  true  "update body"
+// @Failure  400  {object}  map[string]string
+// @Failure  403  {object}  map[string]string
+// @Failure  404  {object}  map[string]string
+// @Failure  409  {object}  map[string]string
 // @Router   /api/v1/user/{id} [patch]
 func (c *Controller) update(ctx *gin.Context) {
-	var item model
+	var req UpdateUserRequest
 	var byId common.ById
-	if err := ctx.ShouldBind(&item); err != nil {
+	if err := ctx.ShouldBindUri(&byId); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	if err := ctx.ShouldBindUri(&byId); err != nil {
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	id, err := uuid.Parse(byId.ID)
+	subject, err := authz.SubjectFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
-	if err := ctx.ShouldBindUri(&byId); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-		return
+
+	// The snapshot taken before the update is only recorded if the update succeeds
+	before, _ := c.service.FindOneByID(byId.ID)
+	user, err := c.service.updateProfile(ctx, byId.ID, subject, req)
+	if err == nil {
+		audit.SetChanges(ctx, profileSnapshot(before), profileSnapshot(user))
 	}
-	err = c.service.Update(&model{ID: id}, &item)
-	if err != nil {
+	switch {
+	case errors.Is(err, ErrNotProfileOwner):
+		ctx.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrUserNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrEmailExists):
+		ctx.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	case err != nil:
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, item)
+	ctx.JSON(http.StatusOK, gin.H{"data": user})
 }
 
 // @Summary Login user
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return a short-lived JWT access token and a refresh token.
+// @Description Users with two-factor authentication get an MFAChallengeResponse instead; see /login/mfa.
+// @Description Repeated failures per username or client IP are throttled and eventually locked out for a while;
+// @Description the response is the same invalid username or password error either way.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param request body LoginUserRequest true "Login credentials"
-// @Success 200 {object} LoginUserResponse "JWT token and user info"
+// @Success 200 {object} LoginUserResponse "JWT access token, refresh token and user info"
+// @Success 200 {object} MFAChallengeResponse "second factor required"
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "email not verified, when REQUIRE_EMAIL_VERIFICATION=true"
 // @Router /api/v1/user/login [post]
 func (c *Controller) login(ctx *gin.Context) {
 	var req LoginUserRequest
@@ -118,29 +143,81 @@ func (c *Controller) login(ctx *gin.Context) {
 		ctx.JSON(400, gin.H{"message": err.Error()})
 		return
 	}
-	user, err := c.service.loginUser(req.Username, req.Password)
-	if err != nil {
+	audit.SetDetails(ctx, gin.H{"username": req.Username})
+	user, err := c.service.loginUser(ctx, req.Username, req.Password, ctx.ClientIP())
+	switch {
+	case errors.Is(err, ErrEmailNotVerified):
+		ctx.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrInvalidUsernameOrPassword):
 		ctx.JSON(400, gin.H{"message": err.Error()})
 		return
+	case err != nil:
+		ctx.JSON(500, gin.H{"message": "could not log in"})
+		return
 	}
-	// Create JWT token
-	jwtMaker, err := auth.NewJWTMaker()
-	if err != nil {
-		ctx.JSON(500, gin.H{"message": "could not create token maker"})
+	audit.SetActor(ctx, user.ID)
+	audit.SetResourceID(ctx, user.ID.String())
+	if mfa.Enabled(user) {
+		token, expiresAt, err := c.service.startMFAChallenge(ctx, user)
+		if err != nil {
+			ctx.JSON(500, gin.H{"message": "could not start two-factor challenge"})
+			return
+		}
+		ctx.JSON(200, MFAChallengeResponse{
+			MFARequired:       true,
+			MFAToken:          token,
+			MFATokenExpiresAt: expiresAt.Format(time.RFC3339),
+		})
 		return
 	}
-	userIDStr := user.ID.String()
-	if userIDStr == "" {
-		ctx.JSON(400, gin.H{"message": "user ID is empty"})
+	c.respondWithTokens(ctx, user)
+}
+
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token from /login and a TOTP or recovery code for access and refresh tokens.
+// @Description A challenge survives a few wrong codes, after which the user has to log in again.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body LoginMFARequest true "Challenge token and code"
+// @Success 200 {object} LoginUserResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/user/login/mfa [post]
+func (c *Controller) loginMFA(ctx *gin.Context) {
+	var req LoginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	user, err := c.service.completeMFAChallenge(ctx, req.MFAToken, req.Code)
+	switch {
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrUserNotFound),
+		errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrCodeReused), errors.Is(err, mfa.ErrNotEnabled):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "could not verify two-factor code"})
 		return
 	}
-	token, _, err := jwtMaker.CreateToken(userIDStr, JWTExpire)
+	audit.SetActor(ctx, user.ID)
+	audit.SetResourceID(ctx, user.ID.String())
+	c.respondWithTokens(ctx, user)
+}
+
+// respondWithTokens starts a session for a user who passed every login step
+func (c *Controller) respondWithTokens(ctx *gin.Context, user *models.User) {
+	tokens, err := c.service.issueTokens(ctx, user, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
 		ctx.JSON(500, gin.H{"message": "could not create token"})
 		return
 	}
 	resp := LoginUserResponse{
-		AccessToken: token,
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt.Format(time.RFC3339),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt.Format(time.RFC3339),
 	}
 	resp.User.ID = user.ID.String()
 	resp.User.Username = user.Username
@@ -149,8 +226,208 @@ func (c *Controller) login(ctx *gin.Context) {
 	ctx.JSON(200, resp)
 }
 
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token. The refresh token is rotated;
+// @Description replaying an already used refresh token revokes the whole session.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} TokenPairResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/user/token/refresh [post]
+func (c *Controller) refreshToken(ctx *gin.Context) {
+	var req RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	tokens, err := c.service.refreshTokens(ctx, req.RefreshToken, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenExpired) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+			return
+		}
+		ctx.JSON(500, gin.H{"message": "could not refresh token"})
+		return
+	}
+	ctx.JSON(200, TokenPairResponse{
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt.Format(time.RFC3339),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// @Summary Logout user
+// @Description Revoke the session of the current access token and its refresh token
+// @Tags user
+// @Security JWT
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/user/logout [post]
+func (c *Controller) logout(ctx *gin.Context) {
+	tokenID := ctx.GetString(auth.TokenIDKey)
+	audit.SetResourceID(ctx, ctx.GetString("user_id"))
+	if tokenID == "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "token_id not found in context"})
+		return
+	}
+	if err := c.service.logout(ctx, tokenID); err != nil {
+		if errors.Is(err, auth.ErrSessionRevoked) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+			return
+		}
+		ctx.JSON(500, gin.H{"message": "could not revoke session"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary Change password
+// @Description Change the caller's password. Every session is revoked, so all devices have to log in again.
+// @Tags user
+// @Security JWT
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/user/me/password [post]
+func (c *Controller) changePassword(ctx *gin.Context) {
+	var req ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetResourceID(ctx, subject.UserID.String())
+	err = c.service.changePassword(ctx, subject.UserID, req.CurrentPassword, req.NewPassword)
+	switch {
+	case errors.Is(err, ErrInvalidPassword):
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrUserNotFound):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "could not change password"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary Request a password reset
+// @Description Emails a single-use reset token if the address belongs to an account. The response is the same either way.
+// @Tags user
+// @Param request body ForgotPasswordRequest true "Email of the account"
+// @Success 202
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/user/password/forgot [post]
+func (c *Controller) forgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := c.service.requestPasswordReset(ctx, req.Email); err != nil {
+		log.Printf("Error requesting password reset: %v", err)
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// @Summary Reset password
+// @Description Sets a new password using the token from the reset email. Every session is revoked.
+// @Tags user
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/user/password/reset [post]
+func (c *Controller) resetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	err := c.service.resetPassword(ctx, req.Token, req.NewPassword)
+	if errors.Is(err, ErrInvalidToken) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "could not reset password"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary Verify email address
+// @Description Marks the email address as verified using the token from the verification email
+// @Tags user
+// @Param request body VerifyEmailRequest true "Verification token"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/user/email/verify [post]
+func (c *Controller) verifyEmail(ctx *gin.Context) {
+	var req VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	err := c.service.verifyEmail(ctx, req.Token)
+	if errors.Is(err, ErrInvalidToken) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "could not verify email"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary Resend verification email
+// @Description Sends a new verification token to the caller's email address; earlier tokens stop working
+// @Tags user
+// @Security JWT
+// @Success 202
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/user/me/email/verification [post]
+func (c *Controller) resendVerification(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	err = c.service.resendVerification(ctx, subject.UserID)
+	switch {
+	case errors.Is(err, ErrEmailAlreadyVerified):
+		ctx.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrUserNotFound):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "could not send verification email"})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
 func NewController(service *Service) *Controller {
 	return &Controller{
 		service: service,
 	}
 }
+
+// profileSnapshot is the part of a user recorded in the audit log when their profile changes
+func profileSnapshot(user *models.User) gin.H {
+	if user == nil {
+		return nil
+	}
+	return gin.H{"full_name": user.FullName, "email": user.Email, "email_verified": user.EmailVerifiedAt != nil}
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/mailer"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Password reset token expiry
+	PasswordResetExpire = 30 * time.Minute
+	// Email verification token expiry
+	EmailVerificationExpire = 24 * time.Hour
+
+	mailTokenBytes = 32
+)
+
+// Errors
+var (
+	ErrInvalidPassword      = errors.New("current password is incorrect")
+	ErrInvalidToken         = errors.New("token is invalid or has expired")
+	ErrEmailNotVerified     = errors.New("email address has not been verified")
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// newMailToken returns a random token for a link or code sent by email, and its hash
+func newMailToken() (string, string, error) {
+	b := make([]byte, mailTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashMailToken(token), nil
+}
+
+func hashMailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireEmailVerification reports whether login is refused until the email is verified
+func requireEmailVerification() bool {
+	return os.Getenv(common.RequireEmailVerification) == "true"
+}
+
+// changePassword replaces the password of a logged-in user after checking the current one.
+// Every session of the user is revoked with it, so all devices have to log in again.
+func (s *Service) changePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
+	user, err := s.FindOneByID(userID.String())
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := auth.CheckPassword(currentPassword, user.Password); err != nil {
+		return ErrInvalidPassword
+	}
+	hashed, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	err = s.repo.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, user.ID, hashed); err != nil {
+			return err
+		}
+		return s.sessions.WithTx(tx).RevokeUser(ctx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	// The password has changed either way; a lost notification must not report a failure
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "The password of your account was just changed. If this was not you, reset your password immediately.",
+	})
+	if err != nil {
+		log.Printf("Error sending password change email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// requestPasswordReset mails a reset token to the owner of email. Unknown addresses are
+// silently ignored so that the endpoint does not reveal which emails are registered.
+func (s *Service) requestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.getByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, hash, err := newMailToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.createToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(PasswordResetExpire),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this token to reset your password within %.0f minutes:\n\n%s\n\n"+
+			"If you did not ask for a reset, you can ignore this email.", PasswordResetExpire.Minutes(), token),
+	})
+}
+
+// resetPassword redeems a reset token and sets a new password. Every session of the user
+// is revoked in the same transaction.
+func (s *Service) resetPassword(ctx context.Context, token, newPassword string) error {
+	hashed, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.repo.consumeToken(ctx, models.TokenPurposePasswordReset, hashMailToken(token), func(tx *gorm.DB, t *models.UserToken) error {
+		if err := setPassword(tx, t.UserID, hashed); err != nil {
+			return err
+		}
+		return s.sessions.WithTx(tx).RevokeUser(ctx, t.UserID)
+	})
+}
+
+// sendVerification mails a token that proves ownership of the user's current email
+func (s *Service) sendVerification(ctx context.Context, user *models.User) error {
+	token, hash, err := newMailToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.createToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(EmailVerificationExpire),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Use this token to verify your email address within %.0f hours:\n\n%s", EmailVerificationExpire.Hours(), token),
+	})
+}
+
+// resendVerification sends a fresh verification token to a user whose email is unverified
+func (s *Service) resendVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.FindOneByID(userID.String())
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// verifyEmail redeems a verification token. A token sent to an address the user has since
+// changed away from is rejected.
+func (s *Service) verifyEmail(ctx context.Context, token string) error {
+	return s.repo.consumeToken(ctx, models.TokenPurposeEmailVerification, hashMailToken(token), func(tx *gorm.DB, t *models.UserToken) error {
+		result := tx.Model(&model{}).
+			Where("id = ? AND email = ?", t.UserID, t.Email).
+			Update("email_verified_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+// mailedToken extracts the token from the last email sent to addr
+func mailedToken(t *testing.T, service *Service, addr string) string {
+	msg, ok := service.mailer.(*mailer.MemorySender).Last(addr)
+	assert.True(t, ok, "no mail sent to %s", addr)
+	lines := strings.Split(strings.TrimSpace(msg.Body), "\n\n")
+	assert.GreaterOrEqual(t, len(lines), 2)
+	return strings.TrimSpace(lines[1])
+}
+
+func createCredentialsUser(t *testing.T, service *Service) *models.User {
+	user, err := service.createUser(&CreateUserRequest{
+		Username: "creds",
+		Password: "oldpassword",
+		FullName: "Creds User",
+		Email:    "creds@example.com",
+	})
+	assert.NoError(t, err)
+	return user
+}
+
+func TestChangePassword(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+	tokens, err := service.issueTokens(context.Background(), user, "test", "127.0.0.1")
+	assert.NoError(t, err)
+
+	err = service.changePassword(context.Background(), user.ID, "wrong", "newpassword")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	assert.NoError(t, service.changePassword(context.Background(), user.ID, "oldpassword", "newpassword"))
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	_, err = service.loginUser(context.Background(), "creds", "newpassword", "127.0.0.1")
+	assert.NoError(t, err)
+
+	// Existing sessions are revoked
+	_, err = service.refreshTokens(context.Background(), tokens.RefreshToken, "test", "127.0.0.1")
+	assert.Error(t, err)
+}
+
+// failingSender is a mailer whose every send fails
+type failingSender struct{}
+
+func (failingSender) Send(context.Context, mailer.Message) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestChangePassword_MailFailureStillSucceeds(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+	service.mailer = failingSender{}
+
+	assert.NoError(t, service.changePassword(context.Background(), user.ID, "oldpassword", "newpassword"))
+	_, err := service.loginUser(context.Background(), "creds", "newpassword", "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestPasswordReset(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+
+	// Unknown addresses are accepted without sending anything
+	assert.NoError(t, service.requestPasswordReset(context.Background(), "nobody@example.com"))
+	_, sent := service.mailer.(*mailer.MemorySender).Last("nobody@example.com")
+	assert.False(t, sent)
+
+	assert.NoError(t, service.requestPasswordReset(context.Background(), user.Email))
+	first := mailedToken(t, service, user.Email)
+	assert.NoError(t, service.requestPasswordReset(context.Background(), user.Email))
+	second := mailedToken(t, service, user.Email)
+
+	// Only the latest token works, and only once
+	assert.ErrorIs(t, service.resetPassword(context.Background(), first, "resetpassword"), ErrInvalidToken)
+	assert.NoError(t, service.resetPassword(context.Background(), second, "resetpassword"))
+	assert.ErrorIs(t, service.resetPassword(context.Background(), second, "again1234"), ErrInvalidToken)
+
+	_, err := service.loginUser(context.Background(), "creds", "resetpassword", "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestEmailVerification(t *testing.T) {
+	service := setupTestService(t)
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+	user := createCredentialsUser(t, service)
+	token := mailedToken(t, service, user.Email)
+
+	_, err := service.loginUser(context.Background(), "creds", "oldpassword", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	assert.ErrorIs(t, service.verifyEmail(context.Background(), "bogus"), ErrInvalidToken)
+	assert.NoError(t, service.verifyEmail(context.Background(), token))
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, service.resendVerification(context.Background(), user.ID), ErrEmailAlreadyVerified)
+}
+
+func TestEmailVerification_StaleAddress(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+	oldToken := mailedToken(t, service, user.Email)
+
+	// Changing the email invalidates the token sent to the old address
+	email := "creds-new@example.com"
+	_, err := service.updateProfile(context.Background(), user.ID.String(), subjectOf(user), UpdateUserRequest{Email: &email})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, service.verifyEmail(context.Background(), oldToken), ErrInvalidToken)
+
+	assert.NoError(t, service.verifyEmail(context.Background(), mailedToken(t, service, email)))
+	verified, err := service.FindOneByID(user.ID.String())
+	assert.NoError(t, err)
+	assert.NotNil(t, verified.EmailVerifiedAt)
+}
+
+func subjectOf(user *models.User) authz.Subject {
+	return authz.Subject{UserID: user.ID, Role: user.Role}
+}
@@ -17,6 +17,16 @@ type CreateUserRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+// UpdateUserRequest represents the request body for updating a user's own profile.
+// Only the fields listed here can be changed; omitted fields are left as they are.
+// @Description Request payload for updating a user profile.
+type UpdateUserRequest struct {
+	// New full name of the user
+	FullName *string `json:"full_name" binding:"omitempty,min=1"`
+	// New email address. Must be unique; changing it clears the verification status.
+	Email *string `json:"email" binding:"omitempty,email"`
+}
+
 // LoginUserRequest represents the request body for user login.
 // @Description Request payload for logging in a user.
 type LoginUserRequest struct {
@@ -32,6 +42,15 @@ type LoginUserResponse struct {
 	// Access token for the user
 	// required: true
 	AccessToken string `json:"access_token"`
+	// Expiry of the access token
+	// required: true
+	AccessTokenExpiresAt string `json:"access_token_expires_at"`
+	// Opaque refresh token; exchange it at /users/token/refresh
+	// required: true
+	RefreshToken string `json:"refresh_token"`
+	// Expiry of the refresh token
+	// required: true
+	RefreshTokenExpiresAt string `json:"refresh_token_expires_at"`
 	// User information
 	// required: true
 	User struct {
@@ -49,3 +68,78 @@ type LoginUserResponse struct {
 		Email string `json:"email"`
 	} `json:"user"`
 }
+
+// MFAChallengeResponse is returned by login instead of tokens when the user has two-factor
+// authentication enabled.
+type MFAChallengeResponse struct {
+	// Always true
+	MFARequired bool `json:"mfa_required"`
+	// Short-lived token to send with the code to /users/login/mfa
+	MFAToken string `json:"mfa_token"`
+	// Expiry of the challenge token
+	MFATokenExpiresAt string `json:"mfa_token_expires_at"`
+}
+
+// LoginMFARequest represents the request body for completing a two-factor login.
+type LoginMFARequest struct {
+	// Token from the login response
+	// required: true
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// TOTP code from the authenticator app, or a recovery code
+	// required: true
+	Code string `json:"code" binding:"required"`
+}
+
+// RefreshTokenRequest represents the request body for rotating a refresh token.
+// @Description Request payload for exchanging a refresh token.
+type RefreshTokenRequest struct {
+	// Refresh token from login or a previous refresh
+	// required: true
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenPairResponse holds a new access token and its rotated refresh token.
+type TokenPairResponse struct {
+	// Access token for the user
+	AccessToken string `json:"access_token"`
+	// Expiry of the access token
+	AccessTokenExpiresAt string `json:"access_token_expires_at"`
+	// Rotated refresh token; the previous one can no longer be used
+	RefreshToken string `json:"refresh_token"`
+	// Expiry of the refresh token
+	RefreshTokenExpiresAt string `json:"refresh_token_expires_at"`
+}
+
+// ChangePasswordRequest represents the request body for changing the caller's password.
+type ChangePasswordRequest struct {
+	// Current password of the user
+	// required: true
+	CurrentPassword string `json:"current_password" binding:"required"`
+	// New password. Minimum 6 characters.
+	// required: true
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// ForgotPasswordRequest represents the request body for asking for a password reset email.
+type ForgotPasswordRequest struct {
+	// Email address of the account
+	// required: true
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password with a reset token.
+type ResetPasswordRequest struct {
+	// Token from the password reset email
+	// required: true
+	Token string `json:"token" binding:"required"`
+	// New password. Minimum 6 characters.
+	// required: true
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// VerifyEmailRequest represents the request body for verifying an email address.
+type VerifyEmailRequest struct {
+	// Token from the verification email
+	// required: true
+	Token string `json:"token" binding:"required"`
+}
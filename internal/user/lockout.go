@@ -0,0 +1,111 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+)
+
+// Failed logins are counted per username and per client IP. The IP limits are looser since
+// many users can share an address.
+var (
+	usernameLoginPolicy = ratelimit.Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	ipLoginPolicy = ratelimit.Policy{
+		FreeFailures:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    100,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+)
+
+// dummyPasswordHash is checked against for unknown usernames, so that they take as long to
+// reject as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not a real password")
+	if err != nil {
+		log.Printf("Error hashing dummy password: %v", err)
+	}
+	return hash
+})
+
+// loginBlocked reports whether the username or the client IP is in a backoff or lockout
+func (s *Service) loginBlocked(ctx context.Context, username, clientIP string, now time.Time) (bool, error) {
+	for _, key := range []string{ratelimit.LoginUsernameKey(username), ratelimit.LoginIPKey(clientIP)} {
+		counter, err := s.attempts.Get(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if counter.Blocked(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordLoginFailure counts a failed login against the username and the client IP, and
+// records a lockout event when either gets locked. Unknown usernames are counted too, so a
+// lockout says nothing about whether an account exists.
+func (s *Service) recordLoginFailure(ctx context.Context, username, clientIP string, now time.Time) {
+	counters := []struct {
+		key          string
+		policy       ratelimit.Policy
+		resourceType string
+		resourceID   string
+	}{
+		{ratelimit.LoginUsernameKey(username), usernameLoginPolicy, "username", username},
+		{ratelimit.LoginIPKey(clientIP), ipLoginPolicy, "ip", clientIP},
+	}
+	for _, c := range counters {
+		counter, err := s.attempts.RecordFailure(ctx, c.key, c.policy, now)
+		if err != nil {
+			log.Printf("Error counting failed login for %s: %v", c.key, err)
+			continue
+		}
+		if !counter.Locked {
+			continue
+		}
+		err = s.audit.Record(ctx, &models.AuditLog{
+			Action:       "auth.login.lockout",
+			ResourceType: c.resourceType,
+			ResourceID:   c.resourceID,
+			Details:      lockoutDetails(counter),
+			ClientIP:     clientIP,
+			RequestID:    audit.RequestIDFrom(ctx),
+		})
+		if err != nil {
+			log.Printf("Error recording lockout of %s: %v", c.key, err)
+		}
+	}
+}
+
+// resetLoginFailures clears the counter of a username after a successful login. The IP
+// counter is kept, so that one valid account cannot be used to reset it.
+func (s *Service) resetLoginFailures(ctx context.Context, username string) {
+	if err := s.attempts.Reset(ctx, ratelimit.LoginUsernameKey(username)); err != nil {
+		log.Printf("Error resetting failed logins of %s: %v", username, err)
+	}
+}
+
+func lockoutDetails(counter ratelimit.Counter) string {
+	details, _ := json.Marshal(map[string]any{
+		"failures":     counter.Failures,
+		"locked_until": counter.BlockedUntil.Format(time.RFC3339),
+	})
+	return string(details)
+}
@@ -0,0 +1,138 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// withLoginPolicies replaces the login policies for the duration of a test
+func withLoginPolicies(t *testing.T, username, ip ratelimit.Policy) {
+	oldUsername, oldIP := usernameLoginPolicy, ipLoginPolicy
+	usernameLoginPolicy, ipLoginPolicy = username, ip
+	t.Cleanup(func() {
+		usernameLoginPolicy, ipLoginPolicy = oldUsername, oldIP
+	})
+}
+
+func TestLogin_Backoff(t *testing.T) {
+	service := setupTestService(t)
+	createCredentialsUser(t, service)
+	withLoginPolicies(t, ratelimit.Policy{FreeFailures: 1, BaseDelay: time.Hour, Window: time.Hour}, ipLoginPolicy)
+
+	_, err := service.loginUser(context.Background(), "creds", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	_, err = service.loginUser(context.Background(), "creds", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+
+	// The right password is refused the same way while the backoff lasts, from any address
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.2")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+
+	// Unknown usernames are throttled alike
+	for i := 0; i < 3; i++ {
+		_, err = service.loginUser(context.Background(), "ghost", "wrong", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	}
+	counter, err := service.attempts.Get(context.Background(), ratelimit.LoginUsernameKey("ghost"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, counter.Failures)
+}
+
+func TestLogin_IPBackoff(t *testing.T) {
+	service := setupTestService(t)
+	createCredentialsUser(t, service)
+	withLoginPolicies(t, usernameLoginPolicy, ratelimit.Policy{FreeFailures: 1, BaseDelay: time.Hour, Window: time.Hour})
+
+	// Failures spread over usernames still add up per address
+	_, err := service.loginUser(context.Background(), "alice", "wrong", "10.0.0.9")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	_, err = service.loginUser(context.Background(), "bob", "wrong", "10.0.0.9")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.9")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.10")
+	assert.NoError(t, err)
+}
+
+func TestLogin_Lockout(t *testing.T) {
+	service := setupTestService(t)
+	createCredentialsUser(t, service)
+	withLoginPolicies(t, ratelimit.Policy{FreeFailures: 10, LockoutAfter: 2, LockoutDuration: time.Hour, Window: time.Hour}, ipLoginPolicy)
+
+	for i := 0; i < 2; i++ {
+		_, err := service.loginUser(context.Background(), "creds", "wrong", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	}
+	_, err := service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+
+	var events []models.AuditLog
+	assert.NoError(t, service.repo.Repository.DB.Where("action = ?", "auth.login.lockout").Find(&events).Error)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "username", events[0].ResourceType)
+	assert.Equal(t, "creds", events[0].ResourceID)
+
+	// An admin unlock resets the counter
+	assert.NoError(t, service.attempts.Reset(context.Background(), ratelimit.LoginUsernameKey("creds")))
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestLogin_SuccessResetsUsernameCounter(t *testing.T) {
+	service := setupTestService(t)
+	createCredentialsUser(t, service)
+
+	_, err := service.loginUser(context.Background(), "creds", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+	_, err = service.loginUser(context.Background(), "creds", "oldpassword", "10.0.0.1")
+	assert.NoError(t, err)
+
+	counter, err := service.attempts.Get(context.Background(), ratelimit.LoginUsernameKey("creds"))
+	assert.NoError(t, err)
+	assert.Zero(t, counter.Failures)
+	counter, err = service.attempts.Get(context.Background(), ratelimit.LoginIPKey("10.0.0.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counter.Failures)
+}
+
+func TestLogin_IPLockoutIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := setupTestService(t)
+	createCredentialsUser(t, service)
+	withLoginPolicies(t, usernameLoginPolicy, ratelimit.Policy{FreeFailures: 10, LockoutAfter: 3, LockoutDuration: time.Hour, Window: time.Hour})
+
+	// The engine is set up like main's, trusting no proxy
+	router := gin.New()
+	assert.NoError(t, ratelimit.TrustProxies(router, ""))
+	router.POST("/login", NewController(service).login)
+	login := func(username, password, forwardedFor string) int {
+		body := `{"username":"` + username + `","password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "203.0.113.7:4321"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A fresh X-Forwarded-For on every attempt still counts against the connecting address
+	for i, username := range []string{"alice", "bob", "carol"} {
+		assert.Equal(t, http.StatusBadRequest, login(username, "wrong", "198.51.100."+strconv.Itoa(i+1)))
+	}
+	assert.Equal(t, http.StatusBadRequest, login("creds", "oldpassword", "198.51.100.99"))
+	counter, err := service.attempts.Get(context.Background(), ratelimit.LoginIPKey("203.0.113.7"))
+	assert.NoError(t, err)
+	assert.True(t, counter.Locked)
+}
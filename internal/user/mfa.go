@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MFA challenge token expiry; the second factor has to be entered within it
+	MFAChallengeExpire = 5 * time.Minute
+	// Wrong codes tolerated per challenge before the user has to log in again
+	MFAChallengeMaxAttempts = 5
+)
+
+// startMFAChallenge returns a short-lived token that stands in for the checked password while
+// the user enters their second factor
+func (s *Service) startMFAChallenge(ctx context.Context, user *models.User) (string, time.Time, error) {
+	token, hash, err := newMailToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(MFAChallengeExpire)
+	err = s.repo.createToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeMFAChallenge,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// completeMFAChallenge redeems a challenge token with a TOTP or recovery code and returns the
+// user to issue tokens for. A wrong code leaves the challenge usable until it runs out of
+// attempts.
+func (s *Service) completeMFAChallenge(ctx context.Context, token, code string) (*models.User, error) {
+	hash := hashMailToken(token)
+	var userID uuid.UUID
+	err := s.repo.consumeToken(ctx, models.TokenPurposeMFAChallenge, hash, func(tx *gorm.DB, t *models.UserToken) error {
+		userID = t.UserID
+		return s.mfa.Verify(ctx, t.UserID, code)
+	})
+	if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrCodeReused) {
+		if ferr := s.repo.recordFailedAttempt(ctx, models.TokenPurposeMFAChallenge, hash, MFAChallengeMaxAttempts); ferr != nil {
+			return nil, ferr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.FindOneByID(userID.String())
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFAChallenge(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+
+	enrolment, err := service.mfa.Enroll(context.Background(), user.ID)
+	assert.NoError(t, err)
+	code, err := auth.TOTPCode(enrolment.Secret, time.Now())
+	assert.NoError(t, err)
+	recoveryCodes, err := service.mfa.Confirm(context.Background(), user.ID, code)
+	assert.NoError(t, err)
+
+	user, err = service.loginUser(context.Background(), "creds", "oldpassword", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, mfa.Enabled(user))
+
+	token, expiresAt, err := service.startMFAChallenge(context.Background(), user)
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	// A wrong code keeps the challenge open
+	_, err = service.completeMFAChallenge(context.Background(), token, "000000")
+	assert.ErrorIs(t, err, mfa.ErrInvalidCode)
+
+	loggedIn, err := service.completeMFAChallenge(context.Background(), token, recoveryCodes[0])
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+
+	// The challenge is single-use
+	_, err = service.completeMFAChallenge(context.Background(), token, recoveryCodes[1])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestMFAChallenge_MaxAttempts(t *testing.T) {
+	service := setupTestService(t)
+	user := createCredentialsUser(t, service)
+
+	enrolment, err := service.mfa.Enroll(context.Background(), user.ID)
+	assert.NoError(t, err)
+	code, err := auth.TOTPCode(enrolment.Secret, time.Now())
+	assert.NoError(t, err)
+	recoveryCodes, err := service.mfa.Confirm(context.Background(), user.ID, code)
+	assert.NoError(t, err)
+
+	token, _, err := service.startMFAChallenge(context.Background(), user)
+	assert.NoError(t, err)
+	for i := 0; i < MFAChallengeMaxAttempts; i++ {
+		_, err = service.completeMFAChallenge(context.Background(), token, "000000")
+		assert.ErrorIs(t, err, mfa.ErrInvalidCode)
+	}
+
+	// Even a valid code no longer works; the user has to log in again
+	_, err = service.completeMFAChallenge(context.Background(), token, recoveryCodes[0])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -1,9 +1,17 @@
 package user
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type model = models.User
@@ -21,6 +29,20 @@ func InitRepository() *Repository {
 	}
 }
 
+// create inserts a user together with its UserRegistered event
+func (r *Repository) create(ctx context.Context, user *model) error {
+	return r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return events.Record(tx, events.UserRegistered, events.AggregateUser, user.ID, events.UserRegisteredData{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+		})
+	})
+}
+
 func (r *Repository) usernameExists(username string) (bool, error) {
 	var count int64
 	err := r.Repository.DB.Model(&model{}).Where("username = ?", username).Count(&count).Error
@@ -47,3 +69,82 @@ func (r *Repository) getByUsername(username string) (*model, error) {
 	}
 	return &user, nil
 }
+
+// updateProfile writes the given columns of a user and returns the updated row
+func (r *Repository) updateProfile(ctx context.Context, userID uuid.UUID, columns map[string]interface{}) (*model, error) {
+	var user model
+	err := r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model{}).Where("id = ?", userID).Updates(columns).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", userID).First(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *Repository) getByEmail(email string) (*model, error) {
+	var user model
+	err := r.Repository.DB.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createToken stores a mailed token, retiring any unused token of the same purpose so only
+// the latest one works
+func (r *Repository) createToken(ctx context.Context, token *models.UserToken) error {
+	return r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// consumeToken marks an unused, unexpired token as used and runs apply in the same
+// transaction, so a token can only ever be redeemed once
+func (r *Repository) consumeToken(ctx context.Context, purpose, tokenHash string, apply func(tx *gorm.DB, token *models.UserToken) error) error {
+	return r.Repository.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var token models.UserToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND purpose = ?", tokenHash, purpose).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if token.UsedAt != nil || now.After(token.ExpiresAt) {
+			return ErrInvalidToken
+		}
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return apply(tx, &token)
+	})
+}
+
+// recordFailedAttempt counts a failed redemption of an unused token, retiring it once
+// maxAttempts is reached so that its second factor cannot be guessed
+func (r *Repository) recordFailedAttempt(ctx context.Context, purpose, tokenHash string, maxAttempts int) error {
+	return r.Repository.DB.WithContext(ctx).Model(&models.UserToken{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL", tokenHash, purpose).
+		Updates(map[string]interface{}{
+			"attempts": gorm.Expr("attempts + 1"),
+			"used_at":  gorm.Expr("CASE WHEN attempts + 1 >= ? THEN ? ELSE NULL END", maxAttempts, time.Now()),
+		}).Error
+}
+
+// setPassword stores a new password hash for a user
+func setPassword(tx *gorm.DB, userID uuid.UUID, hashedPassword string) error {
+	return tx.Model(&model{}).Where("id = ?", userID).Update("password", hashedPassword).Error
+}
@@ -1,7 +1,9 @@
 package user
 
 import (
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
@@ -9,8 +11,21 @@ func RegisterRoutes(routerGroup *gin.RouterGroup) {
 	service := InitService()
 	controller := NewController(service)
 
-	routerGroup.GET(":id", controller.findOne)
-	routerGroup.POST("", controller.create)
-	routerGroup.PATCH(":id", auth.UserMiddleware(), controller.update)
-	routerGroup.POST("/login", controller.login)
+	// Anonymous endpoints that check credentials or tokens are limited per client IP
+	signupLimit := ratelimit.Middleware(ratelimit.GroupSignup)
+	authLimit := ratelimit.Middleware(ratelimit.GroupAuth)
+
+	routerGroup.GET(":id", auth.UserMiddleware(), controller.findOne)
+	routerGroup.POST("", signupLimit, controller.create)
+	routerGroup.PATCH(":id", auth.UserMiddleware(), audit.Action("user.profile.update", "user"), controller.update)
+	// Logins are audited whether they succeed or not
+	routerGroup.POST("/login", authLimit, audit.Action("auth.login", "user"), controller.login)
+	routerGroup.POST("/login/mfa", authLimit, audit.Action("auth.login.mfa", "user"), controller.loginMFA)
+	routerGroup.POST("/token/refresh", authLimit, controller.refreshToken)
+	routerGroup.POST("/logout", auth.UserMiddleware(), audit.Action("auth.logout", "user"), controller.logout)
+	routerGroup.POST("/me/password", auth.UserMiddleware(), audit.Action("user.password.change", "user"), controller.changePassword)
+	routerGroup.POST("/me/email/verification", auth.UserMiddleware(), authLimit, controller.resendVerification)
+	routerGroup.POST("/password/forgot", authLimit, controller.forgotPassword)
+	routerGroup.POST("/password/reset", authLimit, audit.Action("user.password.reset", "user"), controller.resetPassword)
+	routerGroup.POST("/email/verify", authLimit, controller.verifyEmail)
 }
@@ -1,12 +1,21 @@
 package user
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mailer"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/google/uuid"
 )
 
 // Errors
@@ -14,27 +23,132 @@ var (
 	ErrUsernameExists            = errors.New("username already exists")
 	ErrEmailExists               = errors.New("email already exists")
 	ErrInvalidUsernameOrPassword = errors.New("invalid username or password")
+	ErrUserNotFound              = errors.New("user not found")
+	ErrNotProfileOwner           = errors.New("you can only update your own profile")
+	ErrNothingToUpdate           = errors.New("no fields to update")
 )
 
 type Service struct {
 	crud.Service[model]
-	repo *Repository
+	repo     *Repository
+	sessions *auth.SessionRepository
+	mailer   mailer.Sender
+	mfa      *mfa.Service
+	// attempts counts failed logins per username and client IP
+	attempts ratelimit.Store
+	audit    *audit.Repository
 }
 
 func NewService(repository *Repository) *Service {
 	return &Service{
-		Service: *crud.NewService(repository),
-		repo:    repository,
+		Service:  *crud.NewService(repository),
+		repo:     repository,
+		sessions: auth.InitSessionRepository(),
+		mailer:   mailer.InitSender(),
+		mfa:      mfa.InitService(),
+		attempts: defaultAttemptStore(),
+		audit:    audit.InitRepository(),
 	}
 }
 
 func InitService() *Service {
 	return &Service{
-		repo:    InitRepository(),
-		Service: *crud.NewService(InitRepository()),
+		repo:     InitRepository(),
+		Service:  *crud.NewService(InitRepository()),
+		sessions: auth.InitSessionRepository(),
+		mailer:   mailer.InitSender(),
+		mfa:      mfa.InitService(),
+		attempts: defaultAttemptStore(),
+		audit:    audit.InitRepository(),
 	}
 }
 
+func defaultAttemptStore() ratelimit.Store {
+	store, err := ratelimit.DefaultStore()
+	if err != nil {
+		log.Fatalf("Error creating rate limit store: %v", err)
+	}
+	return store
+}
+
+// tokenPair is an access token and the refresh token of its session
+type tokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// newSession mints an access token and a refresh token for userID, returning the session to store
+func newSession(userID uuid.UUID, role, userAgent, clientIP string) (*models.Session, *tokenPair, error) {
+	tokenMaker, err := auth.DefaultTokenMaker()
+	if err != nil {
+		return nil, nil, err
+	}
+	accessToken, payload, err := tokenMaker.CreateToken(userID.String(), role, AccessTokenExpire)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, refreshHash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:            uuid.New(),
+		FamilyID:      uuid.New(),
+		UserID:        userID,
+		TokenHash:     refreshHash,
+		AccessTokenID: payload.TokenID(),
+		UserAgent:     userAgent,
+		ClientIP:      clientIP,
+		ExpiresAt:     now.Add(RefreshTokenExpire),
+	}
+	pair := &tokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  now.Add(AccessTokenExpire),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}
+	return session, pair, nil
+}
+
+// issueTokens starts a new session family for a user who just logged in
+func (s *Service) issueTokens(ctx context.Context, user *models.User, userAgent, clientIP string) (*tokenPair, error) {
+	session, pair, err := newSession(user.ID, user.Role, userAgent, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// refreshTokens rotates a refresh token, returning a new access and refresh token
+func (s *Service) refreshTokens(ctx context.Context, refreshToken, userAgent, clientIP string) (*tokenPair, error) {
+	var pair *tokenPair
+	err := s.sessions.Rotate(ctx, refreshToken, func(userID uuid.UUID) (*models.Session, error) {
+		// Reload the role so that role changes take effect at the next refresh
+		user, err := s.FindOneByID(userID.String())
+		if err != nil {
+			return nil, err
+		}
+		session, p, err := newSession(userID, user.Role, userAgent, clientIP)
+		pair = p
+		return session, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// logout revokes the session of the given access token
+func (s *Service) logout(ctx context.Context, accessTokenID string) error {
+	return s.sessions.RevokeByAccessTokenID(ctx, accessTokenID)
+}
+
 func (s *Service) createUser(req *CreateUserRequest) (*models.User, error) {
 	exists, err := s.repo.usernameExists(req.Username)
 	if err != nil {
@@ -64,22 +178,44 @@ func (s *Service) createUser(req *CreateUserRequest) (*models.User, error) {
 		FullName: req.FullName,
 		Email:    req.Email,
 	}
-	err = s.Service.Create(userModel)
+	err = s.repo.create(context.Background(), userModel)
 	if err != nil {
 		return nil, err
 	}
+	// The account exists either way; the user can ask for another email
+	if err := s.sendVerification(context.Background(), userModel); err != nil {
+		log.Printf("Error sending verification email to user %s: %v", userModel.ID, err)
+	}
 
 	return userModel, nil
 }
 
-func (s *Service) loginUser(username, password string) (*models.User, error) {
+// loginUser checks a username and password. Repeated failures from a username or client IP
+// are answered with the same error, without checking the password, until their backoff or
+// lockout ends.
+func (s *Service) loginUser(ctx context.Context, username, password, clientIP string) (*models.User, error) {
+	now := time.Now()
+	blocked, err := s.loginBlocked(ctx, username, clientIP, now)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrInvalidUsernameOrPassword
+	}
 	user, err := s.repo.getByUsername(username)
 	if err != nil {
+		_ = auth.CheckPassword(password, dummyPasswordHash())
+		s.recordLoginFailure(ctx, username, clientIP, now)
 		return nil, ErrInvalidUsernameOrPassword
 	}
 	if err := auth.CheckPassword(password, user.Password); err != nil {
+		s.recordLoginFailure(ctx, username, clientIP, now)
 		return nil, ErrInvalidUsernameOrPassword
 	}
+	s.resetLoginFailures(ctx, username)
+	if requireEmailVerification() && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
 	return user, nil
 }
 
@@ -94,3 +230,64 @@ func (s *Service) FindOneByID(id string) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+// findVisible loads a user that subject may view. Users hidden from the subject are
+// reported as not found.
+func (s *Service) findVisible(id string, subject authz.Subject) (*models.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUserNotFound
+	}
+	user, err := s.FindOneByID(id)
+	if err != nil || !authz.CanView(subject, user) {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// updateProfile applies a self-service profile update. Only admins may update another
+// user's profile. A new email must be unique and has to be verified again.
+func (s *Service) updateProfile(ctx context.Context, id string, subject authz.Subject, req UpdateUserRequest) (*models.User, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if userID != subject.UserID && subject.Role != models.RoleAdmin {
+		return nil, ErrNotProfileOwner
+	}
+	user, err := s.FindOneByID(userID.String())
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	columns := map[string]interface{}{}
+	if req.FullName != nil && *req.FullName != user.FullName {
+		columns["full_name"] = *req.FullName
+	}
+	if req.Email != nil && *req.Email != user.Email {
+		exists, err := s.repo.emailExists(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrEmailExists
+		}
+		columns["email"] = *req.Email
+		columns["email_verified_at"] = nil
+	}
+	if len(columns) == 0 {
+		if req.FullName == nil && req.Email == nil {
+			return nil, ErrNothingToUpdate
+		}
+		return user, nil
+	}
+	updated, err := s.repo.updateProfile(ctx, userID, columns)
+	if err != nil {
+		return nil, err
+	}
+	if _, changed := columns["email"]; changed {
+		if err := s.sendVerification(ctx, updated); err != nil {
+			log.Printf("Error sending verification email to user %s: %v", updated.ID, err)
+		}
+	}
+	return updated, nil
+}
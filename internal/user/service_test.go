@@ -1,14 +1,19 @@
 package user
 
 import (
+	"context"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ElegantSoft/go-restful-generator/crud"
 	"github.com/ahmedkhaeld/banking-app/db"
 	"github.com/ahmedkhaeld/banking-app/db/models"
 	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/ahmedkhaeld/banking-app/internal/mailer"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +23,10 @@ import (
 func setupTestRepository(t *testing.T) *Repository {
 	repo := InitRepository()
 	t.Cleanup(func() {
+		repo.Repository.DB.Exec("DELETE FROM sessions")
+		repo.Repository.DB.Exec("DELETE FROM user_tokens")
+		repo.Repository.DB.Exec("DELETE FROM recovery_codes")
+		repo.Repository.DB.Exec("DELETE FROM audit_logs")
 		repo.Repository.DB.Exec("DELETE FROM users")
 	})
 	return repo
@@ -25,7 +34,10 @@ func setupTestRepository(t *testing.T) *Repository {
 
 func setupTestService(t *testing.T) *Service {
 	repo := setupTestRepository(t)
-	return NewService(repo)
+	service := NewService(repo)
+	service.mailer = mailer.NewMemorySender()
+	service.attempts = ratelimit.NewMemoryStore()
+	return service
 }
 
 func TestMain(m *testing.M) {
@@ -46,7 +58,7 @@ func TestMain(m *testing.M) {
 	}
 
 	// Run migrations
-	if err := db.DB.AutoMigrate(&models.User{}); err != nil {
+	if err := db.DB.AutoMigrate(&models.User{}, &models.Session{}, &models.UserToken{}, &models.RecoveryCode{}, &models.AuditLog{}, &models.OutboxEvent{}); err != nil {
 		panic("failed to run migrations: " + err.Error())
 	}
 
@@ -148,7 +160,7 @@ func TestLoginUser_Success(t *testing.T) {
 	err = repo.Repository.DB.Create(testUser).Error
 	assert.NoError(t, err)
 
-	result, err := service.loginUser("testuser", "password123")
+	result, err := service.loginUser(context.Background(), "testuser", "password123", "127.0.0.1")
 	assert.NoError(t, err)
 	assert.Equal(t, "testuser", result.Username)
 }
@@ -169,7 +181,7 @@ func TestLoginUser_InvalidPassword(t *testing.T) {
 	err = repo.Repository.DB.Create(testUser).Error
 	assert.NoError(t, err)
 
-	result, err := service.loginUser("testuser", "wrongpassword")
+	result, err := service.loginUser(context.Background(), "testuser", "wrongpassword", "127.0.0.1")
 	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
 	assert.Nil(t, result)
 }
@@ -177,7 +189,7 @@ func TestLoginUser_InvalidPassword(t *testing.T) {
 func TestLoginUser_UserNotFound(t *testing.T) {
 	service := setupTestService(t)
 
-	result, err := service.loginUser("nonexistent", "password123")
+	result, err := service.loginUser(context.Background(), "nonexistent", "password123", "127.0.0.1")
 	assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
 	assert.Nil(t, result)
 }
@@ -227,3 +239,127 @@ func TestFindOne_Failure(t *testing.T) {
 	err := service.FindOne(api, &result)
 	assert.Error(t, err)
 }
+
+func TestUpdateProfile(t *testing.T) {
+	service := setupTestService(t)
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Username: "profile", Password: "pass", FullName: "Old Name", Email: "profile@example.com", EmailVerifiedAt: &now}
+	assert.NoError(t, service.Create(user))
+	other := &models.User{ID: uuid.New(), Username: "other", Password: "pass", FullName: "Other", Email: "other@example.com"}
+	assert.NoError(t, service.Create(other))
+	self := authz.Subject{UserID: user.ID, Role: models.RoleCustomer}
+
+	name := "New Name"
+	updated, err := service.updateProfile(context.Background(), user.ID.String(), self, UpdateUserRequest{FullName: &name})
+	assert.NoError(t, err)
+	assert.Equal(t, "New Name", updated.FullName)
+	assert.NotNil(t, updated.EmailVerifiedAt)
+
+	// A new email must be verified again
+	email := "new-profile@example.com"
+	updated, err = service.updateProfile(context.Background(), user.ID.String(), self, UpdateUserRequest{Email: &email})
+	assert.NoError(t, err)
+	assert.Equal(t, email, updated.Email)
+	assert.Nil(t, updated.EmailVerifiedAt)
+	assert.Equal(t, "profile", updated.Username)
+
+	taken := other.Email
+	_, err = service.updateProfile(context.Background(), user.ID.String(), self, UpdateUserRequest{Email: &taken})
+	assert.ErrorIs(t, err, ErrEmailExists)
+
+	_, err = service.updateProfile(context.Background(), other.ID.String(), self, UpdateUserRequest{FullName: &name})
+	assert.ErrorIs(t, err, ErrNotProfileOwner)
+
+	admin := authz.Subject{UserID: uuid.New(), Role: models.RoleAdmin}
+	updated, err = service.updateProfile(context.Background(), other.ID.String(), admin, UpdateUserRequest{FullName: &name})
+	assert.NoError(t, err)
+	assert.Equal(t, name, updated.FullName)
+
+	_, err = service.updateProfile(context.Background(), user.ID.String(), self, UpdateUserRequest{})
+	assert.ErrorIs(t, err, ErrNothingToUpdate)
+}
+
+func TestFindVisible_OwnProfileOnly(t *testing.T) {
+	service := setupTestService(t)
+	user := &models.User{ID: uuid.New(), Username: "visible", Password: "pass", FullName: "Visible", Email: "visible@example.com"}
+	assert.NoError(t, service.Create(user))
+
+	found, err := service.findVisible(user.ID.String(), authz.Subject{UserID: user.ID, Role: models.RoleCustomer})
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	_, err = service.findVisible(user.ID.String(), authz.Subject{UserID: uuid.New(), Role: models.RoleCustomer})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = service.findVisible(user.ID.String(), authz.Subject{UserID: uuid.New(), Role: models.RoleAdmin})
+	assert.NoError(t, err)
+}
+
+func createSessionUser(t *testing.T, service *Service) *models.User {
+	user := &models.User{ID: uuid.New(), Username: "session", Password: "pass", FullName: "Session User", Email: "session@example.com", Role: models.RoleCustomer}
+	assert.NoError(t, service.Create(user))
+	return user
+}
+
+func TestRefreshTokens_Rotation(t *testing.T) {
+	service := setupTestService(t)
+	user := createSessionUser(t, service)
+
+	first, err := service.issueTokens(context.Background(), user, "test", "127.0.0.1")
+	assert.NoError(t, err)
+
+	second, err := service.refreshTokens(context.Background(), first.RefreshToken, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEqual(t, first.AccessToken, second.AccessToken)
+
+	third, err := service.refreshTokens(context.Background(), second.RefreshToken, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.NotNil(t, third)
+}
+
+func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
+	service := setupTestService(t)
+	user := createSessionUser(t, service)
+
+	first, err := service.issueTokens(context.Background(), user, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	second, err := service.refreshTokens(context.Background(), first.RefreshToken, "test", "127.0.0.1")
+	assert.NoError(t, err)
+
+	// Replaying the rotated token kills the whole family, including the latest token
+	_, err = service.refreshTokens(context.Background(), first.RefreshToken, "test", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+	_, err = service.refreshTokens(context.Background(), second.RefreshToken, "test", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+}
+
+func TestRefreshTokens_Invalid(t *testing.T) {
+	service := setupTestService(t)
+	_, err := service.refreshTokens(context.Background(), "not-a-token", "test", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+}
+
+func TestLogout_RevokesAccessToken(t *testing.T) {
+	service := setupTestService(t)
+	user := createSessionUser(t, service)
+	tokens, err := service.issueTokens(context.Background(), user, "test", "127.0.0.1")
+	assert.NoError(t, err)
+
+	tokenMaker, err := auth.DefaultTokenMaker()
+	assert.NoError(t, err)
+	payload, err := tokenMaker.VerifyToken(tokens.AccessToken)
+	assert.NoError(t, err)
+
+	active, err := service.sessions.IsAccessTokenActive(context.Background(), payload.TokenID())
+	assert.NoError(t, err)
+	assert.True(t, active)
+
+	assert.NoError(t, service.logout(context.Background(), payload.TokenID()))
+
+	active, err = service.sessions.IsAccessTokenActive(context.Background(), payload.TokenID())
+	assert.NoError(t, err)
+	assert.False(t, active)
+	_, err = service.refreshTokens(context.Background(), tokens.RefreshToken, "test", "127.0.0.1")
+	assert.Error(t, err)
+}
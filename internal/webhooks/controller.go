@@ -0,0 +1,217 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/authz"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	service *Service
+}
+
+// @Summary Register a webhook endpoint
+// @Description Subscribes a URL to transfer.received, transfer.sent and account.frozen events of the caller's accounts.
+// @Description Every delivery is signed in the X-Signature header as t=<unix time>,v1=<hex HMAC-SHA256 of "t.body">
+// @Description with the secret returned here, which is not shown again.
+// @Tags webhook
+// @Security JWT
+// @Accept json
+// @Produce json
+// @Param request body CreateWebhookRequest true "Endpoint"
+// @Success 201 {object} CreateWebhookResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/webhooks [post]
+func (c *Controller) create(ctx *gin.Context) {
+	var req CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	endpoint, err := c.service.Create(ctx, subject.UserID, req)
+	if err != nil {
+		ctx.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	resp := toResponse(endpoint)
+	audit.SetResourceID(ctx, resp.ID)
+	audit.SetChanges(ctx, nil, resp)
+	ctx.JSON(http.StatusCreated, gin.H{"data": CreateWebhookResponse{WebhookResponse: resp, Secret: endpoint.Secret}})
+}
+
+// @Summary List webhook endpoints
+// @Description Returns the caller's endpoints, newest first.
+// @Tags webhook
+// @Security JWT
+// @Success 200 {array} WebhookResponse
+// @Router /api/v1/webhooks [get]
+func (c *Controller) list(ctx *gin.Context) {
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	list, err := c.service.List(ctx, subject.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	data := make([]WebhookResponse, 0, len(list))
+	for i := range list {
+		data = append(data, toResponse(&list[i]))
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// @Summary Get a webhook endpoint
+// @Description Only its owner can see an endpoint; anyone else gets a 404.
+// @Tags webhook
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Success 200 {object} WebhookResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhooks/{id} [get]
+func (c *Controller) get(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	endpoint, err := c.service.Get(ctx, item.ID, subject.UserID)
+	if err != nil {
+		ctx.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": toResponse(endpoint)})
+}
+
+// @Summary Delete a webhook endpoint
+// @Description Stops deliveries to an endpoint and removes its delivery log.
+// @Tags webhook
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhooks/{id} [delete]
+func (c *Controller) delete(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	audit.SetResourceID(ctx, item.ID)
+	if err := c.service.Delete(ctx, item.ID, subject.UserID); err != nil {
+		ctx.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary List the deliveries of a webhook endpoint
+// @Description Returns the latest 100 deliveries of an endpoint with the outcome of their last attempt, newest first.
+// @Description Dead deliveries failed every attempt and are not retried unless requested.
+// @Tags webhook
+// @Security JWT
+// @param id path string true "uuid of item"
+// @Param status query string false "pending, succeeded or dead"
+// @Success 200 {array} DeliveryResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (c *Controller) deliveries(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var req DeliveriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	list, err := c.service.Deliveries(ctx, item.ID, subject.UserID, req.Status)
+	if err != nil {
+		ctx.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	data := make([]DeliveryResponse, 0, len(list))
+	for i := range list {
+		data = append(data, toDeliveryResponse(&list[i]))
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// @Summary Retry a webhook delivery
+// @Description Sends a pending or dead delivery again right away, with a fresh set of attempts.
+// @Tags webhook
+// @Security JWT
+// @param id path string true "uuid of the endpoint"
+// @param delivery_id path string true "uuid of the delivery"
+// @Success 200 {object} DeliveryResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/webhooks/{id}/deliveries/{delivery_id}/retry [post]
+func (c *Controller) retry(ctx *gin.Context) {
+	var item common.ById
+	if err := ctx.ShouldBindUri(&item); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	subject, err := authz.SubjectFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	deliveryID := ctx.Param("delivery_id")
+	audit.SetResourceID(ctx, item.ID)
+	audit.SetDetails(ctx, gin.H{"delivery_id": deliveryID})
+	delivery, err := c.service.Retry(ctx, item.ID, deliveryID, subject.UserID)
+	if err != nil {
+		ctx.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": toDeliveryResponse(delivery)})
+}
+
+// webhookErrorStatus maps service errors to HTTP status codes
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrDeliveryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAlreadyDelivered):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts is the number of attempts before a delivery is dead
+	MaxAttempts = 10
+	// retryBase is the wait after the first failed attempt; it doubles with every further one
+	retryBase = 30 * time.Second
+	// retryCap bounds the wait between attempts
+	retryCap = 6 * time.Hour
+	// requestTimeout bounds one attempt, including reading the response
+	requestTimeout = 10 * time.Second
+	// maxErrorBody is how much of a failed response is kept in the delivery log
+	maxErrorBody = 256
+)
+
+// retryDelay returns the wait after the given failed attempt
+func retryDelay(attempt int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempt && delay < retryCap; i++ {
+		delay *= 2
+	}
+	return min(delay, retryCap)
+}
+
+// Deliverer sends due deliveries. Each attempt commits in one transaction with the claim of
+// its row, which is taken with SKIP LOCKED, so any number of replicas can run a deliverer.
+// Delivery is at least once: a crash after the receiver answered sends the delivery again.
+type Deliverer struct {
+	repo     *Repository
+	client   *http.Client
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewDeliverer returns a deliverer that sends with client, or when nil with a client that
+// only connects to public addresses and does not follow redirects
+func NewDeliverer(repository *Repository, client *http.Client, interval time.Duration) *Deliverer {
+	if client == nil {
+		client = newDeliveryClient()
+	}
+	return &Deliverer{
+		repo:     repository,
+		client:   client,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// InitDeliverer returns a deliverer that polls every WEBHOOK_DELIVERY_INTERVAL (five seconds
+// by default), or nil when it is set to off
+func InitDeliverer() *Deliverer {
+	interval, err := intervalFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading webhook delivery interval: %v", err)
+	}
+	if interval == 0 {
+		return nil
+	}
+	return NewDeliverer(InitRepository(), nil, interval)
+}
+
+// intervalFromEnv reads WEBHOOK_DELIVERY_INTERVAL, a Go duration such as 1s or "off"
+func intervalFromEnv() (time.Duration, error) {
+	spec := strings.TrimSpace(os.Getenv(common.WebhookDeliveryInterval))
+	switch spec {
+	case "":
+		return 5 * time.Second, nil
+	case "off":
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(spec)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration or off, got %q", common.WebhookDeliveryInterval, spec)
+	}
+	return interval, nil
+}
+
+// Run sends due deliveries every interval until ctx is done
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts every due delivery once and returns how many it attempted
+func (d *Deliverer) DeliverDue(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		attempted, err := d.deliverNext(ctx)
+		if err != nil || !attempted {
+			return count, err
+		}
+		count++
+	}
+}
+
+// deliverNext claims one due delivery and attempts it, reporting whether one was due
+func (d *Deliverer) deliverNext(ctx context.Context) (bool, error) {
+	attempted := false
+	err := d.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := d.now()
+		delivery, err := claimDue(tx, now)
+		if err != nil || delivery == nil {
+			return err
+		}
+		attempted = true
+		statusCode, sendErr := d.send(ctx, delivery, now)
+		settle(delivery, now, statusCode, sendErr)
+		return tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		}).Error
+	})
+	return attempted, err
+}
+
+// send POSTs a delivery to its endpoint, signed at now, and returns the response status
+func (d *Deliverer) send(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "banking-app-webhooks/1")
+	req.Header.Set(DeliveryIDHeader, delivery.ID.String())
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(delivery.Endpoint.Secret, now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return resp.StatusCode, nil
+}
+
+// settle records an attempt made at now. A failed delivery is retried after retryDelay,
+// or becomes dead after MaxAttempts.
+func settle(delivery *models.WebhookDelivery, now time.Time, statusCode int, sendErr error) {
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if sendErr == nil {
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return
+	}
+	delivery.LastError = sendErr.Error()
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.NextAttemptAt = nil
+		return
+	}
+	next := now.Add(retryDelay(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/google/uuid"
+)
+
+// Body is the JSON body of a delivery
+type Body struct {
+	// ID of the delivery, the same on every attempt
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SubscriberName names the dispatcher among the subscribers of the events relay
+const SubscriberName = "webhooks"
+
+// Dispatcher subscribes to the domain events of the outbox and queues a delivery for every
+// endpoint of the users they concern. It implements events.Publisher, so the relay retries
+// it apart from the events publisher; an event published twice is only queued once per
+// endpoint.
+type Dispatcher struct {
+	repo *Repository
+}
+
+func NewDispatcher(repository *Repository) *Dispatcher {
+	return &Dispatcher{repo: repository}
+}
+
+func InitDispatcher() *Dispatcher {
+	return NewDispatcher(InitRepository())
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TransferCompleted:
+		var transfer models.Transfer
+		if err := json.Unmarshal(event.Payload, &transfer); err != nil {
+			return events.Undeliverable(err)
+		}
+		from, err := d.accountOwner(ctx, transfer.FromAccountID)
+		if err != nil {
+			return err
+		}
+		to, err := d.accountOwner(ctx, transfer.ToAccountID)
+		if err != nil {
+			return err
+		}
+		if err := d.dispatch(ctx, event, EventTransferSent, from); err != nil {
+			return err
+		}
+		return d.dispatch(ctx, event, EventTransferReceived, to)
+	case events.AccountFrozen:
+		var account models.Account
+		if err := json.Unmarshal(event.Payload, &account); err != nil {
+			return events.Undeliverable(err)
+		}
+		return d.dispatch(ctx, event, EventAccountFrozen, account.UserID)
+	}
+	return nil
+}
+
+// accountOwner returns the user of an account, or uuid.Nil for system accounts. Closed
+// accounts still have an owner.
+func (d *Dispatcher) accountOwner(ctx context.Context, accountID uuid.UUID) (uuid.UUID, error) {
+	var account models.Account
+	err := d.repo.DB.WithContext(ctx).Unscoped().Select("user_id", "is_system").Where("id = ?", accountID).First(&account).Error
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if account.IsSystem {
+		return uuid.Nil, nil
+	}
+	return account.UserID, nil
+}
+
+// dispatch queues event as eventType for every endpoint of userID that subscribes to it
+func (d *Dispatcher) dispatch(ctx context.Context, event events.Event, eventType string, userID uuid.UUID) error {
+	if userID == uuid.Nil {
+		return nil
+	}
+	endpoints, err := d.repo.subscribedEndpoints(ctx, userID, eventType)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		id := uuid.New()
+		body, err := json.Marshal(Body{ID: id, Type: eventType, CreatedAt: event.OccurredAt, Data: event.Payload})
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		err = d.repo.enqueue(ctx, &models.WebhookDelivery{
+			ID:            id,
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(body),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
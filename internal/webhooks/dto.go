@@ -0,0 +1,52 @@
+package webhooks
+
+// CreateWebhookRequest registers an endpoint.
+type CreateWebhookRequest struct {
+	// URL that receives a POST per event; https unless WEBHOOK_ALLOW_HTTP is set
+	URL string `json:"url" binding:"required,url,max=2048"`
+	// Events to send: transfer.received, transfer.sent and account.frozen
+	EventTypes  []string `json:"event_types" binding:"required,min=1,dive,oneof=transfer.received transfer.sent account.frozen"`
+	Description string   `json:"description" binding:"max=255"`
+}
+
+// WebhookResponse describes an endpoint.
+type WebhookResponse struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// CreateWebhookResponse describes a new endpoint with its signing secret, which is only
+// returned here.
+type CreateWebhookResponse struct {
+	WebhookResponse
+	// Key of the HMAC-SHA256 in the X-Signature header of every delivery
+	Secret string `json:"secret"`
+}
+
+// DeliveriesRequest filters the delivery log.
+type DeliveriesRequest struct {
+	// pending, succeeded or dead
+	Status string `form:"status" binding:"omitempty,oneof=pending succeeded dead"`
+}
+
+// DeliveryResponse describes a delivery and its last attempt.
+type DeliveryResponse struct {
+	ID        string `json:"id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// pending, succeeded or dead
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// When a pending delivery is attempted next
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	// HTTP status of the last attempt; absent when the request failed before a response
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
+	// Request body, as signed
+	Payload   string `json:"payload"`
+	CreatedAt string `json:"created_at"`
+}
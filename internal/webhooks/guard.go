@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// blockedPrefixes are ranges that IsGlobalUnicast and IsPrivate let through but that do not
+// reach the public internet
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// publicAddr reports whether deliveries may be sent to addr: it must be a global unicast
+// address outside the private, loopback, link-local, unspecified and multicast ranges
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupFunc resolves a host name, like net.Resolver.LookupNetIP
+type lookupFunc func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+// checkHost rejects hosts that are, or resolve to, addresses that are not public, so that
+// endpoints cannot point deliveries at the bank's own network
+func checkHost(ctx context.Context, host string, lookup lookupFunc) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w: %s", ErrForbiddenHost, host)
+		}
+		return nil
+	}
+	addrs, err := lookup(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s", ErrForbiddenHost, host)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenHost, host, addr)
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses that are not public. It runs on the resolved
+// address of every connection, so a host that resolves to a public address when it is
+// registered cannot be rebound to a private one later.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenHost, address)
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenHost, addrPort.Addr())
+	}
+	return nil
+}
+
+// newDeliveryClient returns the client deliveries are sent with. It only connects to public
+// addresses, ignores proxy settings, which would hide the address it connects to, and does
+// not follow redirects.
+func newDeliveryClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   requestTimeout,
+			ResponseHeaderTimeout: requestTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
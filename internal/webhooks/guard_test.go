@@ -0,0 +1,91 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicAddr(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":          true,
+		"2606:2800:220:1::1":     true,
+		"127.0.0.1":              false,
+		"10.0.0.1":               false,
+		"172.16.5.4":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"0.1.2.3":                false,
+		"224.0.0.1":              false,
+		"255.255.255.255":        false,
+		"::1":                    false,
+		"::":                     false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"ff02::1":                false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+	} {
+		assert.Equal(t, public, publicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	resolve := func(addrs ...string) lookupFunc {
+		return func(context.Context, string, string) ([]netip.Addr, error) {
+			var list []netip.Addr
+			for _, addr := range addrs {
+				list = append(list, netip.MustParseAddr(addr))
+			}
+			return list, nil
+		}
+	}
+	ctx := context.Background()
+	assert.NoError(t, checkHost(ctx, "hooks.example.com", resolve("93.184.216.34")))
+	assert.NoError(t, checkHost(ctx, "93.184.216.34", nil))
+	assert.ErrorIs(t, checkHost(ctx, "169.254.169.254", nil), ErrForbiddenHost)
+	assert.ErrorIs(t, checkHost(ctx, "localhost", resolve("127.0.0.1", "::1")), ErrForbiddenHost)
+	assert.ErrorIs(t, checkHost(ctx, "mixed.example.com", resolve("93.184.216.34", "10.0.0.7")), ErrForbiddenHost)
+	failing := func(context.Context, string, string) ([]netip.Addr, error) { return nil, errors.New("no such host") }
+	assert.ErrorIs(t, checkHost(ctx, "missing.example.com", failing), ErrForbiddenHost)
+}
+
+func TestDeliveryClient_RefusesPrivateAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	// The check runs on the address connected to, whatever the URL says
+	_, err := newDeliveryClient().Post(server.URL, "application/json", strings.NewReader("{}"))
+	assert.ErrorIs(t, err, ErrForbiddenHost)
+	_, err = newDeliveryClient().Post(strings.Replace(server.URL, "127.0.0.1", "localhost", 1), "application/json", strings.NewReader("{}"))
+	assert.ErrorIs(t, err, ErrForbiddenHost)
+	assert.False(t, called)
+}
+
+func TestDeliveryClient_DoesNotFollowRedirects(t *testing.T) {
+	client := newDeliveryClient()
+	// Allow the local test server, keeping the redirect policy under test
+	client.Transport = http.DefaultTransport
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+}
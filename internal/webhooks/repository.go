@@ -0,0 +1,151 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deliveryLogLimit caps the deliveries listed per request
+const deliveryLogLimit = 100
+
+type Repository struct {
+	DB *gorm.DB
+}
+
+func InitRepository() *Repository {
+	return &Repository{DB: db.DB}
+}
+
+func (r *Repository) create(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	return r.DB.WithContext(ctx).Create(endpoint).Error
+}
+
+// get returns an endpoint of userID
+func (r *Repository) get(ctx context.Context, id, userID uuid.UUID) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := r.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&endpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// listByUser returns the endpoints of a user, newest first
+func (r *Repository) listByUser(ctx context.Context, userID uuid.UUID) ([]models.WebhookEndpoint, error) {
+	var list []models.WebhookEndpoint
+	err := r.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+// delete removes an endpoint of userID together with its deliveries
+func (r *Repository) delete(ctx context.Context, id, userID uuid.UUID) error {
+	result := r.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebhookEndpoint{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// listDeliveries returns the latest deliveries of an endpoint, newest first, optionally
+// only those in status
+func (r *Repository) listDeliveries(ctx context.Context, endpointID uuid.UUID, status string) ([]models.WebhookDelivery, error) {
+	query := r.DB.WithContext(ctx).Where("endpoint_id = ?", endpointID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var list []models.WebhookDelivery
+	err := query.Order("created_at DESC").Limit(deliveryLogLimit).Find(&list).Error
+	return list, err
+}
+
+// requeue makes a delivery of an endpoint pending again with a fresh set of attempts
+func (r *Repository) requeue(ctx context.Context, id, endpointID uuid.UUID, now time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND endpoint_id = ?", id, endpointID).
+			First(&delivery).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDeliveryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if delivery.Status == models.WebhookDeliverySucceeded {
+			return ErrAlreadyDelivered
+		}
+		delivery.Status = models.WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = &now
+		return tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// subscribedEndpoints returns the endpoints of userID that receive eventType
+func (r *Repository) subscribedEndpoints(ctx context.Context, userID uuid.UUID, eventType string) ([]models.WebhookEndpoint, error) {
+	list, err := r.listByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := list[:0]
+	for _, endpoint := range list {
+		if subscribes(&endpoint, eventType) {
+			subscribed = append(subscribed, endpoint)
+		}
+	}
+	return subscribed, nil
+}
+
+// enqueue adds a delivery unless the endpoint already has one for the same event, which
+// happens when the relay publishes an event again
+func (r *Repository) enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return r.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(delivery).Error
+}
+
+// claimDue locks the pending delivery that has been due the longest, with its endpoint,
+// skipping rows another worker holds. It returns nil when nothing is due.
+func claimDue(tx *gorm.DB, now time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at").
+		First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var endpoint models.WebhookEndpoint
+	if err := tx.Where("id = ?", delivery.EndpointID).First(&endpoint).Error; err != nil {
+		return nil, err
+	}
+	delivery.Endpoint = &endpoint
+	return &delivery, nil
+}
@@ -0,0 +1,23 @@
+package webhooks
+
+import (
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the caller's webhook endpoints and their delivery logs
+func RegisterRoutes(routerGroup *gin.RouterGroup) {
+	service := InitService()
+	controller := NewController(service)
+
+	routerGroup.Use(auth.UserMiddleware())
+
+	routerGroup.GET("", controller.list)
+	routerGroup.POST("", idempotency.Middleware(), audit.Action("webhook.create", "webhook"), controller.create)
+	routerGroup.GET("/:id", controller.get)
+	routerGroup.DELETE("/:id", audit.Action("webhook.delete", "webhook"), controller.delete)
+	routerGroup.GET("/:id/deliveries", controller.deliveries)
+	routerGroup.POST("/:id/deliveries/:delivery_id/retry", audit.Action("webhook.delivery.retry", "webhook"), controller.retry)
+}
@@ -0,0 +1,187 @@
+// Package webhooks notifies users of events on their accounts by POSTing signed JSON to
+// endpoints they register. A Dispatcher turns domain events from the outbox into
+// deliveries, and a Deliverer sends them, retrying failures with exponential backoff.
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/google/uuid"
+)
+
+// Event types an endpoint can subscribe to
+const (
+	EventTransferReceived = "transfer.received"
+	EventTransferSent     = "transfer.sent"
+	EventAccountFrozen    = "account.frozen"
+)
+
+// Errors
+var (
+	ErrNotFound         = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrAlreadyDelivered = errors.New("webhook delivery has already succeeded")
+	ErrInsecureURL      = errors.New("webhook url must use https")
+	ErrForbiddenHost    = errors.New("webhook url must point to a public host")
+)
+
+type Service struct {
+	repo   *Repository
+	now    func() time.Time
+	lookup lookupFunc
+}
+
+func NewService(repository *Repository) *Service {
+	return &Service{
+		repo:   repository,
+		now:    time.Now,
+		lookup: net.DefaultResolver.LookupNetIP,
+	}
+}
+
+func InitService() *Service {
+	return NewService(InitRepository())
+}
+
+// allowHTTP reports whether endpoints may use plain http, for development and tests
+func allowHTTP() bool {
+	return os.Getenv(common.WebhookAllowHTTP) == "true"
+}
+
+// Create registers an endpoint of userID and returns it with its signing secret
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, req CreateWebhookRequest) (*models.WebhookEndpoint, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", req.URL)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && allowHTTP()) {
+		return nil, ErrInsecureURL
+	}
+	if err := checkHost(ctx, u.Hostname(), s.lookup); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := &models.WebhookEndpoint{
+		UserID:      userID,
+		URL:         req.URL,
+		Secret:      secret,
+		EventTypes:  strings.Join(dedupe(req.EventTypes), ","),
+		Description: req.Description,
+	}
+	if err := s.repo.create(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// List returns the endpoints of userID, newest first
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]models.WebhookEndpoint, error) {
+	return s.repo.listByUser(ctx, userID)
+}
+
+// Get returns an endpoint of userID; other users' endpoints are not found
+func (s *Service) Get(ctx context.Context, id string, userID uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpointID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return s.repo.get(ctx, endpointID, userID)
+}
+
+// Delete removes an endpoint of userID and its delivery log
+func (s *Service) Delete(ctx context.Context, id string, userID uuid.UUID) error {
+	endpointID, err := uuid.Parse(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	return s.repo.delete(ctx, endpointID, userID)
+}
+
+// Deliveries returns the latest deliveries of an endpoint of userID, newest first
+func (s *Service) Deliveries(ctx context.Context, id string, userID uuid.UUID, status string) ([]models.WebhookDelivery, error) {
+	endpoint, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.listDeliveries(ctx, endpoint.ID, status)
+}
+
+// Retry sends a pending or dead delivery of an endpoint of userID again right away, with a
+// fresh set of attempts
+func (s *Service) Retry(ctx context.Context, id, deliveryID string, userID uuid.UUID) (*models.WebhookDelivery, error) {
+	endpoint, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	did, err := uuid.Parse(deliveryID)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return s.repo.requeue(ctx, did, endpoint.ID, s.now())
+}
+
+// subscribes reports whether endpoint receives eventType
+func subscribes(endpoint *models.WebhookEndpoint, eventType string) bool {
+	for _, t := range strings.Split(endpoint.EventTypes, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe returns values without repeats, in their first order
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func toResponse(endpoint *models.WebhookEndpoint) WebhookResponse {
+	return WebhookResponse{
+		ID:          endpoint.ID.String(),
+		URL:         endpoint.URL,
+		EventTypes:  strings.Split(endpoint.EventTypes, ","),
+		Description: endpoint.Description,
+		CreatedAt:   endpoint.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toDeliveryResponse(delivery *models.WebhookDelivery) DeliveryResponse {
+	resp := DeliveryResponse{
+		ID:             delivery.ID.String(),
+		EventID:        delivery.EventID.String(),
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		Payload:        delivery.Payload,
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+	}
+	if delivery.NextAttemptAt != nil {
+		resp.NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+	}
+	if delivery.DeliveredAt != nil {
+		resp.DeliveredAt = delivery.DeliveredAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,340 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/common"
+	"github.com/ahmedkhaeld/banking-app/db"
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// load the environment variables
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+	// Connect to the test database
+	if err := db.Open(os.Getenv("DB_SOURCE_TEST")); err != nil {
+		panic("failed to connect to test database: " + err.Error())
+	}
+	if err := db.AddUUIDExtension(); err != nil {
+		panic("failed to add UUID extension: " + err.Error())
+	}
+	if err := db.DB.AutoMigrate(&models.User{}, &models.Account{}, &models.Transfer{}, &models.OutboxEvent{},
+		&models.WebhookEndpoint{}, &models.WebhookDelivery{}); err != nil {
+		panic("failed to run migrations: " + err.Error())
+	}
+	// httptest receivers listen on plain http
+	os.Setenv(common.WebhookAllowHTTP, "true")
+	os.Exit(m.Run())
+}
+
+func setupTestService(t *testing.T) *Service {
+	repo := InitRepository()
+	t.Cleanup(func() {
+		repo.DB.Exec("DELETE FROM webhook_deliveries")
+		repo.DB.Exec("DELETE FROM webhook_endpoints")
+		repo.DB.Exec("DELETE FROM accounts")
+		repo.DB.Exec("DELETE FROM users")
+	})
+	service := NewService(repo)
+	service.lookup = testLookup
+	return service
+}
+
+// testAddr is the public address test hosts resolve to; testClient connects to their
+// receivers instead
+var testAddr = netip.MustParseAddr("203.0.113.10")
+
+var (
+	testHostsMu sync.Mutex
+	// testHosts maps the host of each receiver to the address it listens on
+	testHosts = map[string]string{}
+)
+
+func testLookup(_ context.Context, _, host string) ([]netip.Addr, error) {
+	return []netip.Addr{testAddr}, nil
+}
+
+// testClient sends deliveries to receivers by host name
+func testClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(address)
+			testHostsMu.Lock()
+			listener := testHosts[host]
+			testHostsMu.Unlock()
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, listener)
+		},
+	}}
+}
+
+func createTestUser(t *testing.T) *models.User {
+	user := &models.User{
+		ID:       uuid.New(),
+		Username: "testuser_" + uuid.New().String()[:8],
+		Password: "not-a-hash",
+		FullName: "Test User",
+		Email:    "test_" + uuid.New().String()[:8] + "@example.com",
+	}
+	assert.NoError(t, db.DB.Create(user).Error)
+	return user
+}
+
+func createTestAccount(t *testing.T, user *models.User) *models.Account {
+	acc := &models.Account{
+		ID:       uuid.New(),
+		UserID:   user.ID,
+		Owner:    user.Username,
+		Currency: "USD",
+	}
+	assert.NoError(t, db.DB.Create(acc).Error)
+	return acc
+}
+
+// receiver is a local webhook endpoint that verifies signatures and answers with status
+type receiver struct {
+	*httptest.Server
+	host     string
+	mu       sync.Mutex
+	secret   string
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+	verified []error
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusNoContent, host: "hooks-" + uuid.New().String()[:8] + ".example.com"}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		r.verified = append(r.verified, VerifySignature(r.secret, req.Header.Get(SignatureHeader), body, time.Now(), 5*time.Minute))
+		w.WriteHeader(r.status)
+	}))
+	testHostsMu.Lock()
+	testHosts[r.host] = r.Listener.Addr().String()
+	testHostsMu.Unlock()
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) register(t *testing.T, service *Service, user *models.User, eventTypes ...string) *models.WebhookEndpoint {
+	endpoint, err := service.Create(context.Background(), user.ID, CreateWebhookRequest{URL: "http://" + r.host + "/hooks", EventTypes: eventTypes})
+	assert.NoError(t, err)
+	r.mu.Lock()
+	r.secret = endpoint.Secret
+	r.mu.Unlock()
+	return endpoint
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func transferEvent(t *testing.T, from, to *models.Account) events.Event {
+	transfer := models.Transfer{ID: uuid.New(), FromAccountID: from.ID, ToAccountID: to.ID, Amount: 2500, FromCurrency: "USD"}
+	payload, err := json.Marshal(transfer)
+	assert.NoError(t, err)
+	return events.Event{
+		ID:            uuid.New(),
+		Type:          events.TransferCompleted,
+		AggregateType: events.AggregateTransfer,
+		AggregateID:   transfer.ID,
+		Payload:       payload,
+		OccurredAt:    time.Now(),
+	}
+}
+
+func TestCreate_RequiresHTTPS(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t)
+	os.Setenv(common.WebhookAllowHTTP, "")
+	defer os.Setenv(common.WebhookAllowHTTP, "true")
+
+	_, err := service.Create(context.Background(), user.ID, CreateWebhookRequest{URL: "http://example.com/hooks", EventTypes: []string{EventTransferSent}})
+	assert.ErrorIs(t, err, ErrInsecureURL)
+
+	endpoint, err := service.Create(context.Background(), user.ID, CreateWebhookRequest{
+		URL:        "https://example.com/hooks",
+		EventTypes: []string{EventTransferSent, EventTransferSent, EventAccountFrozen},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "transfer.sent,account.frozen", endpoint.EventTypes)
+	assert.NotEmpty(t, endpoint.Secret)
+}
+
+func TestCreate_RejectsInternalHosts(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t)
+	for _, url := range []string{
+		"https://127.0.0.1/hooks",
+		"https://10.1.2.3/hooks",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]:8443/hooks",
+		"https://0.0.0.0/hooks",
+	} {
+		_, err := service.Create(context.Background(), user.ID, CreateWebhookRequest{URL: url, EventTypes: []string{EventTransferSent}})
+		assert.ErrorIs(t, err, ErrForbiddenHost, url)
+	}
+
+	// Host names are checked by the addresses they resolve to
+	service.lookup = func(context.Context, string, string) ([]netip.Addr, error) {
+		return []netip.Addr{testAddr, netip.MustParseAddr("192.168.0.10")}, nil
+	}
+	_, err := service.Create(context.Background(), user.ID, CreateWebhookRequest{URL: "https://internal.example.com/hooks", EventTypes: []string{EventTransferSent}})
+	assert.ErrorIs(t, err, ErrForbiddenHost)
+}
+
+func TestGet_OtherUsersEndpointIsNotFound(t *testing.T) {
+	service := setupTestService(t)
+	owner := createTestUser(t)
+	other := createTestUser(t)
+	endpoint, err := service.Create(context.Background(), owner.ID, CreateWebhookRequest{URL: "https://example.com/hooks", EventTypes: []string{EventTransferSent}})
+	assert.NoError(t, err)
+
+	_, err = service.Get(context.Background(), endpoint.ID.String(), other.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, service.Delete(context.Background(), endpoint.ID.String(), other.ID), ErrNotFound)
+	assert.NoError(t, service.Delete(context.Background(), endpoint.ID.String(), owner.ID))
+}
+
+func TestDeliverDue_SendsSignedDeliveries(t *testing.T) {
+	service := setupTestService(t)
+	sender := createTestUser(t)
+	recipient := createTestUser(t)
+	from := createTestAccount(t, sender)
+	to := createTestAccount(t, recipient)
+	senderHooks := newReceiver(t)
+	recipientHooks := newReceiver(t)
+	senderHooks.register(t, service, sender, EventTransferSent)
+	received := recipientHooks.register(t, service, recipient, EventTransferReceived)
+
+	dispatcher := NewDispatcher(service.repo)
+	event := transferEvent(t, from, to)
+	assert.NoError(t, dispatcher.Publish(context.Background(), event))
+	// The relay publishes an event again after a failure; it is only queued once
+	assert.NoError(t, dispatcher.Publish(context.Background(), event))
+
+	deliverer := NewDeliverer(service.repo, testClient(), 0)
+	n, err := deliverer.DeliverDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, 1, senderHooks.count())
+	assert.Equal(t, 1, recipientHooks.count())
+	assert.NoError(t, recipientHooks.verified[0])
+	assert.Equal(t, EventTransferReceived, recipientHooks.requests[0].Header.Get(EventTypeHeader))
+	assert.Equal(t, EventTransferSent, senderHooks.requests[0].Header.Get(EventTypeHeader))
+	var body Body
+	assert.NoError(t, json.Unmarshal(recipientHooks.bodies[0], &body))
+	assert.Equal(t, EventTransferReceived, body.Type)
+	assert.Equal(t, recipientHooks.requests[0].Header.Get(DeliveryIDHeader), body.ID.String())
+
+	deliveries, err := service.Deliveries(context.Background(), received.ID.String(), recipient.ID, "")
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, event.ID, deliveries[0].EventID)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].LastStatusCode)
+}
+
+func TestDeliverDue_RetriesWithBackoffThenDies(t *testing.T) {
+	service := setupTestService(t)
+	user := createTestUser(t)
+	account := createTestAccount(t, user)
+	hooks := newReceiver(t)
+	hooks.setStatus(http.StatusInternalServerError)
+	endpoint := hooks.register(t, service, user, EventAccountFrozen)
+
+	payload, err := json.Marshal(account)
+	assert.NoError(t, err)
+	dispatcher := NewDispatcher(service.repo)
+	assert.NoError(t, dispatcher.Publish(context.Background(), events.Event{
+		ID:          uuid.New(),
+		Type:        events.AccountFrozen,
+		AggregateID: account.ID,
+		Payload:     payload,
+		OccurredAt:  time.Now(),
+	}))
+
+	deliverer := NewDeliverer(service.repo, testClient(), 0)
+	now := time.Now()
+	deliverer.now = func() time.Time { return now }
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		n, err := deliverer.DeliverDue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		// Nothing is due again until the backoff has passed
+		n, err = deliverer.DeliverDue(context.Background())
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+		now = now.Add(retryDelay(attempt))
+	}
+	assert.Equal(t, MaxAttempts, hooks.count())
+
+	dead, err := service.Deliveries(context.Background(), endpoint.ID.String(), user.ID, models.WebhookDeliveryDead)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, http.StatusInternalServerError, dead[0].LastStatusCode)
+	assert.Contains(t, dead[0].LastError, "500")
+
+	// A retried dead delivery goes out again with a fresh set of attempts
+	hooks.setStatus(http.StatusOK)
+	service.now = func() time.Time { return now }
+	retried, err := service.Retry(context.Background(), endpoint.ID.String(), dead[0].ID.String(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.WebhookDeliveryPending, retried.Status)
+	assert.Zero(t, retried.Attempts)
+	n, err := deliverer.DeliverDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = service.Retry(context.Background(), endpoint.ID.String(), dead[0].ID.String(), user.ID)
+	assert.ErrorIs(t, err, ErrAlreadyDelivered)
+}
+
+func TestDispatcher_SkipsUnsubscribedEndpoints(t *testing.T) {
+	service := setupTestService(t)
+	sender := createTestUser(t)
+	recipient := createTestUser(t)
+	hooks := newReceiver(t)
+	hooks.register(t, service, recipient, EventAccountFrozen)
+
+	dispatcher := NewDispatcher(service.repo)
+	event := transferEvent(t, createTestAccount(t, sender), createTestAccount(t, recipient))
+	assert.NoError(t, dispatcher.Publish(context.Background(), event))
+
+	n, err := NewDeliverer(service.repo, testClient(), 0).DeliverDue(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Zero(t, hooks.count())
+}
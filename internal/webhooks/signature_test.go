@@ -0,0 +1,84 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedkhaeld/banking-app/db/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign_VerifiesRoundTrip(t *testing.T) {
+	secret, err := newSecret()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, secretPrefix))
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"type":"transfer.received"}`)
+
+	header := Sign(secret, now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+	assert.NoError(t, VerifySignature(secret, header, body, now.Add(time.Minute), 5*time.Minute))
+}
+
+func TestVerifySignature_RejectsTampering(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"amount":100}`)
+	header := Sign("whsec_a", now, body)
+
+	assert.ErrorIs(t, VerifySignature("whsec_a", header, []byte(`{"amount":900}`), now, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("whsec_b", header, body, now, time.Minute), ErrInvalidSignature)
+	// Moving the timestamp forward invalidates the signature rather than extending it
+	replayed := strings.Replace(header, "t=1700000000", "t=1700000600", 1)
+	assert.ErrorIs(t, VerifySignature("whsec_a", replayed, body, now.Add(10*time.Minute), time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("whsec_a", "v1=00", body, now, time.Minute), ErrInvalidSignature)
+}
+
+func TestVerifySignature_RejectsStale(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{}`)
+	header := Sign("whsec_a", now, body)
+
+	assert.ErrorIs(t, VerifySignature("whsec_a", header, body, now.Add(6*time.Minute), 5*time.Minute), ErrStaleSignature)
+	assert.ErrorIs(t, VerifySignature("whsec_a", header, body, now.Add(-6*time.Minute), 5*time.Minute), ErrStaleSignature)
+}
+
+func TestRetryDelay_DoublesUpToCap(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(1))
+	assert.Equal(t, time.Minute, retryDelay(2))
+	assert.Equal(t, 2*time.Minute, retryDelay(3))
+	assert.Equal(t, retryCap, retryDelay(20))
+}
+
+func TestSettle_RetriesThenDies(t *testing.T) {
+	now := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	delivery := &models.WebhookDelivery{Status: models.WebhookDeliveryPending, NextAttemptAt: &now}
+	failure := errors.New("endpoint answered 500 Internal Server Error")
+
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		settle(delivery, now, 500, failure)
+		assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+		assert.Equal(t, attempt, delivery.Attempts)
+		assert.Equal(t, now.Add(retryDelay(attempt)), *delivery.NextAttemptAt)
+		assert.Equal(t, 500, delivery.LastStatusCode)
+		assert.Equal(t, failure.Error(), delivery.LastError)
+		now = *delivery.NextAttemptAt
+	}
+	settle(delivery, now, 0, failure)
+	assert.Equal(t, models.WebhookDeliveryDead, delivery.Status)
+	assert.Equal(t, MaxAttempts, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+}
+
+func TestSettle_Succeeds(t *testing.T) {
+	now := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	delivery := &models.WebhookDelivery{Status: models.WebhookDeliveryPending, Attempts: 2, LastError: "timeout"}
+
+	settle(delivery, now, 204, nil)
+	assert.Equal(t, models.WebhookDeliverySucceeded, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, now, *delivery.DeliveredAt)
+	assert.Empty(t, delivery.LastError)
+	assert.Nil(t, delivery.NextAttemptAt)
+}
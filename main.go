@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
+	"github.com/ahmedkhaeld/banking-app/common"
 	"github.com/ahmedkhaeld/banking-app/db"
 	_ "github.com/ahmedkhaeld/banking-app/docs" // Import the generated docs
 	"github.com/ahmedkhaeld/banking-app/internal/account"
+	"github.com/ahmedkhaeld/banking-app/internal/admin"
+	"github.com/ahmedkhaeld/banking-app/internal/audit"
+	"github.com/ahmedkhaeld/banking-app/internal/auth"
+	"github.com/ahmedkhaeld/banking-app/internal/events"
+	"github.com/ahmedkhaeld/banking-app/internal/fx"
+	"github.com/ahmedkhaeld/banking-app/internal/idempotency"
+	"github.com/ahmedkhaeld/banking-app/internal/mfa"
+	"github.com/ahmedkhaeld/banking-app/internal/ratelimit"
+	"github.com/ahmedkhaeld/banking-app/internal/scheduled"
 	"github.com/ahmedkhaeld/banking-app/internal/transfer"
 	"github.com/ahmedkhaeld/banking-app/internal/user"
+	"github.com/ahmedkhaeld/banking-app/internal/webhooks"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -31,12 +43,19 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 	server := gin.New()
+	// Client IPs key the per-IP rate limits and login counters; only trust X-Forwarded-For from known proxies
+	if err := ratelimit.TrustProxies(server, os.Getenv(common.TrustedProxies)); err != nil {
+		log.Fatal("Error loading trusted proxies: ", err)
+	}
 	server.Use(gin.Recovery())
+	// Tag every request with an ID that its audit entries carry
+	server.Use(audit.RequestID())
 
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Content-Type", "Authorization", idempotency.HeaderKey, audit.RequestIDHeader, transfer.StepUpHeader}
+	config.ExposeHeaders = []string{audit.RequestIDHeader}
 	server.Use(cors.New(config))
 
 	if os.Getenv("GIN_MODE") == "debug" {
@@ -53,15 +72,45 @@ func main() {
 		log.Fatal("Error running migrations: ", err)
 	}
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Pay due standing orders in the background; every replica can run a worker
+	if worker := scheduled.InitWorker(); worker != nil {
+		go worker.Run(context.Background())
+	}
+	// Publish the domain events of the outbox, also queueing webhook deliveries; every
+	// replica can run a relay
+	if relay := events.InitRelay(events.Subscriber{Name: webhooks.SubscriberName, Publisher: webhooks.InitDispatcher()}); relay != nil {
+		go relay.Run(context.Background())
+	}
+	// Send due webhook deliveries and retry failed ones
+	if deliverer := webhooks.InitDeliverer(); deliverer != nil {
+		go deliverer.Run(context.Background())
+	}
+	// Release holds that were neither captured nor voided in time
+	if interval := transfer.HoldExpiryInterval(); interval > 0 {
+		go transfer.InitRepository().RunHoldExpiry(context.Background(), interval)
+	}
+
 	server.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "OK"})
 	})
 
-	apiV1 := server.Group("/api/v1")
+	// Public keys for verifying access tokens signed with RS256 / EdDSA
+	server.GET("/.well-known/jwks.json", auth.JWKSHandler())
+
+	// Every API request counts against a per-IP limit; groups below add their own
+	apiV1 := server.Group("/api/v1", ratelimit.Middleware(ratelimit.GroupAPI))
 
 	userGroup := apiV1.Group("/users")
 	user.RegisterRoutes(userGroup)
 
+	// Register the caller's two-factor settings
+	mfaGroup := userGroup.Group("/me/mfa")
+	mfa.RegisterRoutes(mfaGroup)
+
 	// Register account routes with authentication middleware
 	accountGroup := apiV1.Group("/accounts")
 	account.RegisterRoutes(accountGroup)
@@ -70,6 +119,22 @@ func main() {
 	transferGroup := apiV1.Group("/transfers")
 	transfer.RegisterRoutes(transferGroup)
 
+	// Register the caller's scheduled and recurring transfers
+	scheduledGroup := transferGroup.Group("/scheduled")
+	scheduled.RegisterRoutes(scheduledGroup)
+
+	// Register fx quote routes with authentication middleware
+	fxGroup := apiV1.Group("/fx")
+	fx.RegisterRoutes(fxGroup)
+
+	// Register staff-only admin routes, restricted by role and audited
+	adminGroup := apiV1.Group("/admin")
+	admin.RegisterRoutes(adminGroup)
+
+	// Register the caller's webhook endpoints
+	webhookGroup := apiV1.Group("/webhooks")
+	webhooks.RegisterRoutes(webhookGroup)
+
 	server.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	server.Run(":" + os.Getenv("PORT"))